@@ -6,8 +6,8 @@ import (
 	"log"
 	"os"
 
-	"github.com/dkooll/wamcp/internal/database"
-	"github.com/dkooll/wamcp/internal/indexer"
+	"github.com/dkooll/wamcp/internal/embedding"
+	"github.com/dkooll/wamcp/internal/util"
 	"github.com/dkooll/wamcp/pkg/mcp"
 )
 
@@ -15,13 +15,27 @@ func main() {
 	org := flag.String("org", "cloudnationhq", "GitHub organization name")
 	token := flag.String("token", "", "GitHub personal access token (optional, for higher rate limits)")
 	dbPath := flag.String("db", "index.db", "Path to SQLite database file")
+	synonyms := flag.String("synonyms", "", "Path to a JSON file of extra search synonyms (optional)")
+	embedderCmd := flag.String("embedder-cmd", "", "Local command that embeds texts for semantic_search (optional; defaults to the built-in hashing embedder)")
 	flag.Parse()
 
 	log.SetOutput(os.Stderr)
+	if *synonyms != "" {
+		if err := util.LoadSynonyms(*synonyms); err != nil {
+			log.Fatalf("Failed to load synonyms: %v", err)
+		}
+	}
 	log.Println("Starting Azure CloudNation WAM MCP Server")
 	log.Printf("Database will be initialized at: %s (on first sync)", *dbPath)
 
 	server := mcp.NewServer(*dbPath, *token, *org)
+	if *embedderCmd != "" {
+		embedder, err := embedding.NewCommandEmbedder(*embedderCmd)
+		if err != nil {
+			log.Fatalf("Invalid embedder command: %v", err)
+		}
+		server.SetEmbedder(embedder)
+	}
 	if err := server.Run(context.Background(), os.Stdin, os.Stdout); err != nil {
 		log.Printf("Server stopped: %v", err)
 	}
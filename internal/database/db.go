@@ -3,7 +3,9 @@ package database
 
 import (
 	"database/sql"
+	"encoding/binary"
 	"fmt"
+	"math"
 	"strings"
 	"time"
 
@@ -11,7 +13,11 @@ import (
 )
 
 type DB struct {
-	conn *sql.DB
+	conn     *sql.DB
+	readOnly *sql.DB
+	// storedTables names every table in the database file, for the
+	// authorizer of the read-only connections.
+	storedTables map[string]bool
 }
 
 type Module struct {
@@ -24,6 +30,8 @@ type Module struct {
 	SyncedAt      time.Time
 	ReadmeContent string
 	HasExamples   bool
+	ParentID      int64  // 0 for repository root modules
+	Subpath       string // directory of a submodule in its repository (e.g., modules/subnet)
 }
 
 type ModuleFile struct {
@@ -45,6 +53,7 @@ type ModuleVariable struct {
 	DefaultValue string
 	Required     bool
 	Sensitive    bool
+	ExampleID    int64 // 0 for the module's own interface
 }
 
 type ModuleOutput struct {
@@ -54,6 +63,7 @@ type ModuleOutput struct {
 	Description string
 	Value       string
 	Sensitive   bool
+	ExampleID   int64
 }
 
 type ModuleResource struct {
@@ -63,6 +73,7 @@ type ModuleResource struct {
 	ResourceName string
 	Provider     string
 	SourceFile   string
+	ExampleID    int64
 }
 
 type ModuleDataSource struct {
@@ -72,6 +83,7 @@ type ModuleDataSource struct {
 	DataName   string
 	Provider   string
 	SourceFile string
+	ExampleID  int64
 }
 
 type ModuleExample struct {
@@ -82,9 +94,32 @@ type ModuleExample struct {
 	Content  string
 }
 
+type ModuleCondition struct {
+	ID           int64
+	ModuleID     int64
+	Kind         string
+	OwnerType    string
+	OwnerName    string
+	Condition    string
+	ErrorMessage string
+	SourceFile   string
+}
+
+type ModuleMigration struct {
+	ID          int64
+	ModuleID    int64
+	Kind        string
+	FromAddress string
+	ToAddress   string
+	ImportID    string
+	Destroy     bool
+	SourceFile  string
+}
+
 type ModuleAlias struct {
 	ID       int64
 	ModuleID int64
+	ParentID int64
 	Alias    string
 	Weight   int
 	Source   sql.NullString
@@ -101,14 +136,86 @@ type ModuleTag struct {
 type HCLBlock struct {
 	ID        int64
 	ModuleID  int64
+	ParentID  sql.NullInt64
 	FilePath  string
 	BlockType string
 	TypeLabel sql.NullString
+	Labels    sql.NullString
 	StartByte int64
 	EndByte   int64
 	AttrPaths sql.NullString
 }
 
+// ModuleEmbedding is the vector of one piece of module text (a README chunk,
+// a variable or a block) under one embedding model.
+type ModuleEmbedding struct {
+	ModuleID int64
+	Model    string
+	Kind     string
+	Ref      string
+	Content  string
+	Vector   []float32
+}
+
+type HCLAttribute struct {
+	ID            int64
+	ModuleID      int64
+	BlockID       int64
+	ExampleID     int64
+	FilePath      string
+	RootType      string
+	RootLabel     string
+	AttributePath string
+	Value         sql.NullString
+	Expression    string
+	StartByte     int64
+	EndByte       int64
+}
+
+// AttributeValueFilter narrows AggregateAttributeValues. Empty fields are ignored.
+// AttributePath may contain '*' wildcards. Values set in examples are left out
+// unless IncludeExamples is set.
+type AttributeValueFilter struct {
+	AttributePath   string
+	IncludeExamples bool
+	RootType        string
+	TypePrefix      string
+	ModuleID        int64
+	Value           string
+	ValuePrefix     string
+	ExcludeValue    string
+	Limit           int
+}
+
+type AttributeValueCount struct {
+	Value       string
+	Literal     bool
+	Occurrences int
+	ModuleCount int
+	Modules     []string
+}
+
+// RelationshipFilter narrows SearchRelationships. Empty fields are ignored.
+// ResourceType, AttributePath, FilePath and ExcludePaths may contain '*'
+// wildcards; Exact restricts Term
+// to whole symbols, attributes and fields below a symbol instead of substrings.
+type RelationshipFilter struct {
+	ModuleID      int64
+	Term          string
+	Exact         bool
+	ReferenceType string
+	BlockType     string
+	ResourceType  string
+	AttributePath string
+	FilePath      string
+	ExcludePaths  []string
+	// IncludeExamples also returns references in example code, which is left
+	// out by default.
+	IncludeExamples bool
+	Offset          int
+	Limit           int
+}
+
 type HCLRelationship struct {
 	ID            int64
 	ModuleID      int64
@@ -118,8 +225,13 @@ type HCLRelationship struct {
 	AttributePath string
 	ReferenceType string
 	ReferenceName string
-	StartByte     int64
-	EndByte       int64
+	// IteratorSource is the for_each or count expression an iterator
+	// reference (each.value.x, count.index, <dynamic>.value.x) walks over.
+	IteratorSource string
+	StartByte      int64
+	EndByte        int64
+	// ExampleID is set for references in example code.
+	ExampleID int64
 }
 
 func New(dbPath string) (*DB, error) {
@@ -138,10 +250,69 @@ func New(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to initialize schema: %w", err)
 	}
 
-	return &DB{conn: conn}, nil
+	db := &DB{conn: conn}
+	if err := db.migrate(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
+	}
+
+	if err := db.loadStoredTables(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	db.readOnly = db.openReadOnly(dbPath)
+
+	return db, nil
+}
+
+func (db *DB) migrate() error {
+	for _, m := range ColumnMigrations {
+		exists, err := db.columnExists(m.Table, m.Column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := db.conn.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.Table, m.Column, m.Definition)); err != nil {
+			return fmt.Errorf("failed to add %s.%s: %w", m.Table, m.Column, err)
+		}
+	}
+
+	_, err := db.conn.Exec(PostMigrationSchema)
+	return err
+}
+
+func (db *DB) columnExists(table, column string) (bool, error) {
+	rows, err := db.conn.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
 }
 
 func (db *DB) Close() error {
+	if db.readOnly != nil {
+		db.readOnly.Close()
+	}
 	return db.conn.Close()
 }
 
@@ -152,8 +323,8 @@ func escapeFTS5(query string) string {
 
 func (db *DB) InsertModule(m *Module) (int64, error) {
 	_, err := db.conn.Exec(`
-		INSERT INTO modules (name, full_name, description, repo_url, last_updated, readme_content, has_examples)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO modules (name, full_name, description, repo_url, last_updated, readme_content, has_examples, parent_id, subpath)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(name) DO UPDATE SET
 			full_name = excluded.full_name,
 			description = excluded.description,
@@ -161,8 +332,10 @@ func (db *DB) InsertModule(m *Module) (int64, error) {
 			last_updated = excluded.last_updated,
 			readme_content = excluded.readme_content,
 			has_examples = excluded.has_examples,
+			parent_id = excluded.parent_id,
+			subpath = excluded.subpath,
 			synced_at = CURRENT_TIMESTAMP
-	`, m.Name, m.FullName, m.Description, m.RepoURL, m.LastUpdated, m.ReadmeContent, m.HasExamples)
+	`, m.Name, m.FullName, m.Description, m.RepoURL, m.LastUpdated, m.ReadmeContent, m.HasExamples, nullIfZero(m.ParentID), nullIfEmpty(m.Subpath))
 	if err != nil {
 		return 0, err
 	}
@@ -178,9 +351,9 @@ func (db *DB) InsertModule(m *Module) (int64, error) {
 func (db *DB) GetModule(name string) (*Module, error) {
 	var m Module
 	err := db.conn.QueryRow(`
-		SELECT id, name, full_name, description, repo_url, last_updated, synced_at, readme_content, has_examples
+		SELECT id, name, full_name, description, repo_url, last_updated, synced_at, readme_content, has_examples, IFNULL(parent_id, 0), IFNULL(subpath, '')
 		FROM modules WHERE name = ?
-	`, name).Scan(&m.ID, &m.Name, &m.FullName, &m.Description, &m.RepoURL, &m.LastUpdated, &m.SyncedAt, &m.ReadmeContent, &m.HasExamples)
+	`, name).Scan(&m.ID, &m.Name, &m.FullName, &m.Description, &m.RepoURL, &m.LastUpdated, &m.SyncedAt, &m.ReadmeContent, &m.HasExamples, &m.ParentID, &m.Subpath)
 	if err != nil {
 		return nil, err
 	}
@@ -190,9 +363,9 @@ func (db *DB) GetModule(name string) (*Module, error) {
 func (db *DB) GetModuleByID(id int64) (*Module, error) {
 	var m Module
 	err := db.conn.QueryRow(`
-		SELECT id, name, full_name, description, repo_url, last_updated, synced_at, readme_content, has_examples
+		SELECT id, name, full_name, description, repo_url, last_updated, synced_at, readme_content, has_examples, IFNULL(parent_id, 0), IFNULL(subpath, '')
 		FROM modules WHERE id = ?
-	`, id).Scan(&m.ID, &m.Name, &m.FullName, &m.Description, &m.RepoURL, &m.LastUpdated, &m.SyncedAt, &m.ReadmeContent, &m.HasExamples)
+	`, id).Scan(&m.ID, &m.Name, &m.FullName, &m.Description, &m.RepoURL, &m.LastUpdated, &m.SyncedAt, &m.ReadmeContent, &m.HasExamples, &m.ParentID, &m.Subpath)
 	if err != nil {
 		return nil, err
 	}
@@ -201,7 +374,7 @@ func (db *DB) GetModuleByID(id int64) (*Module, error) {
 
 func (db *DB) ListModules() ([]Module, error) {
 	rows, err := db.conn.Query(`
-		SELECT id, name, full_name, description, repo_url, last_updated, synced_at, readme_content, has_examples
+		SELECT id, name, full_name, description, repo_url, last_updated, synced_at, readme_content, has_examples, IFNULL(parent_id, 0), IFNULL(subpath, '')
 		FROM modules ORDER BY name
 	`)
 	if err != nil {
@@ -212,7 +385,7 @@ func (db *DB) ListModules() ([]Module, error) {
 	var modules []Module
 	for rows.Next() {
 		var m Module
-		if err := rows.Scan(&m.ID, &m.Name, &m.FullName, &m.Description, &m.RepoURL, &m.LastUpdated, &m.SyncedAt, &m.ReadmeContent, &m.HasExamples); err != nil {
+		if err := rows.Scan(&m.ID, &m.Name, &m.FullName, &m.Description, &m.RepoURL, &m.LastUpdated, &m.SyncedAt, &m.ReadmeContent, &m.HasExamples, &m.ParentID, &m.Subpath); err != nil {
 			return nil, err
 		}
 		modules = append(modules, m)
@@ -223,7 +396,7 @@ func (db *DB) ListModules() ([]Module, error) {
 
 func (db *DB) SearchModules(query string, limit int) ([]Module, error) {
 	rows, err := db.conn.Query(`
-		SELECT m.id, m.name, m.full_name, m.description, m.repo_url, m.last_updated, m.synced_at, m.readme_content, m.has_examples
+		SELECT m.id, m.name, m.full_name, m.description, m.repo_url, m.last_updated, m.synced_at, m.readme_content, m.has_examples, IFNULL(m.parent_id, 0), IFNULL(m.subpath, '')
 		FROM modules m
 		JOIN modules_fts ON modules_fts.rowid = m.id
 		WHERE modules_fts MATCH ?
@@ -238,7 +411,7 @@ func (db *DB) SearchModules(query string, limit int) ([]Module, error) {
 	var modules []Module
 	for rows.Next() {
 		var m Module
-		if err := rows.Scan(&m.ID, &m.Name, &m.FullName, &m.Description, &m.RepoURL, &m.LastUpdated, &m.SyncedAt, &m.ReadmeContent, &m.HasExamples); err != nil {
+		if err := rows.Scan(&m.ID, &m.Name, &m.FullName, &m.Description, &m.RepoURL, &m.LastUpdated, &m.SyncedAt, &m.ReadmeContent, &m.HasExamples, &m.ParentID, &m.Subpath); err != nil {
 			return nil, err
 		}
 		modules = append(modules, m)
@@ -247,6 +420,168 @@ func (db *DB) SearchModules(query string, limit int) ([]Module, error) {
 	return modules, rows.Err()
 }
 
+// ModuleSignal is one piece of ranking evidence for a module: a matched alias,
+// tag or resource type and the weight or count behind it.
+type ModuleSignal struct {
+	ModuleID int64
+	Value    string
+	Weight   int
+}
+
+// ModuleTextScores scores modules against the FTS5 expression match with BM25,
+// weighting names over descriptions over READMEs. Higher scores are better.
+func (db *DB) ModuleTextScores(match string, limit int) (map[int64]float64, error) {
+	rows, err := db.conn.Query(`
+		SELECT rowid, -bm25(modules_fts, 10.0, 4.0, 1.0) AS score
+		FROM modules_fts
+		WHERE modules_fts MATCH ?
+		ORDER BY score DESC
+		LIMIT ?
+	`, match, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scores := make(map[int64]float64)
+	for rows.Next() {
+		var id int64
+		var score float64
+		if err := rows.Scan(&id, &score); err != nil {
+			return nil, err
+		}
+		scores[id] = score
+	}
+	return scores, rows.Err()
+}
+
+// ModuleTextMatch is a module found by full-text search, with the most heavily
+// weighted column the match hit: "name", "description" or "readme".
+type ModuleTextMatch struct {
+	ModuleID int64
+	Score    float64
+	Field    string
+}
+
+// ModuleTextMatches scores modules like ModuleTextScores and returns them best
+// first, each with the column the match hit.
+func (db *DB) ModuleTextMatches(match string, limit int) ([]ModuleTextMatch, error) {
+	rows, err := db.conn.Query(`
+		SELECT rowid, -bm25(modules_fts, 10.0, 4.0, 1.0) AS score,
+			CASE
+				WHEN rowid IN (SELECT rowid FROM modules_fts WHERE modules_fts MATCH 'name : (' || ?1 || ')') THEN 'name'
+				WHEN rowid IN (SELECT rowid FROM modules_fts WHERE modules_fts MATCH 'description : (' || ?1 || ')') THEN 'description'
+				ELSE 'readme'
+			END
+		FROM modules_fts
+		WHERE modules_fts MATCH ?1
+		ORDER BY score DESC
+		LIMIT ?2
+	`, match, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []ModuleTextMatch
+	for rows.Next() {
+		var m ModuleTextMatch
+		if err := rows.Scan(&m.ModuleID, &m.Score, &m.Field); err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// ModuleAliasSignals returns the aliases equal to any of terms.
+func (db *DB) ModuleAliasSignals(terms []string) ([]ModuleSignal, error) {
+	return db.moduleSignals(`SELECT module_id, alias, IFNULL(weight, 1) FROM module_aliases WHERE alias IN `, terms)
+}
+
+// ModuleTagSignals returns the tags equal to any of terms.
+func (db *DB) ModuleTagSignals(terms []string) ([]ModuleSignal, error) {
+	return db.moduleSignals(`SELECT module_id, tag, IFNULL(weight, 1) FROM module_tags WHERE tag IN `, terms)
+}
+
+// ListModuleAliases returns every alias with the parent of its module, which
+// is set for submodules.
+func (db *DB) ListModuleAliases() ([]ModuleAlias, error) {
+	rows, err := db.conn.Query(`
+		SELECT a.module_id, IFNULL(m.parent_id, 0), a.alias, IFNULL(a.weight, 1)
+		FROM module_aliases a
+		JOIN modules m ON m.id = a.module_id
+		ORDER BY a.alias
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var aliases []ModuleAlias
+	for rows.Next() {
+		var a ModuleAlias
+		if err := rows.Scan(&a.ModuleID, &a.ParentID, &a.Alias, &a.Weight); err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, a)
+	}
+	return aliases, rows.Err()
+}
+
+// ResourceTypeSignals returns, per module, the resource types a module's own
+// code declares that contain any of terms as a whole underscore-separated
+// word, with the number of resources of each type.
+func (db *DB) ResourceTypeSignals(terms []string) ([]ModuleSignal, error) {
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	conds := make([]string, len(terms))
+	args := make([]any, len(terms))
+	for i, t := range terms {
+		conds[i] = `('_' || resource_type || '_') LIKE ? ESCAPE '\'`
+		args[i] = `%\_` + escapeLike(t) + `\_%`
+	}
+	rows, err := db.conn.Query(`
+		SELECT module_id, resource_type, COUNT(*)
+		FROM module_resources
+		WHERE example_id IS NULL AND (`+strings.Join(conds, " OR ")+`)
+		GROUP BY module_id, resource_type
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanModuleSignals(rows)
+}
+
+func (db *DB) moduleSignals(query string, terms []string) ([]ModuleSignal, error) {
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(terms))
+	for i, t := range terms {
+		args[i] = t
+	}
+	rows, err := db.conn.Query(query+`(?`+strings.Repeat(`, ?`, len(terms)-1)+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanModuleSignals(rows)
+}
+
+func scanModuleSignals(rows *sql.Rows) ([]ModuleSignal, error) {
+	defer rows.Close()
+	var signals []ModuleSignal
+	for rows.Next() {
+		var sig ModuleSignal
+		if err := rows.Scan(&sig.ModuleID, &sig.Value, &sig.Weight); err != nil {
+			return nil, err
+		}
+		signals = append(signals, sig)
+	}
+	return signals, rows.Err()
+}
+
 func (db *DB) InsertFile(f *ModuleFile) error {
 	_, err := db.conn.Exec(`
 		INSERT INTO module_files (module_id, file_name, file_path, file_type, content, size_bytes)
@@ -283,17 +618,121 @@ func (db *DB) GetModuleFiles(moduleID int64) ([]ModuleFile, error) {
 	return files, rows.Err()
 }
 
-func (db *DB) SearchFiles(query string, limit int) ([]ModuleFile, error) {
+// FileFilter scopes file searches. ModuleIDs restricts the owning modules and
+// FileType the indexed file type (terraform, markdown, yaml, json). PathGlob
+// and ExcludePaths are globs over the file path; a glob without '/' matches the
+// file name in any directory, and '**' is accepted as an alias for '*'.
+//
+// BlockType, TypePrefix and HasAttrs keep files declaring at least one block
+// that satisfies all three, and a non-nil Files keeps only the listed files.
+type FileFilter struct {
+	ModuleIDs    []int64
+	PathGlob     string
+	FileType     string
+	ExcludePaths []string
+	BlockType    string
+	TypePrefix   string
+	HasAttrs     []string
+	Files        []FileRef
+}
+
+// FileRef identifies a module file.
+type FileRef struct {
+	ModuleID int64
+	FilePath string
+}
+
+func (f FileFilter) where() (string, []any) {
+	var where string
+	var args []any
+	if len(f.ModuleIDs) > 0 {
+		where += ` AND mf.module_id IN (?` + strings.Repeat(`, ?`, len(f.ModuleIDs)-1) + `)`
+		for _, id := range f.ModuleIDs {
+			args = append(args, id)
+		}
+	}
+	if f.FileType != "" {
+		where += ` AND mf.file_type = ?`
+		args = append(args, f.FileType)
+	}
+	if f.PathGlob != "" {
+		clause, globArgs := pathGlobClause(f.PathGlob)
+		where += ` AND ` + clause
+		args = append(args, globArgs...)
+	}
+	for _, p := range f.ExcludePaths {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		clause, globArgs := pathGlobClause(p)
+		where += ` AND NOT ` + clause
+		args = append(args, globArgs...)
+	}
+	if f.BlockType != "" || f.TypePrefix != "" || len(f.HasAttrs) > 0 {
+		where += ` AND EXISTS (SELECT 1 FROM hcl_blocks hb WHERE hb.module_id = mf.module_id AND hb.file_path = mf.file_path`
+		if f.BlockType != "" {
+			where += ` AND hb.block_type = ?`
+			args = append(args, f.BlockType)
+		}
+		if f.TypePrefix != "" {
+			where += ` AND hb.type_label LIKE ? ESCAPE '\'`
+			args = append(args, escapeLike(f.TypePrefix)+"%")
+		}
+		for _, attr := range f.HasAttrs {
+			where += ` AND instr(IFNULL(hb.attr_paths, ''), ?) > 0`
+			args = append(args, attr)
+		}
+		where += `)`
+	}
+	if f.Files != nil {
+		if len(f.Files) == 0 {
+			return where + ` AND 0`, args
+		}
+		where += ` AND (mf.module_id, mf.file_path) IN (VALUES (?, ?)` + strings.Repeat(`, (?, ?)`, len(f.Files)-1) + `)`
+		for _, ref := range f.Files {
+			args = append(args, ref.ModuleID, ref.FilePath)
+		}
+	}
+	return where, args
+}
+
+func pathGlobClause(pattern string) (string, []any) {
+	pattern = strings.ReplaceAll(strings.TrimPrefix(pattern, "./"), "**", "*")
+	if !strings.Contains(pattern, "/") {
+		return `(mf.file_path GLOB ? OR mf.file_path GLOB ?)`, []any{pattern, "*/" + pattern}
+	}
+	return `mf.file_path GLOB ?`, []any{pattern}
+}
+
+func (db *DB) SearchFiles(query string, filter FileFilter, offset, limit int) ([]ModuleFile, int, error) {
+	return db.SearchFilesFTS(escapeFTS5(query), filter, offset, limit)
+}
+
+// SearchFilesFTS returns one page of files matching the FTS5 expression match
+// within filter, best ranked first, along with the total number of matches.
+func (db *DB) SearchFilesFTS(match string, filter FileFilter, offset, limit int) ([]ModuleFile, int, error) {
+	where, args := filter.where()
+	args = append([]any{match}, args...)
+
+	var total int
+	if err := db.conn.QueryRow(`
+        SELECT COUNT(*)
+        FROM module_files mf
+        JOIN files_fts ON files_fts.rowid = mf.id
+        WHERE files_fts MATCH ?`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
 	rows, err := db.conn.Query(`
-		SELECT mf.id, mf.module_id, mf.file_name, mf.file_path, mf.file_type, mf.content, mf.size_bytes
-		FROM module_files mf
-		JOIN files_fts ON files_fts.rowid = mf.id
-		WHERE files_fts MATCH ?
-		ORDER BY rank
-		LIMIT ?
-	`, escapeFTS5(query), limit)
+        SELECT mf.id, mf.module_id, mf.file_name, mf.file_path, mf.file_type, mf.content, mf.size_bytes
+        FROM module_files mf
+        JOIN files_fts ON files_fts.rowid = mf.id
+        WHERE files_fts MATCH ?`+where+`
+        ORDER BY rank
+        LIMIT ? OFFSET ?
+    `, append(args, limit, offset)...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
@@ -301,37 +740,48 @@ func (db *DB) SearchFiles(query string, limit int) ([]ModuleFile, error) {
 	for rows.Next() {
 		var f ModuleFile
 		if err := rows.Scan(&f.ID, &f.ModuleID, &f.FileName, &f.FilePath, &f.FileType, &f.Content, &f.SizeBytes); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		files = append(files, f)
 	}
-
-	return files, rows.Err()
+	return files, total, rows.Err()
 }
 
-func (db *DB) SearchFilesFTS(match string, limit int) ([]ModuleFile, error) {
-	rows, err := db.conn.Query(`
+// ScanFiles streams files whose content matches the FTS5 expression match, or
+// every file when match is empty, to fn until it returns false.
+func (db *DB) ScanFiles(match string, filter FileFilter, fn func(ModuleFile) bool) error {
+	where, args := filter.where()
+	query := `
+        SELECT mf.id, mf.module_id, mf.file_name, mf.file_path, mf.file_type, mf.content, mf.size_bytes
+        FROM module_files mf
+        WHERE 1 = 1` + where + `
+        ORDER BY mf.module_id, mf.file_path`
+	if match != "" {
+		query = `
         SELECT mf.id, mf.module_id, mf.file_name, mf.file_path, mf.file_type, mf.content, mf.size_bytes
         FROM module_files mf
         JOIN files_fts ON files_fts.rowid = mf.id
-        WHERE files_fts MATCH ?
-        ORDER BY rank
-        LIMIT ?
-    `, match, limit)
+        WHERE files_fts MATCH ?` + where + `
+        ORDER BY rank`
+		args = append([]any{match}, args...)
+	}
+
+	rows, err := db.conn.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var files []ModuleFile
 	for rows.Next() {
 		var f ModuleFile
 		if err := rows.Scan(&f.ID, &f.ModuleID, &f.FileName, &f.FilePath, &f.FileType, &f.Content, &f.SizeBytes); err != nil {
-			return nil, err
+			return err
+		}
+		if !fn(f) {
+			break
 		}
-		files = append(files, f)
 	}
-	return files, rows.Err()
+	return rows.Err()
 }
 
 func (db *DB) GetFile(moduleName string, filePath string) (*ModuleFile, error) {
@@ -350,17 +800,25 @@ func (db *DB) GetFile(moduleName string, filePath string) (*ModuleFile, error) {
 
 func (db *DB) InsertVariable(v *ModuleVariable) error {
 	_, err := db.conn.Exec(`
-		INSERT INTO module_variables (module_id, name, type, description, default_value, required, sensitive)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
-	`, v.ModuleID, v.Name, v.Type, v.Description, v.DefaultValue, v.Required, v.Sensitive)
+		INSERT INTO module_variables (module_id, name, type, description, default_value, required, sensitive, example_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, v.ModuleID, v.Name, v.Type, v.Description, v.DefaultValue, v.Required, v.Sensitive, nullIfZero(v.ExampleID))
 	return err
 }
 
+// GetModuleVariables returns the module's input variables, excluding those declared by its examples.
 func (db *DB) GetModuleVariables(moduleID int64) ([]ModuleVariable, error) {
+	return db.queryVariables(`WHERE module_id = ? AND example_id IS NULL`, moduleID)
+}
+
+func (db *DB) GetExampleVariables(exampleID int64) ([]ModuleVariable, error) {
+	return db.queryVariables(`WHERE example_id = ?`, exampleID)
+}
+
+func (db *DB) queryVariables(where string, args ...any) ([]ModuleVariable, error) {
 	rows, err := db.conn.Query(`
-		SELECT id, module_id, name, type, description, default_value, required, sensitive
-		FROM module_variables WHERE module_id = ?
-	`, moduleID)
+		SELECT id, module_id, name, type, description, default_value, required, sensitive, IFNULL(example_id, 0)
+		FROM module_variables `+where, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -369,7 +827,7 @@ func (db *DB) GetModuleVariables(moduleID int64) ([]ModuleVariable, error) {
 	var vars []ModuleVariable
 	for rows.Next() {
 		var v ModuleVariable
-		if err := rows.Scan(&v.ID, &v.ModuleID, &v.Name, &v.Type, &v.Description, &v.DefaultValue, &v.Required, &v.Sensitive); err != nil {
+		if err := rows.Scan(&v.ID, &v.ModuleID, &v.Name, &v.Type, &v.Description, &v.DefaultValue, &v.Required, &v.Sensitive, &v.ExampleID); err != nil {
 			return nil, err
 		}
 		vars = append(vars, v)
@@ -380,16 +838,17 @@ func (db *DB) GetModuleVariables(moduleID int64) ([]ModuleVariable, error) {
 
 func (db *DB) InsertOutput(o *ModuleOutput) error {
 	_, err := db.conn.Exec(`
-		INSERT INTO module_outputs (module_id, name, description, value, sensitive)
-		VALUES (?, ?, ?, ?, ?)
-	`, o.ModuleID, o.Name, o.Description, o.Value, o.Sensitive)
+		INSERT INTO module_outputs (module_id, name, description, value, sensitive, example_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, o.ModuleID, o.Name, o.Description, o.Value, o.Sensitive, nullIfZero(o.ExampleID))
 	return err
 }
 
+// GetModuleOutputs returns the module's outputs, excluding those declared by its examples.
 func (db *DB) GetModuleOutputs(moduleID int64) ([]ModuleOutput, error) {
 	rows, err := db.conn.Query(`
-		SELECT id, module_id, name, description, value, sensitive
-		FROM module_outputs WHERE module_id = ?
+		SELECT id, module_id, name, description, value, sensitive, IFNULL(example_id, 0)
+		FROM module_outputs WHERE module_id = ? AND example_id IS NULL
 	`, moduleID)
 	if err != nil {
 		return nil, err
@@ -399,7 +858,7 @@ func (db *DB) GetModuleOutputs(moduleID int64) ([]ModuleOutput, error) {
 	var outputs []ModuleOutput
 	for rows.Next() {
 		var o ModuleOutput
-		if err := rows.Scan(&o.ID, &o.ModuleID, &o.Name, &o.Description, &o.Value, &o.Sensitive); err != nil {
+		if err := rows.Scan(&o.ID, &o.ModuleID, &o.Name, &o.Description, &o.Value, &o.Sensitive, &o.ExampleID); err != nil {
 			return nil, err
 		}
 		outputs = append(outputs, o)
@@ -410,17 +869,25 @@ func (db *DB) GetModuleOutputs(moduleID int64) ([]ModuleOutput, error) {
 
 func (db *DB) InsertResource(r *ModuleResource) error {
 	_, err := db.conn.Exec(`
-		INSERT INTO module_resources (module_id, resource_type, resource_name, provider, source_file)
-		VALUES (?, ?, ?, ?, ?)
-	`, r.ModuleID, r.ResourceType, r.ResourceName, r.Provider, r.SourceFile)
+		INSERT INTO module_resources (module_id, resource_type, resource_name, provider, source_file, example_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, r.ModuleID, r.ResourceType, r.ResourceName, r.Provider, r.SourceFile, nullIfZero(r.ExampleID))
 	return err
 }
 
+// GetModuleResources returns the module's resources, excluding those declared by its examples.
 func (db *DB) GetModuleResources(moduleID int64) ([]ModuleResource, error) {
+	return db.queryResources(`WHERE module_id = ? AND example_id IS NULL`, moduleID)
+}
+
+func (db *DB) GetExampleResources(exampleID int64) ([]ModuleResource, error) {
+	return db.queryResources(`WHERE example_id = ?`, exampleID)
+}
+
+func (db *DB) queryResources(where string, args ...any) ([]ModuleResource, error) {
 	rows, err := db.conn.Query(`
-		SELECT id, module_id, resource_type, resource_name, provider, source_file
-		FROM module_resources WHERE module_id = ?
-	`, moduleID)
+		SELECT id, module_id, resource_type, resource_name, provider, source_file, IFNULL(example_id, 0)
+		FROM module_resources `+where, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -429,7 +896,7 @@ func (db *DB) GetModuleResources(moduleID int64) ([]ModuleResource, error) {
 	var resources []ModuleResource
 	for rows.Next() {
 		var r ModuleResource
-		if err := rows.Scan(&r.ID, &r.ModuleID, &r.ResourceType, &r.ResourceName, &r.Provider, &r.SourceFile); err != nil {
+		if err := rows.Scan(&r.ID, &r.ModuleID, &r.ResourceType, &r.ResourceName, &r.Provider, &r.SourceFile, &r.ExampleID); err != nil {
 			return nil, err
 		}
 		resources = append(resources, r)
@@ -440,16 +907,17 @@ func (db *DB) GetModuleResources(moduleID int64) ([]ModuleResource, error) {
 
 func (db *DB) InsertDataSource(d *ModuleDataSource) error {
 	_, err := db.conn.Exec(`
-		INSERT INTO module_data_sources (module_id, data_type, data_name, provider, source_file)
-		VALUES (?, ?, ?, ?, ?)
-	`, d.ModuleID, d.DataType, d.DataName, d.Provider, d.SourceFile)
+		INSERT INTO module_data_sources (module_id, data_type, data_name, provider, source_file, example_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, d.ModuleID, d.DataType, d.DataName, d.Provider, d.SourceFile, nullIfZero(d.ExampleID))
 	return err
 }
 
+// GetModuleDataSources returns the module's data sources, excluding those declared by its examples.
 func (db *DB) GetModuleDataSources(moduleID int64) ([]ModuleDataSource, error) {
 	rows, err := db.conn.Query(`
-		SELECT id, module_id, data_type, data_name, provider, source_file
-		FROM module_data_sources WHERE module_id = ?
+		SELECT id, module_id, data_type, data_name, provider, source_file, IFNULL(example_id, 0)
+		FROM module_data_sources WHERE module_id = ? AND example_id IS NULL
 	`, moduleID)
 	if err != nil {
 		return nil, err
@@ -459,7 +927,7 @@ func (db *DB) GetModuleDataSources(moduleID int64) ([]ModuleDataSource, error) {
 	var dataSources []ModuleDataSource
 	for rows.Next() {
 		var d ModuleDataSource
-		if err := rows.Scan(&d.ID, &d.ModuleID, &d.DataType, &d.DataName, &d.Provider, &d.SourceFile); err != nil {
+		if err := rows.Scan(&d.ID, &d.ModuleID, &d.DataType, &d.DataName, &d.Provider, &d.SourceFile, &d.ExampleID); err != nil {
 			return nil, err
 		}
 		dataSources = append(dataSources, d)
@@ -468,58 +936,306 @@ func (db *DB) GetModuleDataSources(moduleID int64) ([]ModuleDataSource, error) {
 	return dataSources, rows.Err()
 }
 
-func (db *DB) InsertExample(e *ModuleExample) error {
-	_, err := db.conn.Exec(`
-		INSERT INTO module_examples (module_id, name, path, content)
-		VALUES (?, ?, ?, ?)
-	`, e.ModuleID, e.Name, e.Path, e.Content)
-	return err
+// TypeDeclaration is a resource or data source found by type across modules.
+// File is relative to the module root, so example code includes the example
+// path.
+type TypeDeclaration struct {
+	ModuleID   int64
+	ModuleName string
+	Type       string
+	Name       string
+	File       string
+	Example    string
 }
 
-func (db *DB) GetModuleExamples(moduleID int64) ([]ModuleExample, error) {
-	rows, err := db.conn.Query(`
-		SELECT id, module_id, name, path, content
-		FROM module_examples WHERE module_id = ?
-	`, moduleID)
+// TypeCoverage summarizes how the catalog uses one resource or data source type.
+type TypeCoverage struct {
+	Type    string
+	Count   int
+	Modules []string
+}
+
+// typeTable returns the table and columns holding declarations of kind
+// ("resource" or "data").
+func typeTable(kind string) (table, typeColumn, nameColumn string, err error) {
+	switch kind {
+	case "resource":
+		return "module_resources", "resource_type", "resource_name", nil
+	case "data":
+		return "module_data_sources", "data_type", "data_name", nil
+	}
+	return "", "", "", fmt.Errorf("unknown declaration kind %q", kind)
+}
+
+// FindDeclarationsByType returns the resources or data sources whose type
+// matches the GLOB pattern, ordered by type, module and name. Declarations in
+// examples are left out unless includeExamples is set.
+func (db *DB) FindDeclarationsByType(kind, pattern string, includeExamples bool) ([]TypeDeclaration, error) {
+	table, typeColumn, nameColumn, err := typeTable(kind)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf(`
+		SELECT d.module_id, m.name, d.%[2]s, d.%[3]s, IFNULL(d.source_file, ''), IFNULL(e.name, ''), IFNULL(e.path, '')
+		FROM %[1]s d
+		JOIN modules m ON m.id = d.module_id
+		LEFT JOIN module_examples e ON e.id = d.example_id
+		WHERE d.%[2]s GLOB ?`, table, typeColumn, nameColumn)
+	if !includeExamples {
+		query += ` AND d.example_id IS NULL`
+	}
+	query += fmt.Sprintf(` ORDER BY d.%[1]s, m.name, d.example_id IS NOT NULL, e.name, d.%[2]s`, typeColumn, nameColumn)
+
+	rows, err := db.conn.Query(query, pattern)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var examples []ModuleExample
+	var decls []TypeDeclaration
 	for rows.Next() {
-		var e ModuleExample
-		if err := rows.Scan(&e.ID, &e.ModuleID, &e.Name, &e.Path, &e.Content); err != nil {
+		var d TypeDeclaration
+		var examplePath string
+		if err := rows.Scan(&d.ModuleID, &d.ModuleName, &d.Type, &d.Name, &d.File, &d.Example, &examplePath); err != nil {
 			return nil, err
 		}
-		examples = append(examples, e)
+		if examplePath != "" {
+			d.File = examplePath + "/" + d.File
+		}
+		decls = append(decls, d)
 	}
-
-	return examples, rows.Err()
+	return decls, rows.Err()
 }
 
-func (db *DB) ClearModuleData(moduleID int64) error {
-	tx, err := db.conn.Begin()
+// TypeInventory lists every resource or data source type matching the GLOB
+// pattern with the number of declarations and the modules declaring it, most
+// widely used first.
+func (db *DB) TypeInventory(kind, pattern string, includeExamples bool) ([]TypeCoverage, error) {
+	table, typeColumn, _, err := typeTable(kind)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer tx.Rollback()
-
-	tables := []string{
-		"module_files",
-		"module_variables",
-		"module_outputs",
-		"module_resources",
-		"module_data_sources",
-		"module_examples",
-		"hcl_blocks",
-		"hcl_relationships",
+	query := fmt.Sprintf(`
+		SELECT d.%[2]s, COUNT(*), GROUP_CONCAT(DISTINCT m.name)
+		FROM %[1]s d
+		JOIN modules m ON m.id = d.module_id
+		WHERE d.%[2]s GLOB ?`, table, typeColumn)
+	if !includeExamples {
+		query += ` AND d.example_id IS NULL`
 	}
+	query += fmt.Sprintf(` GROUP BY d.%[1]s ORDER BY COUNT(DISTINCT d.module_id) DESC, d.%[1]s`, typeColumn)
 
-	for _, table := range tables {
-		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE module_id = ?", table), moduleID); err != nil {
-			return err
-		}
+	rows, err := db.conn.Query(query, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var inventory []TypeCoverage
+	for rows.Next() {
+		var c TypeCoverage
+		var modules string
+		if err := rows.Scan(&c.Type, &c.Count, &modules); err != nil {
+			return nil, err
+		}
+		c.Modules = strings.Split(modules, ",")
+		inventory = append(inventory, c)
+	}
+	return inventory, rows.Err()
+}
+
+func (db *DB) InsertExample(e *ModuleExample) (int64, error) {
+	res, err := db.conn.Exec(`
+		INSERT INTO module_examples (module_id, name, path, content)
+		VALUES (?, ?, ?, ?)
+	`, e.ModuleID, e.Name, e.Path, e.Content)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// ListExamples returns the examples of every module, grouped by module.
+func (db *DB) ListExamples() ([]ModuleExample, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, module_id, name, path, content
+		FROM module_examples
+		ORDER BY module_id, name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var examples []ModuleExample
+	for rows.Next() {
+		var e ModuleExample
+		if err := rows.Scan(&e.ID, &e.ModuleID, &e.Name, &e.Path, &e.Content); err != nil {
+			return nil, err
+		}
+		examples = append(examples, e)
+	}
+
+	return examples, rows.Err()
+}
+
+func (db *DB) GetModuleExamples(moduleID int64) ([]ModuleExample, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, module_id, name, path, content
+		FROM module_examples WHERE module_id = ?
+		ORDER BY name
+	`, moduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var examples []ModuleExample
+	for rows.Next() {
+		var e ModuleExample
+		if err := rows.Scan(&e.ID, &e.ModuleID, &e.Name, &e.Path, &e.Content); err != nil {
+			return nil, err
+		}
+		examples = append(examples, e)
+	}
+
+	return examples, rows.Err()
+}
+
+func (db *DB) InsertCondition(c *ModuleCondition) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO module_conditions (module_id, kind, owner_type, owner_name, condition, error_message, source_file)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, c.ModuleID, c.Kind, c.OwnerType, c.OwnerName, c.Condition, c.ErrorMessage, c.SourceFile)
+	return err
+}
+
+func (db *DB) GetModuleConditions(moduleID int64) ([]ModuleCondition, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, module_id, kind, owner_type, owner_name, condition, IFNULL(error_message, ''), IFNULL(source_file, '')
+		FROM module_conditions WHERE module_id = ?
+		ORDER BY owner_type, owner_name, id
+	`, moduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanConditions(rows)
+}
+
+// SearchConditions matches validation and pre/postcondition rules across all modules.
+// An empty kind matches every rule kind.
+func (db *DB) SearchConditions(query, kind string, limit int) ([]ModuleCondition, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+
+	rows, err := db.conn.Query(`
+		SELECT c.id, c.module_id, c.kind, c.owner_type, c.owner_name, c.condition, IFNULL(c.error_message, ''), IFNULL(c.source_file, '')
+		FROM module_conditions c
+		JOIN conditions_fts ON conditions_fts.rowid = c.id
+		WHERE conditions_fts MATCH ?
+		  AND (? = '' OR c.kind = ?)
+		ORDER BY rank
+		LIMIT ?
+	`, escapeFTS5(query), kind, kind, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanConditions(rows)
+}
+
+func scanConditions(rows *sql.Rows) ([]ModuleCondition, error) {
+	var conditions []ModuleCondition
+	for rows.Next() {
+		var c ModuleCondition
+		if err := rows.Scan(&c.ID, &c.ModuleID, &c.Kind, &c.OwnerType, &c.OwnerName, &c.Condition, &c.ErrorMessage, &c.SourceFile); err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, c)
+	}
+	return conditions, rows.Err()
+}
+
+func (db *DB) InsertMigration(m *ModuleMigration) error {
+	_, err := db.conn.Exec(`
+		INSERT INTO module_migrations (module_id, kind, from_address, to_address, import_id, destroy, source_file)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, m.ModuleID, m.Kind, nullIfEmpty(m.FromAddress), nullIfEmpty(m.ToAddress), nullIfEmpty(m.ImportID), m.Destroy, m.SourceFile)
+	return err
+}
+
+func (db *DB) GetModuleMigrations(moduleID int64) ([]ModuleMigration, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, module_id, kind, IFNULL(from_address, ''), IFNULL(to_address, ''), IFNULL(import_id, ''), destroy, IFNULL(source_file, '')
+		FROM module_migrations WHERE module_id = ?
+		ORDER BY source_file, id
+	`, moduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanMigrations(rows)
+}
+
+// ListMigrations returns moved, import and removed blocks for every module,
+// ordered by module so callers can group them.
+func (db *DB) ListMigrations() ([]ModuleMigration, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, module_id, kind, IFNULL(from_address, ''), IFNULL(to_address, ''), IFNULL(import_id, ''), destroy, IFNULL(source_file, '')
+		FROM module_migrations
+		ORDER BY module_id, source_file, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanMigrations(rows)
+}
+
+func scanMigrations(rows *sql.Rows) ([]ModuleMigration, error) {
+	var migrations []ModuleMigration
+	for rows.Next() {
+		var m ModuleMigration
+		if err := rows.Scan(&m.ID, &m.ModuleID, &m.Kind, &m.FromAddress, &m.ToAddress, &m.ImportID, &m.Destroy, &m.SourceFile); err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, m)
+	}
+	return migrations, rows.Err()
+}
+
+func (db *DB) ClearModuleData(moduleID int64) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tables := []string{
+		"module_files",
+		"module_variables",
+		"module_outputs",
+		"module_resources",
+		"module_data_sources",
+		"module_examples",
+		"module_conditions",
+		"module_migrations",
+		"hcl_attributes",
+		"hcl_blocks",
+		"hcl_relationships",
+		"module_embeddings",
+	}
+
+	for _, table := range tables {
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE module_id = ?", table), moduleID); err != nil {
+			return err
+		}
 	}
 
 	return tx.Commit()
@@ -530,12 +1246,52 @@ func (db *DB) DeleteModuleByID(moduleID int64) error {
 	return err
 }
 
-func (db *DB) DeleteChildModules(parentName string) error {
-	pattern := parentName + "//%"
-	_, err := db.conn.Exec(`DELETE FROM modules WHERE name LIKE ? ESCAPE '\'`, pattern)
+func (db *DB) DeleteChildModules(parentID int64) error {
+	_, err := db.conn.Exec(`DELETE FROM modules WHERE parent_id = ?`, parentID)
 	return err
 }
 
+// GetSubmodules returns the submodules of a repository root module.
+func (db *DB) GetSubmodules(parentID int64) ([]Module, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, name, full_name, description, repo_url, last_updated, synced_at, readme_content, has_examples, IFNULL(parent_id, 0), IFNULL(subpath, '')
+		FROM modules WHERE parent_id = ? ORDER BY name
+	`, parentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var modules []Module
+	for rows.Next() {
+		var m Module
+		if err := rows.Scan(&m.ID, &m.Name, &m.FullName, &m.Description, &m.RepoURL, &m.LastUpdated, &m.SyncedAt, &m.ReadmeContent, &m.HasExamples, &m.ParentID, &m.Subpath); err != nil {
+			return nil, err
+		}
+		modules = append(modules, m)
+	}
+
+	return modules, rows.Err()
+}
+
+// GetSubmodule finds a submodule of parentID by its directory name ("sub") or
+// path ("modules/sub").
+func (db *DB) GetSubmodule(parentID int64, sub string) (*Module, error) {
+	sub = strings.Trim(sub, "/")
+	if !strings.Contains(sub, "/") {
+		sub = "modules/" + sub
+	}
+	var m Module
+	err := db.conn.QueryRow(`
+		SELECT id, name, full_name, description, repo_url, last_updated, synced_at, readme_content, has_examples, IFNULL(parent_id, 0), IFNULL(subpath, '')
+		FROM modules WHERE parent_id = ? AND subpath = ?
+	`, parentID, sub).Scan(&m.ID, &m.Name, &m.FullName, &m.Description, &m.RepoURL, &m.LastUpdated, &m.SyncedAt, &m.ReadmeContent, &m.HasExamples, &m.ParentID, &m.Subpath)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
 func (db *DB) SetModuleHasExamples(moduleID int64, hasExamples bool) error {
 	_, err := db.conn.Exec(`
         UPDATE modules
@@ -545,11 +1301,15 @@ func (db *DB) SetModuleHasExamples(moduleID int64, hasExamples bool) error {
 	return err
 }
 
-func (db *DB) InsertHCLBlock(moduleID int64, filePath, blockType, typeLabel string, startByte, endByte int, attrPaths string) (int64, error) {
+func (db *DB) InsertHCLBlock(moduleID, parentID, exampleID int64, filePath, blockType, typeLabel, labels string, startByte, endByte int, attrPaths string) (int64, error) {
+	var parent any
+	if parentID > 0 {
+		parent = parentID
+	}
 	res, err := db.conn.Exec(`
-        INSERT INTO hcl_blocks (module_id, file_path, block_type, type_label, start_byte, end_byte, attr_paths)
-        VALUES (?, ?, ?, ?, ?, ?, ?)
-    `, moduleID, filePath, blockType, nullIfEmpty(typeLabel), startByte, endByte, nullIfEmpty(attrPaths))
+        INSERT INTO hcl_blocks (module_id, parent_id, example_id, file_path, block_type, type_label, labels, start_byte, end_byte, attr_paths)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `, moduleID, parent, nullIfZero(exampleID), filePath, blockType, nullIfEmpty(typeLabel), nullIfEmpty(labels), startByte, endByte, nullIfEmpty(attrPaths))
 	if err != nil {
 		return 0, err
 	}
@@ -560,40 +1320,113 @@ func (db *DB) InsertHCLBlock(moduleID int64, filePath, blockType, typeLabel stri
 	return id, nil
 }
 
+const hclBlockColumns = `id, module_id, parent_id, file_path, block_type, type_label, labels, start_byte, end_byte, attr_paths`
+
 // QueryHCLBlocks finds blocks by type and optional label match.
-// If prefix is true, matches rows where type_label starts with the given value.
-func (db *DB) QueryHCLBlocks(blockType, typeLabel string, prefix bool) ([]HCLBlock, error) {
-	var rows *sql.Rows
-	var err error
-	if blockType == "lifecycle" {
-		rows, err = db.conn.Query(`
-            SELECT id, module_id, file_path, block_type, type_label, start_byte, end_byte, attr_paths
-            FROM hcl_blocks
-            WHERE block_type = 'lifecycle'
-        `)
-	} else if prefix {
-		like := typeLabel + "%"
-		rows, err = db.conn.Query(`
-            SELECT id, module_id, file_path, block_type, type_label, start_byte, end_byte, attr_paths
-            FROM hcl_blocks
-            WHERE block_type = ? AND type_label LIKE ?
-        `, blockType, like)
-	} else {
-		rows, err = db.conn.Query(`
-            SELECT id, module_id, file_path, block_type, type_label, start_byte, end_byte, attr_paths
-            FROM hcl_blocks
-            WHERE block_type = ? AND type_label = ?
-        `, blockType, typeLabel)
+// The first label is compared against type_label; when more labels are given the
+// full label set is compared against labels. If prefix is true the last given
+// label only needs to be a prefix. A '*' in a label acts as a wildcard.
+func (db *DB) QueryHCLBlocks(blockType string, labels []string, prefix bool) ([]HCLBlock, error) {
+	query := `SELECT ` + hclBlockColumns + ` FROM hcl_blocks WHERE block_type = ?`
+	args := []any{blockType}
+
+	if len(labels) > 0 {
+		column := "type_label"
+		want := labels[0]
+		if len(labels) > 1 {
+			column = "labels"
+			want = strings.Join(labels, ".")
+		}
+		if !prefix && !strings.Contains(want, "*") {
+			query += ` AND ` + column + ` = ?`
+			args = append(args, want)
+		} else {
+			pattern := strings.ReplaceAll(escapeLike(want), "*", "%")
+			if prefix {
+				pattern += "%"
+			}
+			query += ` AND ` + column + ` LIKE ? ESCAPE '\'`
+			args = append(args, pattern)
+		}
 	}
+
+	query += ` ORDER BY module_id, file_path, start_byte`
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanHCLBlocks(rows)
+}
+
+// HasHCLBlockType reports whether any indexed block has blockType.
+func (db *DB) HasHCLBlockType(blockType string) (bool, error) {
+	var found bool
+	err := db.conn.QueryRow(`SELECT EXISTS(SELECT 1 FROM hcl_blocks WHERE block_type = ?)`, blockType).Scan(&found)
+	return found, err
+}
+
+func (db *DB) GetHCLBlock(id int64) (*HCLBlock, error) {
+	rows, err := db.conn.Query(`SELECT `+hclBlockColumns+` FROM hcl_blocks WHERE id = ?`, id)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	blocks, err := scanHCLBlocks(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(blocks) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &blocks[0], nil
+}
+
+// GetModuleBlocks returns the top-level blocks of a module's own code,
+// excluding examples.
+func (db *DB) GetModuleBlocks(moduleID int64) ([]HCLBlock, error) {
+	rows, err := db.conn.Query(`SELECT `+hclBlockColumns+` FROM hcl_blocks
+        WHERE module_id = ? AND example_id IS NULL AND parent_id IS NULL
+        ORDER BY file_path, start_byte`, moduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanHCLBlocks(rows)
+}
+
+// GetFileBlocks returns the top-level blocks of one file in source order.
+func (db *DB) GetFileBlocks(moduleID int64, filePath string) ([]HCLBlock, error) {
+	rows, err := db.conn.Query(`SELECT `+hclBlockColumns+` FROM hcl_blocks
+        WHERE module_id = ? AND file_path = ? AND parent_id IS NULL
+        ORDER BY start_byte`, moduleID, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanHCLBlocks(rows)
+}
+
+// GetExampleBlocks returns the top-level blocks of one type declared by an example.
+func (db *DB) GetExampleBlocks(exampleID int64, blockType string) ([]HCLBlock, error) {
+	rows, err := db.conn.Query(`SELECT `+hclBlockColumns+` FROM hcl_blocks
+        WHERE example_id = ? AND block_type = ? AND parent_id IS NULL
+        ORDER BY file_path, start_byte`, exampleID, blockType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanHCLBlocks(rows)
+}
+
+func scanHCLBlocks(rows *sql.Rows) ([]HCLBlock, error) {
 	var out []HCLBlock
 	for rows.Next() {
 		var b HCLBlock
-		if err := rows.Scan(&b.ID, &b.ModuleID, &b.FilePath, &b.BlockType, &b.TypeLabel, &b.StartByte, &b.EndByte, &b.AttrPaths); err != nil {
+		if err := rows.Scan(&b.ID, &b.ModuleID, &b.ParentID, &b.FilePath, &b.BlockType, &b.TypeLabel, &b.Labels, &b.StartByte, &b.EndByte, &b.AttrPaths); err != nil {
 			return nil, err
 		}
 		out = append(out, b)
@@ -601,33 +1434,98 @@ func (db *DB) QueryHCLBlocks(blockType, typeLabel string, prefix bool) ([]HCLBlo
 	return out, rows.Err()
 }
 
-func (db *DB) InsertRelationship(r *HCLRelationship) error {
+func (db *DB) InsertHCLAttribute(a *HCLAttribute) error {
 	_, err := db.conn.Exec(`
-        INSERT INTO hcl_relationships (
-            module_id,
-            file_path,
-            block_type,
-            block_labels,
-            attribute_path,
-            reference_type,
-            reference_name,
-            start_byte,
-            end_byte
-        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-    `, r.ModuleID, r.FilePath, r.BlockType, nullIfEmpty(r.BlockLabels), r.AttributePath, r.ReferenceType, r.ReferenceName, r.StartByte, r.EndByte)
+        INSERT INTO hcl_attributes (module_id, block_id, example_id, file_path, root_type, root_label, attribute_path, value, expression, start_byte, end_byte)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `, a.ModuleID, a.BlockID, nullIfZero(a.ExampleID), a.FilePath, a.RootType, nullIfEmpty(a.RootLabel), a.AttributePath, a.Value, a.Expression, a.StartByte, a.EndByte)
 	return err
 }
 
-func (db *DB) QueryRelationships(moduleID int64, term string, limit int) ([]HCLRelationship, error) {
-	if limit <= 0 {
-		limit = 20
+// AggregateAttributeValues groups indexed attribute values by their literal value
+// (or normalized expression for non-literals) and counts occurrences and modules.
+func (db *DB) AggregateAttributeValues(f AttributeValueFilter) ([]AttributeValueCount, error) {
+	if f.Limit <= 0 {
+		f.Limit = 50
 	}
 
-	likeTerm := "%" + strings.ToLower(term) + "%"
+	query := `
+        SELECT COALESCE(a.value, a.expression) AS v,
+               MAX(a.value IS NOT NULL) AS literal,
+               COUNT(*) AS occurrences,
+               COUNT(DISTINCT a.module_id) AS module_count,
+               GROUP_CONCAT(DISTINCT m.name) AS module_names
+        FROM hcl_attributes a
+        JOIN modules m ON m.id = a.module_id
+        WHERE 1 = 1`
+	var args []any
+
+	if f.AttributePath != "" {
+		if strings.Contains(f.AttributePath, "*") {
+			query += ` AND a.attribute_path GLOB ?`
+		} else {
+			query += ` AND a.attribute_path = ?`
+		}
+		args = append(args, f.AttributePath)
+	}
+	if f.RootType != "" {
+		query += ` AND a.root_type = ?`
+		args = append(args, f.RootType)
+	}
+	if f.TypePrefix != "" {
+		query += ` AND a.root_label >= ? AND a.root_label < ?`
+		args = append(args, f.TypePrefix, f.TypePrefix+"\uffff")
+	}
+	if !f.IncludeExamples {
+		query += ` AND a.example_id IS NULL`
+	}
+	if f.ModuleID != 0 {
+		query += ` AND a.module_id = ?`
+		args = append(args, f.ModuleID)
+	}
+	if f.Value != "" {
+		query += ` AND a.value = ?`
+		args = append(args, f.Value)
+	}
+	if f.ValuePrefix != "" {
+		query += ` AND a.value >= ? AND a.value < ?`
+		args = append(args, f.ValuePrefix, f.ValuePrefix+"\uffff")
+	}
+	if f.ExcludeValue != "" {
+		query += ` AND COALESCE(a.value, a.expression) != ?`
+		args = append(args, f.ExcludeValue)
+	}
 
-	rows, err := db.conn.Query(`
-        SELECT
-            id,
+	query += `
+        GROUP BY v
+        ORDER BY occurrences DESC, v ASC
+        LIMIT ?`
+	args = append(args, f.Limit)
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []AttributeValueCount
+	for rows.Next() {
+		var c AttributeValueCount
+		var names sql.NullString
+		if err := rows.Scan(&c.Value, &c.Literal, &c.Occurrences, &c.ModuleCount, &names); err != nil {
+			return nil, err
+		}
+		if names.Valid && names.String != "" {
+			c.Modules = strings.Split(names.String, ",")
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+func (db *DB) InsertRelationship(r *HCLRelationship) error {
+	_, err := db.conn.Exec(`
+        INSERT INTO hcl_relationships (
             module_id,
             file_path,
             block_type,
@@ -635,19 +1533,24 @@ func (db *DB) QueryRelationships(moduleID int64, term string, limit int) ([]HCLR
             attribute_path,
             reference_type,
             reference_name,
+            iterator_source,
             start_byte,
-            end_byte
+            end_byte,
+            example_id
+        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+    `, r.ModuleID, r.FilePath, r.BlockType, nullIfEmpty(r.BlockLabels), r.AttributePath, r.ReferenceType, r.ReferenceName, nullIfEmpty(r.IteratorSource), r.StartByte, r.EndByte, nullIfZero(r.ExampleID))
+	return err
+}
+
+// GetModuleRelationships returns every reference recorded for a module's own
+// code, leaving out its examples.
+func (db *DB) GetModuleRelationships(moduleID int64) ([]HCLRelationship, error) {
+	rows, err := db.conn.Query(`
+        SELECT id, module_id, file_path, block_type, block_labels, attribute_path, reference_type, reference_name, IFNULL(iterator_source, ''), start_byte, end_byte
         FROM hcl_relationships
-        WHERE module_id = ?
-          AND (
-                LOWER(attribute_path) LIKE ?
-             OR LOWER(reference_name) LIKE ?
-             OR LOWER(IFNULL(block_labels, '')) LIKE ?
-             OR LOWER(block_type) LIKE ?
-          )
+        WHERE module_id = ? AND example_id IS NULL
         ORDER BY file_path, start_byte
-        LIMIT ?
-    `, moduleID, likeTerm, likeTerm, likeTerm, likeTerm, limit)
+    `, moduleID)
 	if err != nil {
 		return nil, err
 	}
@@ -657,57 +1560,116 @@ func (db *DB) QueryRelationships(moduleID int64, term string, limit int) ([]HCLR
 	for rows.Next() {
 		var rel HCLRelationship
 		var blockLabels sql.NullString
-		if err := rows.Scan(
-			&rel.ID,
-			&rel.ModuleID,
-			&rel.FilePath,
-			&rel.BlockType,
-			&blockLabels,
-			&rel.AttributePath,
-			&rel.ReferenceType,
-			&rel.ReferenceName,
-			&rel.StartByte,
-			&rel.EndByte,
-		); err != nil {
+		if err := rows.Scan(&rel.ID, &rel.ModuleID, &rel.FilePath, &rel.BlockType, &blockLabels, &rel.AttributePath, &rel.ReferenceType, &rel.ReferenceName, &rel.IteratorSource, &rel.StartByte, &rel.EndByte); err != nil {
 			return nil, err
 		}
-		if blockLabels.Valid {
-			rel.BlockLabels = blockLabels.String
-		}
+		rel.BlockLabels = blockLabels.String
 		results = append(results, rel)
 	}
 
 	return results, rows.Err()
 }
 
-func (db *DB) QueryRelationshipsAny(term string, limit int) ([]HCLRelationship, error) {
-	if limit <= 0 {
-		limit = 20
+// SearchRelationships returns one page of relationships matching f, best
+// matches first, together with the total number of matches.
+func (db *DB) SearchRelationships(f RelationshipFilter) ([]HCLRelationship, int, error) {
+	if f.Limit <= 0 {
+		f.Limit = 20
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
 	}
 
-	likeTerm := "%" + strings.ToLower(term) + "%"
+	term := strings.ToLower(strings.TrimSpace(f.Term))
+	where := ` WHERE 1 = 1`
+	var args []any
 
-	rows, err := db.conn.Query(`
-	        SELECT
-	            id,
-	            module_id,
-	            file_path,
-	            block_type,
-	            block_labels,
-	            attribute_path,
-	            reference_type,
-	            reference_name,
-	            start_byte,
-	            end_byte
-	        FROM hcl_relationships
-	        WHERE
-	              LOWER(attribute_path) LIKE ?
-	           OR LOWER(reference_name) LIKE ?
-	        ORDER BY module_id, file_path, start_byte
-	        LIMIT ?
-	    `, likeTerm, likeTerm, limit)
+	if f.ModuleID != 0 {
+		where += ` AND module_id = ?`
+		args = append(args, f.ModuleID)
+	}
+	if !f.IncludeExamples {
+		where += ` AND example_id IS NULL`
+	}
+	if f.ReferenceType != "" {
+		where += ` AND reference_type = ?`
+		args = append(args, f.ReferenceType)
+	}
+	if f.BlockType != "" {
+		where += ` AND block_type = ?`
+		args = append(args, f.BlockType)
+	}
+	if f.ResourceType != "" {
+		if strings.Contains(f.ResourceType, "*") {
+			where += ` AND block_type IN ('resource', 'data') AND block_labels GLOB ?`
+			args = append(args, f.ResourceType+".*")
+		} else {
+			where += ` AND block_type IN ('resource', 'data') AND block_labels >= ? AND block_labels < ?`
+			args = append(args, f.ResourceType+".", f.ResourceType+".\uffff")
+		}
+	}
+	if f.AttributePath != "" {
+		if strings.Contains(f.AttributePath, "*") {
+			where += ` AND attribute_path GLOB ?`
+		} else {
+			where += ` AND attribute_path = ?`
+		}
+		args = append(args, f.AttributePath)
+	}
+	if f.FilePath != "" {
+		where += ` AND file_path GLOB ?`
+		args = append(args, f.FilePath)
+	}
+	for _, p := range f.ExcludePaths {
+		where += ` AND file_path NOT GLOB ?`
+		args = append(args, p)
+	}
+
+	// Exact matches name the symbol or attribute itself, or a field below the
+	// symbol; fuzzy matches may occur anywhere in the path, symbol or labels.
+	order := `module_id, file_path, start_byte`
+	var rankArgs []any
+	if term != "" {
+		if f.Exact {
+			where += ` AND (LOWER(reference_name) = ? OR substr(LOWER(reference_name), 1, ?) = ?
+                OR LOWER(attribute_path) = ? OR LOWER(attribute_path) LIKE ? ESCAPE '\'
+                OR LOWER(reference_name) LIKE ? ESCAPE '\')`
+			args = append(args, term, len(term)+1, term+".", term, "%."+escapeLike(term), "%."+escapeLike(term))
+		} else {
+			like := "%" + escapeLike(term) + "%"
+			where += ` AND (LOWER(attribute_path) LIKE ? ESCAPE '\' OR LOWER(reference_name) LIKE ? ESCAPE '\'
+                OR LOWER(IFNULL(block_labels, '')) LIKE ? ESCAPE '\' OR LOWER(block_type) LIKE ? ESCAPE '\')`
+			args = append(args, like, like, like, like)
+		}
+
+		order = `CASE
+                WHEN LOWER(reference_name) = ? THEN 0
+                WHEN LOWER(attribute_path) = ? OR LOWER(attribute_path) LIKE ? ESCAPE '\' OR LOWER(reference_name) LIKE ? ESCAPE '\' THEN 1
+                WHEN substr(LOWER(reference_name), 1, ?) = ? THEN 2
+                WHEN LOWER(reference_name) LIKE ? ESCAPE '\' THEN 3
+                WHEN LOWER(attribute_path) LIKE ? ESCAPE '\' THEN 4
+                ELSE 5
+            END, ` + order
+		suffix := "%." + escapeLike(term)
+		like := "%" + escapeLike(term) + "%"
+		rankArgs = []any{term, term, suffix, suffix, len(term) + 1, term + ".", like, like}
+	}
+
+	var total int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM hcl_relationships`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+        SELECT id, module_id, file_path, block_type, block_labels, attribute_path, reference_type, reference_name, IFNULL(iterator_source, ''), start_byte, end_byte
+        FROM hcl_relationships` + where + `
+        ORDER BY ` + order + `
+        LIMIT ? OFFSET ?`
+	queryArgs := append(append(append([]any{}, args...), rankArgs...), f.Limit, f.Offset)
+
+	rows, err := db.conn.Query(query, queryArgs...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
@@ -724,10 +1686,11 @@ func (db *DB) QueryRelationshipsAny(term string, limit int) ([]HCLRelationship,
 			&rel.AttributePath,
 			&rel.ReferenceType,
 			&rel.ReferenceName,
+			&rel.IteratorSource,
 			&rel.StartByte,
 			&rel.EndByte,
 		); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		if blockLabels.Valid {
 			rel.BlockLabels = blockLabels.String
@@ -735,43 +1698,25 @@ func (db *DB) QueryRelationshipsAny(term string, limit int) ([]HCLRelationship,
 		results = append(results, rel)
 	}
 
-	return results, rows.Err()
+	return results, total, rows.Err()
 }
 
-func nullIfEmpty(s string) any {
-	if s == "" {
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func nullIfZero(id int64) any {
+	if id == 0 {
 		return nil
 	}
-	return s
+	return id
 }
 
-func (db *DB) HCLBlockExists(moduleID int64, filePath, blockType, typePrefix string, attrFilters []string) (bool, error) {
-	base := `SELECT 1 FROM hcl_blocks WHERE module_id = ? AND file_path = ?`
-	args := []any{moduleID, filePath}
-	if blockType != "" {
-		base += ` AND block_type = ?`
-		args = append(args, blockType)
-	}
-	if typePrefix != "" {
-		base += ` AND type_label LIKE ?`
-		args = append(args, typePrefix+"%")
-	}
-	for range attrFilters {
-		base += ` AND instr(IFNULL(attr_paths, ''), ?) > 0`
-	}
-	for _, f := range attrFilters {
-		args = append(args, f)
-	}
-	base += ` LIMIT 1`
-	var one int
-	err := db.conn.QueryRow(base, args...).Scan(&one)
-	if err == sql.ErrNoRows {
-		return false, nil
-	}
-	if err != nil {
-		return false, err
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
 	}
-	return true, nil
+	return s
 }
 
 type ModuleStructureSummary struct {
@@ -785,14 +1730,27 @@ type ModuleStructureSummary struct {
 func (db *DB) SummarizeModuleStructure(moduleID int64) (*ModuleStructureSummary, error) {
 	sum := &ModuleStructureSummary{}
 
-	_ = db.conn.QueryRow(`SELECT COUNT(*) FROM hcl_blocks WHERE module_id = ? AND block_type = 'resource'`, moduleID).Scan(&sum.ResourceCount)
-	_ = db.conn.QueryRow(`SELECT COUNT(*) FROM hcl_blocks WHERE module_id = ? AND block_type = 'lifecycle'`, moduleID).Scan(&sum.LifecycleCount)
-	_ = db.conn.QueryRow(`SELECT COUNT(*) FROM hcl_blocks WHERE module_id = ? AND block_type = 'resource' AND instr(IFNULL(attr_paths,''), 'lifecycle.ignore_changes') > 0`, moduleID).Scan(&sum.ResourcesWithIgnoreChanges)
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM hcl_blocks WHERE module_id = ? AND example_id IS NULL AND block_type = 'resource'`, moduleID).Scan(&sum.ResourceCount); err != nil {
+		return nil, err
+	}
+	// Only lifecycle meta-arguments of resources and data sources count;
+	// removed blocks carry a lifecycle block of their own.
+	if err := db.conn.QueryRow(`
+        SELECT COUNT(*) FROM hcl_blocks b
+        JOIN hcl_blocks p ON p.id = b.parent_id
+        WHERE b.module_id = ? AND b.example_id IS NULL AND b.block_type = 'lifecycle'
+          AND p.block_type IN ('resource', 'data')
+    `, moduleID).Scan(&sum.LifecycleCount); err != nil {
+		return nil, err
+	}
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM hcl_blocks WHERE module_id = ? AND example_id IS NULL AND block_type = 'resource' AND instr(IFNULL(attr_paths,''), 'lifecycle.ignore_changes') > 0`, moduleID).Scan(&sum.ResourcesWithIgnoreChanges); err != nil {
+		return nil, err
+	}
 
 	rows, err := db.conn.Query(`
         SELECT type_label, COUNT(*) AS cnt
         FROM hcl_blocks
-        WHERE module_id = ? AND block_type = 'resource' AND type_label IS NOT NULL
+        WHERE module_id = ? AND example_id IS NULL AND block_type = 'resource' AND type_label IS NOT NULL
         GROUP BY type_label
         ORDER BY cnt DESC, type_label ASC
         LIMIT 5
@@ -810,7 +1768,7 @@ func (db *DB) SummarizeModuleStructure(moduleID int64) (*ModuleStructureSummary,
 
 	rows2, err2 := db.conn.Query(`
         SELECT DISTINCT type_label FROM hcl_blocks
-        WHERE module_id = ? AND block_type = 'dynamic' AND type_label IS NOT NULL
+        WHERE module_id = ? AND example_id IS NULL AND block_type = 'dynamic' AND type_label IS NOT NULL
         ORDER BY type_label
     `, moduleID)
 	if err2 == nil {
@@ -828,7 +1786,7 @@ func (db *DB) SummarizeModuleStructure(moduleID int64) (*ModuleStructureSummary,
 
 func (db *DB) GetModuleDynamicLabels(moduleID int64) ([]string, error) {
 	rows, err := db.conn.Query(`
-        SELECT DISTINCT type_label FROM hcl_blocks WHERE module_id = ? AND block_type = 'dynamic' AND type_label IS NOT NULL
+        SELECT DISTINCT type_label FROM hcl_blocks WHERE module_id = ? AND example_id IS NULL AND block_type = 'dynamic' AND type_label IS NOT NULL
     `, moduleID)
 	if err != nil {
 		return nil, err
@@ -847,13 +1805,13 @@ func (db *DB) GetModuleDynamicLabels(moduleID int64) ([]string, error) {
 
 func (db *DB) CountResourceBlocks(moduleID int64) (int, error) {
 	var total int
-	err := db.conn.QueryRow(`SELECT COUNT(*) FROM hcl_blocks WHERE module_id = ? AND block_type = 'resource'`, moduleID).Scan(&total)
+	err := db.conn.QueryRow(`SELECT COUNT(*) FROM hcl_blocks WHERE module_id = ? AND example_id IS NULL AND block_type = 'resource'`, moduleID).Scan(&total)
 	return total, err
 }
 
 func (db *DB) GetModuleResourceTypes(moduleID int64) ([]string, error) {
 	rows, err := db.conn.Query(`
-        SELECT resource_type FROM module_resources WHERE module_id = ?
+        SELECT resource_type FROM module_resources WHERE module_id = ? AND example_id IS NULL
     `, moduleID)
 	if err != nil {
 		return nil, err
@@ -927,15 +1885,15 @@ func (db *DB) InsertModuleAlias(moduleID int64, alias string, weight int, source
 func (db *DB) ResolveModuleByAlias(alias string) (*Module, error) {
 	var m Module
 	err := db.conn.QueryRow(`
-        SELECT m.id, m.name, m.full_name, m.description, m.repo_url, m.last_updated, m.synced_at, m.readme_content, m.has_examples
+        SELECT m.id, m.name, m.full_name, m.description, m.repo_url, m.last_updated, m.synced_at, m.readme_content, m.has_examples, IFNULL(m.parent_id, 0), IFNULL(m.subpath, '')
         FROM module_aliases a
         JOIN modules m ON m.id = a.module_id
         WHERE a.alias = ?
         ORDER BY a.weight DESC,
-                 (CASE WHEN instr(m.name, '//') > 0 THEN 1 ELSE 0 END) ASC,
+                 (m.parent_id IS NOT NULL) ASC,
                  m.name ASC
         LIMIT 1
-    `, strings.ToLower(alias)).Scan(&m.ID, &m.Name, &m.FullName, &m.Description, &m.RepoURL, &m.LastUpdated, &m.SyncedAt, &m.ReadmeContent, &m.HasExamples)
+    `, strings.ToLower(alias)).Scan(&m.ID, &m.Name, &m.FullName, &m.Description, &m.RepoURL, &m.LastUpdated, &m.SyncedAt, &m.ReadmeContent, &m.HasExamples, &m.ParentID, &m.Subpath)
 	if err != nil {
 		return nil, err
 	}
@@ -946,18 +1904,112 @@ func (db *DB) ResolveModuleByAliasPrefix(prefix string) (*Module, error) {
 	like := strings.ToLower(prefix) + "%"
 	var m Module
 	err := db.conn.QueryRow(`
-        SELECT m.id, m.name, m.full_name, m.description, m.repo_url, m.last_updated, m.synced_at, m.readme_content, m.has_examples
+        SELECT m.id, m.name, m.full_name, m.description, m.repo_url, m.last_updated, m.synced_at, m.readme_content, m.has_examples, IFNULL(m.parent_id, 0), IFNULL(m.subpath, '')
         FROM module_aliases a
         JOIN modules m ON m.id = a.module_id
         WHERE a.alias LIKE ?
         GROUP BY m.id
         ORDER BY MAX(a.weight) DESC,
-                 (CASE WHEN instr(m.name, '//') > 0 THEN 1 ELSE 0 END) ASC,
+                 (m.parent_id IS NOT NULL) ASC,
                  m.name ASC
         LIMIT 1
-    `, like).Scan(&m.ID, &m.Name, &m.FullName, &m.Description, &m.RepoURL, &m.LastUpdated, &m.SyncedAt, &m.ReadmeContent, &m.HasExamples)
+    `, like).Scan(&m.ID, &m.Name, &m.FullName, &m.Description, &m.RepoURL, &m.LastUpdated, &m.SyncedAt, &m.ReadmeContent, &m.HasExamples, &m.ParentID, &m.Subpath)
 	if err != nil {
 		return nil, err
 	}
 	return &m, nil
 }
+
+// ModulesWithoutEmbeddings returns the modules that have no vectors for model
+// yet, either never embedded or cleared by a re-sync.
+func (db *DB) ModulesWithoutEmbeddings(model string) ([]Module, error) {
+	rows, err := db.conn.Query(`
+		SELECT id, name, full_name, description, repo_url, last_updated, synced_at, readme_content, has_examples, IFNULL(parent_id, 0), IFNULL(subpath, '')
+		FROM modules m
+		WHERE NOT EXISTS (SELECT 1 FROM module_embeddings e WHERE e.module_id = m.id AND e.model = ?)
+		ORDER BY name
+	`, model)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var modules []Module
+	for rows.Next() {
+		var m Module
+		if err := rows.Scan(&m.ID, &m.Name, &m.FullName, &m.Description, &m.RepoURL, &m.LastUpdated, &m.SyncedAt, &m.ReadmeContent, &m.HasExamples, &m.ParentID, &m.Subpath); err != nil {
+			return nil, err
+		}
+		modules = append(modules, m)
+	}
+	return modules, rows.Err()
+}
+
+// InsertEmbeddings stores vectors in one transaction, replacing existing
+// vectors for the same module, model, kind and ref.
+func (db *DB) InsertEmbeddings(embeddings []ModuleEmbedding) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO module_embeddings (module_id, model, kind, ref, content, vector)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(module_id, model, kind, ref) DO UPDATE SET
+			content = excluded.content,
+			vector = excluded.vector
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, e := range embeddings {
+		if _, err := stmt.Exec(e.ModuleID, e.Model, e.Kind, e.Ref, e.Content, encodeVector(e.Vector)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ScanEmbeddings streams every vector stored for model to fn.
+func (db *DB) ScanEmbeddings(model string, fn func(ModuleEmbedding)) error {
+	rows, err := db.conn.Query(`
+		SELECT module_id, model, kind, ref, content, vector
+		FROM module_embeddings
+		WHERE model = ?
+	`, model)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e ModuleEmbedding
+		var blob []byte
+		if err := rows.Scan(&e.ModuleID, &e.Model, &e.Kind, &e.Ref, &e.Content, &blob); err != nil {
+			return err
+		}
+		e.Vector = decodeVector(blob)
+		fn(e)
+	}
+	return rows.Err()
+}
+
+func encodeVector(vec []float32) []byte {
+	buf := make([]byte, 4*len(vec))
+	for i, v := range vec {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+	}
+	return buf
+}
+
+func decodeVector(buf []byte) []float32 {
+	vec := make([]float32, len(buf)/4)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return vec
+}
@@ -0,0 +1,329 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqliteRecursive is SQLITE_RECURSIVE, which the driver does not export; it
+// authorizes recursive common table expressions.
+const sqliteRecursive = 33
+
+// QueryableTables are the tables ad-hoc queries may read. Embedding vectors
+// and FTS internals are left out.
+var QueryableTables = []string{
+	"modules",
+	"module_files",
+	"module_variables",
+	"module_outputs",
+	"module_resources",
+	"module_data_sources",
+	"module_examples",
+	"module_conditions",
+	"module_migrations",
+	"module_aliases",
+	"module_tags",
+	"hcl_blocks",
+	"hcl_attributes",
+	"hcl_relationships",
+}
+
+var queryableTables = func() map[string]bool {
+	m := make(map[string]bool, len(QueryableTables))
+	for _, t := range QueryableTables {
+		m[t] = true
+	}
+	return m
+}()
+
+// readOnlyConnector opens connections to dsn whose authorizer only admits
+// SELECT statements over QueryableTables; ad-hoc queries never run on the
+// main connection.
+type readOnlyConnector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+}
+
+func (c readOnlyConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c readOnlyConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// openReadOnly opens the read-only pool for ad-hoc queries. Each connection
+// authorizes against the tables stored in this database.
+func (db *DB) openReadOnly(dbPath string) *sql.DB {
+	return sql.OpenDB(readOnlyConnector{
+		dsn: "file:" + url.PathEscape(dbPath) + "?mode=ro&_query_only=true",
+		driver: &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				conn.RegisterAuthorizer(db.authorizeReadOnly)
+				return nil
+			},
+		},
+	})
+}
+
+// loadStoredTables records the names of every table in the database file.
+// SQLite also reports reads of common table expressions, which are not stored
+// and must stay readable.
+func (db *DB) loadStoredTables() error {
+	rows, err := db.conn.Query(`SELECT name FROM sqlite_master WHERE type IN ('table', 'view')`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	tables := map[string]bool{"sqlite_master": true, "sqlite_schema": true, "sqlite_temp_master": true, "sqlite_temp_schema": true}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		tables[name] = true
+	}
+	db.storedTables = tables
+	return rows.Err()
+}
+
+// authorizeReadOnly admits reads of allowlisted tables and CTEs, and function
+// calls; everything else, including writes, pragmas and ATTACH, is denied.
+func (db *DB) authorizeReadOnly(action int, arg1, _, _ string) int {
+	switch action {
+	case sqlite3.SQLITE_SELECT, sqlite3.SQLITE_FUNCTION, sqliteRecursive:
+		return sqlite3.SQLITE_OK
+	case sqlite3.SQLITE_READ:
+		if queryableTables[arg1] {
+			return sqlite3.SQLITE_OK
+		}
+		if !db.storedTables[arg1] && !strings.HasPrefix(arg1, "sqlite_") {
+			return sqlite3.SQLITE_OK
+		}
+	}
+	return sqlite3.SQLITE_DENY
+}
+
+// QueryResult holds the rows of a read-only query rendered as text.
+type QueryResult struct {
+	Columns   []string
+	Rows      [][]string
+	Truncated bool
+}
+
+var selectStatementRegex = regexp.MustCompile(`(?is)^\s*(select|with)\b`)
+
+// QueryReadOnly runs a single SELECT statement on a read-only connection and
+// returns at most maxRows rows. The context bounds how long it may run.
+func (db *DB) QueryReadOnly(ctx context.Context, query string, maxRows int) (*QueryResult, error) {
+	statement, trailing := splitFirstStatement(query)
+	if trailing {
+		return nil, fmt.Errorf("only a single statement is allowed")
+	}
+	query = strings.TrimSpace(statement)
+	if !selectStatementRegex.MatchString(query) {
+		return nil, fmt.Errorf("only SELECT statements are allowed")
+	}
+
+	rows, err := db.readOnly.QueryContext(ctx, query)
+	if err != nil {
+		return nil, readOnlyError(err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := &QueryResult{Columns: columns}
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if len(result.Rows) == maxRows {
+			result.Truncated = true
+			break
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		row := make([]string, len(values))
+		for i, v := range values {
+			row[i] = queryValue(v)
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, readOnlyError(err)
+	}
+	return result, nil
+}
+
+// splitFirstStatement returns the first statement of query without its
+// semicolon, and whether anything but whitespace, comments and further
+// semicolons follows it. A semicolon inside a string literal, quoted
+// identifier or comment does not end the statement. The driver would
+// otherwise run every statement and return the rows of the last one.
+func splitFirstStatement(query string) (string, bool) {
+	end := -1
+	for i := 0; i < len(query); {
+		rest := query[i:]
+		switch {
+		case strings.HasPrefix(rest, "--"):
+			if n := strings.IndexByte(rest, '\n'); n >= 0 {
+				i += n + 1
+			} else {
+				i = len(query)
+			}
+		case strings.HasPrefix(rest, "/*"):
+			if n := strings.Index(rest[2:], "*/"); n >= 0 {
+				i += n + 4
+			} else {
+				i = len(query)
+			}
+		case rest[0] == ';':
+			if end < 0 {
+				end = i
+			}
+			i++
+		case end >= 0:
+			if !unicode.IsSpace(rune(rest[0])) {
+				return query[:end], true
+			}
+			i++
+		case rest[0] == '\'' || rest[0] == '"' || rest[0] == '`':
+			i += quotedLen(rest, rest[0])
+		case rest[0] == '[':
+			i += quotedLen(rest, ']')
+		default:
+			i++
+		}
+	}
+	if end < 0 {
+		return query, false
+	}
+	return query[:end], false
+}
+
+// quotedLen returns the length of the quoted token at the start of s, which
+// ends at closing. A doubled quote character is an escaped quote; brackets
+// have no escape. An unterminated token runs to the end of s.
+func quotedLen(s string, closing byte) int {
+	for i := 1; i < len(s); i++ {
+		if s[i] != closing {
+			continue
+		}
+		if closing != ']' && i+1 < len(s) && s[i+1] == closing {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(s)
+}
+
+func readOnlyError(err error) error {
+	if strings.Contains(err.Error(), "not authorized") {
+		return fmt.Errorf("%w (only SELECT over %s is allowed)", err, strings.Join(QueryableTables, ", "))
+	}
+	if errors.Is(err, context.DeadlineExceeded) || strings.Contains(err.Error(), "interrupted") {
+		return fmt.Errorf("query timed out")
+	}
+	return err
+}
+
+func queryValue(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		if utf8.Valid(val) {
+			return string(val)
+		}
+		return fmt.Sprintf("<blob %d bytes>", len(val))
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// TableColumn describes one column of a queryable table.
+type TableColumn struct {
+	Name       string
+	Type       string
+	NotNull    bool
+	PrimaryKey bool
+}
+
+// TableSchema describes a queryable table, its columns, indexes and row count.
+type TableSchema struct {
+	Name    string
+	Columns []TableColumn
+	Indexes []string
+	Rows    int
+}
+
+// DescribeQueryableTables returns the schema of every table ad-hoc queries
+// may read.
+func (db *DB) DescribeQueryableTables() ([]TableSchema, error) {
+	tables := make([]TableSchema, 0, len(QueryableTables))
+	for _, name := range QueryableTables {
+		t := TableSchema{Name: name}
+
+		rows, err := db.conn.Query(fmt.Sprintf("PRAGMA table_info(%s)", name))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var (
+				cid       int
+				col       TableColumn
+				notNull   int
+				dfltValue sql.NullString
+				pk        int
+			)
+			if err := rows.Scan(&cid, &col.Name, &col.Type, &notNull, &dfltValue, &pk); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			col.NotNull = notNull == 1
+			col.PrimaryKey = pk > 0
+			t.Columns = append(t.Columns, col)
+		}
+		rows.Close()
+
+		idxRows, err := db.conn.Query(`SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND name NOT LIKE 'sqlite_%'`, name)
+		if err != nil {
+			return nil, err
+		}
+		for idxRows.Next() {
+			var idx string
+			if err := idxRows.Scan(&idx); err != nil {
+				idxRows.Close()
+				return nil, err
+			}
+			t.Indexes = append(t.Indexes, idx)
+		}
+		idxRows.Close()
+		sort.Strings(t.Indexes)
+
+		if err := db.conn.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", name)).Scan(&t.Rows); err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, nil
+}
@@ -0,0 +1,35 @@
+package database
+
+import "testing"
+
+func TestSplitFirstStatement(t *testing.T) {
+	tests := []struct {
+		query     string
+		statement string
+		trailing  bool
+	}{
+		{"SELECT 1", "SELECT 1", false},
+		{"SELECT 1;", "SELECT 1", false},
+		{"SELECT 1; ;\n", "SELECT 1", false},
+		{"SELECT ';' AS x", "SELECT ';' AS x", false},
+		{"SELECT 'it''s;' AS x;", "SELECT 'it''s;' AS x", false},
+		{`SELECT "a;b", [c;d], ` + "`e;f`" + ` FROM t`, `SELECT "a;b", [c;d], ` + "`e;f`" + ` FROM t`, false},
+		{"SELECT 1 -- ;\n", "SELECT 1 -- ;\n", false},
+		{"SELECT 1 /* ; */", "SELECT 1 /* ; */", false},
+		{"SELECT 1; -- done", "SELECT 1", false},
+		{"SELECT 1; /* done */", "SELECT 1", false},
+		{"SELECT 1; SELECT 2", "SELECT 1", true},
+		{"SELECT 1;DELETE FROM modules", "SELECT 1", true},
+		{"SELECT 1; 'x'", "SELECT 1", true},
+		{"SELECT 'unterminated;", "SELECT 'unterminated;", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			statement, trailing := splitFirstStatement(tt.query)
+			if statement != tt.statement || trailing != tt.trailing {
+				t.Errorf("splitFirstStatement(%q) = %q, %v, want %q, %v", tt.query, statement, trailing, tt.statement, tt.trailing)
+			}
+		})
+	}
+}
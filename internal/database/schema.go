@@ -67,6 +67,31 @@ CREATE TABLE IF NOT EXISTS module_data_sources (
     FOREIGN KEY (module_id) REFERENCES modules(id) ON DELETE CASCADE
 );
 
+CREATE TABLE IF NOT EXISTS module_conditions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    module_id INTEGER NOT NULL,
+    kind TEXT NOT NULL,         -- validation|precondition|postcondition|assert
+    owner_type TEXT NOT NULL,   -- variable|resource|data|output|check
+    owner_name TEXT NOT NULL,   -- e.g., vault or azurerm_key_vault.this
+    condition TEXT NOT NULL,
+    error_message TEXT,
+    source_file TEXT,
+    FOREIGN KEY (module_id) REFERENCES modules(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS module_migrations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    module_id INTEGER NOT NULL,
+    kind TEXT NOT NULL,         -- moved|import|removed
+    from_address TEXT,
+    to_address TEXT,
+    import_id TEXT,
+    destroy BOOLEAN DEFAULT 1,  -- removed blocks only: whether the object is destroyed
+    source_file TEXT,
+    FOREIGN KEY (module_id) REFERENCES modules(id) ON DELETE CASCADE
+);
+
+-- One row per examples/<name>/ directory; example code is indexed under its example_id
 CREATE TABLE IF NOT EXISTS module_examples (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     module_id INTEGER NOT NULL,
@@ -86,15 +111,21 @@ CREATE INDEX IF NOT EXISTS idx_module_outputs_module_id ON module_outputs(module
 CREATE INDEX IF NOT EXISTS idx_module_resources_module_id ON module_resources(module_id);
 CREATE INDEX IF NOT EXISTS idx_module_resources_type ON module_resources(resource_type);
 CREATE INDEX IF NOT EXISTS idx_module_data_sources_module_id ON module_data_sources(module_id);
+CREATE INDEX IF NOT EXISTS idx_module_data_sources_type ON module_data_sources(data_type);
 CREATE INDEX IF NOT EXISTS idx_module_examples_module_id ON module_examples(module_id);
+CREATE INDEX IF NOT EXISTS idx_module_conditions_module_id ON module_conditions(module_id);
+CREATE INDEX IF NOT EXISTS idx_module_migrations_module_id ON module_migrations(module_id);
+CREATE INDEX IF NOT EXISTS idx_module_conditions_owner ON module_conditions(module_id, owner_type, owner_name);
 
 -- HCL block index for fast AST-based queries
 CREATE TABLE IF NOT EXISTS hcl_blocks (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     module_id INTEGER NOT NULL,
+    parent_id INTEGER,        -- enclosing block, NULL for top-level blocks
     file_path TEXT NOT NULL,
-    block_type TEXT NOT NULL, -- resource|dynamic|lifecycle
-    type_label TEXT,          -- e.g., azurerm_storage_account for resource, or label for dynamic
+    block_type TEXT NOT NULL, -- any block type: resource|data|module|variable|dynamic|lifecycle|ip_configuration|...
+    type_label TEXT,          -- first label (e.g., azurerm_storage_account), or address for moved/import/removed
+    labels TEXT,              -- all labels joined by "." (e.g., azurerm_storage_account.this)
     start_byte INTEGER NOT NULL,
     end_byte INTEGER NOT NULL,
     attr_paths TEXT,          -- newline-separated flattened attribute paths within this block (e.g., "for_each\nlifecycle.ignore_changes")
@@ -105,6 +136,28 @@ CREATE INDEX IF NOT EXISTS idx_hcl_blocks_module ON hcl_blocks(module_id);
 CREATE INDEX IF NOT EXISTS idx_hcl_blocks_type ON hcl_blocks(block_type);
 CREATE INDEX IF NOT EXISTS idx_hcl_blocks_label ON hcl_blocks(type_label);
 
+-- Attribute values per block, keyed by path relative to the top-level block
+CREATE TABLE IF NOT EXISTS hcl_attributes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    module_id INTEGER NOT NULL,
+    block_id INTEGER NOT NULL,  -- block that directly contains the attribute
+    file_path TEXT NOT NULL,
+    root_type TEXT NOT NULL,    -- block type of the top-level block (e.g., resource)
+    root_label TEXT,            -- first label of the top-level block (e.g., azurerm_storage_account)
+    attribute_path TEXT NOT NULL, -- e.g., min_tls_version, network_rules.default_action, dynamic.identity.content.type
+    value TEXT,                 -- literal value (strings unquoted); NULL for non-literal expressions
+    expression TEXT NOT NULL,   -- normalized expression source
+    start_byte INTEGER NOT NULL,
+    end_byte INTEGER NOT NULL,
+    FOREIGN KEY (module_id) REFERENCES modules(id) ON DELETE CASCADE,
+    FOREIGN KEY (block_id) REFERENCES hcl_blocks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_hcl_attributes_module ON hcl_attributes(module_id);
+CREATE INDEX IF NOT EXISTS idx_hcl_attributes_block ON hcl_attributes(block_id);
+CREATE INDEX IF NOT EXISTS idx_hcl_attributes_path_value ON hcl_attributes(attribute_path, value);
+CREATE INDEX IF NOT EXISTS idx_hcl_attributes_value ON hcl_attributes(value);
+
 CREATE TABLE IF NOT EXISTS hcl_relationships (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     module_id INTEGER NOT NULL,
@@ -176,6 +229,24 @@ CREATE TRIGGER IF NOT EXISTS files_fts_delete AFTER DELETE ON module_files BEGIN
     DELETE FROM files_fts WHERE rowid = old.id;
 END;
 
+CREATE VIRTUAL TABLE IF NOT EXISTS conditions_fts USING fts5(
+    owner_name,
+    condition,
+    error_message,
+    content='module_conditions',
+    content_rowid='id'
+);
+
+CREATE TRIGGER IF NOT EXISTS conditions_fts_insert AFTER INSERT ON module_conditions BEGIN
+    INSERT INTO conditions_fts(rowid, owner_name, condition, error_message)
+    VALUES (new.id, new.owner_name, new.condition, new.error_message);
+END;
+
+CREATE TRIGGER IF NOT EXISTS conditions_fts_delete AFTER DELETE ON module_conditions BEGIN
+    INSERT INTO conditions_fts(conditions_fts, rowid, owner_name, condition, error_message)
+    VALUES ('delete', old.id, old.owner_name, old.condition, old.error_message);
+END;
+
 -- Auto-generated and user-defined aliases for modules
 CREATE TABLE IF NOT EXISTS module_aliases (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -202,4 +273,73 @@ CREATE TABLE IF NOT EXISTS module_tags (
 
 CREATE INDEX IF NOT EXISTS idx_module_tags_module_id ON module_tags(module_id);
 CREATE INDEX IF NOT EXISTS idx_module_tags_tag ON module_tags(tag);
+
+-- Optional semantic index: one vector per README chunk, variable or block,
+-- per embedding model. Vectors are little-endian float32 arrays.
+CREATE TABLE IF NOT EXISTS module_embeddings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    module_id INTEGER NOT NULL,
+    model TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    ref TEXT NOT NULL,
+    content TEXT NOT NULL,
+    vector BLOB NOT NULL,
+    FOREIGN KEY (module_id) REFERENCES modules(id) ON DELETE CASCADE,
+    UNIQUE(module_id, model, kind, ref)
+);
+
+CREATE INDEX IF NOT EXISTS idx_module_embeddings_model ON module_embeddings(model, module_id);
+`
+
+// ColumnMigrations adds columns introduced after a table was first created, so
+// existing index.db files keep working without a full rebuild.
+var ColumnMigrations = []struct {
+	Table      string
+	Column     string
+	Definition string
+}{
+	{"hcl_blocks", "parent_id", "INTEGER"},
+	{"hcl_blocks", "labels", "TEXT"},
+	{"hcl_blocks", "example_id", "INTEGER"},
+	{"hcl_attributes", "example_id", "INTEGER"},
+	{"module_variables", "example_id", "INTEGER"},
+	{"module_outputs", "example_id", "INTEGER"},
+	{"module_resources", "example_id", "INTEGER"},
+	{"module_data_sources", "example_id", "INTEGER"},
+	{"modules", "parent_id", "INTEGER REFERENCES modules(id) ON DELETE CASCADE"},
+	{"hcl_relationships", "iterator_source", "TEXT"}, // collection expression behind each.*, count.* and dynamic iterator references
+	{"hcl_relationships", "example_id", "INTEGER"},
+	{"modules", "subpath", "TEXT"}, // directory of a submodule in its repository (e.g., modules/subnet)
+}
+
+// PostMigrationSchema holds statements that depend on migrated columns.
+const PostMigrationSchema = `
+CREATE INDEX IF NOT EXISTS idx_hcl_blocks_parent ON hcl_blocks(parent_id);
+CREATE INDEX IF NOT EXISTS idx_hcl_blocks_labels ON hcl_blocks(labels);
+CREATE INDEX IF NOT EXISTS idx_module_variables_example ON module_variables(example_id);
+CREATE INDEX IF NOT EXISTS idx_module_resources_example ON module_resources(example_id);
+CREATE INDEX IF NOT EXISTS idx_modules_parent ON modules(parent_id);
+CREATE INDEX IF NOT EXISTS idx_hcl_relationships_example ON hcl_relationships(example_id);
+
+-- Scope relationships indexed before example_id existed to their example.
+UPDATE hcl_relationships
+SET example_id = (
+    SELECT e.id FROM module_examples e
+    WHERE e.module_id = hcl_relationships.module_id
+      AND substr(hcl_relationships.file_path, 1, length(e.path) + 1) = e.path || '/'
+    LIMIT 1
+)
+WHERE example_id IS NULL AND (file_path LIKE 'examples/%' OR file_path LIKE '%/examples/%');
+
+-- Link submodules indexed before parent_id existed to their repository module.
+UPDATE modules
+SET parent_id = (SELECT p.id FROM modules p WHERE p.name = substr(modules.name, 1, instr(modules.name, '//') - 1))
+WHERE parent_id IS NULL AND instr(name, '//') > 0;
+
+-- Record the directory of submodules indexed before subpath existed.
+UPDATE modules
+SET subpath = substr(name, instr(name, '//') + 2)
+WHERE subpath IS NULL AND parent_id IS NOT NULL AND instr(name, '//') > 0;
+
+CREATE INDEX IF NOT EXISTS idx_modules_subpath ON modules(parent_id, subpath);
 `
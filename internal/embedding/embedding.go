@@ -0,0 +1,177 @@
+// Package embedding turns text into vectors for semantic search. Embedders
+// run locally: the built-in hashing embedder needs no model files, and any
+// local model can be plugged in through an external command.
+package embedding
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os/exec"
+	"strings"
+	"unicode"
+)
+
+// Embedder maps texts to vectors of a fixed dimension. Name identifies the
+// model so vectors of different embedders are never compared.
+type Embedder interface {
+	Name() string
+	Embed(texts []string) ([][]float32, error)
+}
+
+// HashEmbedder is a deterministic bag-of-features embedder: words and their
+// character n-grams are hashed into a fixed number of signed buckets and the
+// result is L2-normalized. It needs no model and always yields the same vector
+// for the same text, which also makes it the embedder to test against.
+type HashEmbedder struct {
+	Dims int
+}
+
+func NewHashEmbedder(dims int) *HashEmbedder {
+	return &HashEmbedder{Dims: dims}
+}
+
+func (h *HashEmbedder) Name() string {
+	return fmt.Sprintf("hash-v1-%d", h.Dims)
+}
+
+func (h *HashEmbedder) Embed(texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		out[i] = h.embed(text)
+	}
+	return out, nil
+}
+
+func (h *HashEmbedder) embed(text string) []float32 {
+	vec := make([]float32, h.Dims)
+	add := func(feature string, weight float32) {
+		sum := fnv.New64a()
+		sum.Write([]byte(feature))
+		v := sum.Sum64()
+		bucket := int(v % uint64(h.Dims))
+		if v&(1<<63) != 0 {
+			weight = -weight
+		}
+		vec[bucket] += weight
+	}
+
+	var words []string
+	for _, w := range tokenize(text) {
+		if _, stop := stopwords[w]; stop {
+			continue
+		}
+		if len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss") {
+			w = strings.TrimSuffix(w, "s")
+		}
+		words = append(words, w)
+	}
+	for i, w := range words {
+		add("w:"+w, 1)
+		if i > 0 {
+			add("b:"+words[i-1]+" "+w, 0.5)
+		}
+		// Character n-grams let related word forms (container, containerized)
+		// share features.
+		padded := []rune("^" + w + "$")
+		for j := 0; j+4 <= len(padded); j++ {
+			add("g:"+string(padded[j:j+4]), 0.25)
+		}
+	}
+	normalize(vec)
+	return vec
+}
+
+// stopwords carry no meaning for module search and would otherwise dominate
+// short queries.
+var stopwords = map[string]struct{}{
+	"a": {}, "an": {}, "and": {}, "the": {}, "with": {}, "that": {}, "which": {}, "to": {},
+	"for": {}, "of": {}, "in": {}, "on": {}, "is": {}, "are": {}, "be": {}, "by": {}, "or": {},
+	"it": {}, "this": {}, "module": {}, "modules": {}, "terraform": {}, "azure": {}, "azurerm": {},
+}
+
+// CommandEmbedder delegates to a local program, e.g. a wrapper around a small
+// sentence-transformer model. The program receives {"texts": [...]} on stdin
+// and must print {"embeddings": [[...], ...]} in the same order.
+type CommandEmbedder struct {
+	Command string
+	Args    []string
+}
+
+func NewCommandEmbedder(commandLine string) (*CommandEmbedder, error) {
+	fields := strings.Fields(commandLine)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty embedder command")
+	}
+	return &CommandEmbedder{Command: fields[0], Args: fields[1:]}, nil
+}
+
+func (c *CommandEmbedder) Name() string {
+	return "cmd:" + strings.Join(append([]string{c.Command}, c.Args...), " ")
+}
+
+func (c *CommandEmbedder) Embed(texts []string) ([][]float32, error) {
+	input, err := json.Marshal(map[string][]string{"texts": texts})
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(c.Command, c.Args...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("embedder command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	var result struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, fmt.Errorf("invalid embedder output: %w", err)
+	}
+	if len(result.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("embedder returned %d vectors for %d texts", len(result.Embeddings), len(texts))
+	}
+	for _, v := range result.Embeddings {
+		normalize(v)
+	}
+	return result.Embeddings, nil
+}
+
+// tokenize lowercases text and splits it into words on anything that is not a
+// letter or digit, so azurerm_container_app yields azurerm, container and app.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Cosine returns the cosine similarity of two normalized vectors, or 0 when
+// their dimensions differ.
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+func normalize(vec []float32) {
+	var sum float64
+	for _, v := range vec {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vec {
+		vec[i] /= norm
+	}
+}
@@ -0,0 +1,76 @@
+package embedding
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestHashEmbedderStable(t *testing.T) {
+	// Stored vectors are only reused under the same embedder name, so a change
+	// to the hashing must come with a new name rather than new vectors.
+	want := []float32{0.3536, 0, 0.1768, 0.7071, 0.1768, -0.5303, 0.1768, 0}
+	vectors, err := NewHashEmbedder(8).Embed([]string{"Key vault"})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	got := vectors[0]
+	if len(got) != len(want) {
+		t.Fatalf("len = %d, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if math.Abs(float64(got[i]-want[i])) > 1e-4 {
+			t.Fatalf("vector = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestHashEmbedderDeterministic(t *testing.T) {
+	texts := []string{"private endpoint for a key vault", "storage account containers", ""}
+	first, err := NewHashEmbedder(64).Embed(texts)
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	second, err := NewHashEmbedder(64).Embed(texts)
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("vectors differ between embedders of the same size")
+	}
+	for i, v := range first[:2] {
+		if norm := Cosine(v, v); math.Abs(norm-1) > 1e-6 {
+			t.Errorf("text %d: squared norm = %f, want 1", i, norm)
+		}
+	}
+	if norm := Cosine(first[2], first[2]); norm != 0 {
+		t.Errorf("empty text: squared norm = %f, want 0", norm)
+	}
+}
+
+func TestHashEmbedderSimilarity(t *testing.T) {
+	vectors, err := NewHashEmbedder(512).Embed([]string{
+		"subnets",
+		"subnet",
+		"the subnet module",
+		"storage account",
+	})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if sim := Cosine(vectors[0], vectors[1]); math.Abs(sim-1) > 1e-6 {
+		t.Errorf("plural and singular: similarity = %f, want 1", sim)
+	}
+	if sim := Cosine(vectors[1], vectors[2]); math.Abs(sim-1) > 1e-6 {
+		t.Errorf("stopwords: similarity = %f, want 1", sim)
+	}
+	if related, unrelated := Cosine(vectors[1], vectors[2]), Cosine(vectors[1], vectors[3]); related <= unrelated {
+		t.Errorf("related similarity %f not above unrelated %f", related, unrelated)
+	}
+}
+
+func TestCosineDimensionMismatch(t *testing.T) {
+	if sim := Cosine([]float32{1, 0}, []float32{1, 0, 0}); sim != 0 {
+		t.Errorf("Cosine = %f, want 0", sim)
+	}
+}
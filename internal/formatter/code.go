@@ -2,51 +2,133 @@ package formatter
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/dkooll/wamcp/internal/database"
 )
 
-func CodeSearchResults(query string, files []database.ModuleFile, getModuleName func(int64) string) string {
+// CodeMatch is one hit in a file. Offset is the byte offset of the match and
+// Block the top-level block enclosing it (e.g. "resource azurerm_key_vault.this").
+type CodeMatch struct {
+	Line   int
+	Column int
+	Offset int
+	Text   string
+	Block  string
+}
+
+type CodeFileMatches struct {
+	ModuleName string
+	FilePath   string
+	Content    string
+	Matches    []CodeMatch
+}
+
+// CodeSearchResults renders one page of matching files, which starts at
+// offset among totalFiles matching files.
+func CodeSearchResults(query, mode string, files []CodeFileMatches, offset, totalFiles, contextLines int) string {
 	var text strings.Builder
-	text.WriteString(fmt.Sprintf("# Code Search Results for '%s' (%d matches)\n\n", query, len(files)))
+	total := 0
+	for _, f := range files {
+		total += len(f.Matches)
+	}
+	if offset == 0 && len(files) >= totalFiles {
+		text.WriteString(fmt.Sprintf("# Code Search Results for '%s' (%s: %d match%s in %d file%s)\n\n",
+			query, mode, total, pluralSuffixES(total), len(files), pluralSuffix(len(files))))
+	} else if len(files) > 0 {
+		text.WriteString(fmt.Sprintf("# Code Search Results for '%s' (%s: %d match%s in files %d–%d of %d)\n\n",
+			query, mode, total, pluralSuffixES(total), offset+1, offset+len(files), totalFiles))
+	} else {
+		text.WriteString(fmt.Sprintf("# Code Search Results for '%s' (%s: %d matching file%s)\n\n",
+			query, mode, totalFiles, pluralSuffix(totalFiles)))
+	}
 
 	if len(files) == 0 {
-		text.WriteString("No code matches found.\n")
+		if totalFiles > 0 {
+			text.WriteString(fmt.Sprintf("No files at offset %d; use an offset below %d.\n", offset, totalFiles))
+		} else {
+			text.WriteString("No code matches found.\n")
+		}
 		return text.String()
 	}
 
-	for _, file := range files {
-		moduleName := getModuleName(file.ModuleID)
-		text.WriteString(fmt.Sprintf("## %s / %s\n", moduleName, file.FilePath))
-		text.WriteString("```\n")
-		text.WriteString(ExtractCodeContext(file.Content, query))
-		text.WriteString("```\n\n")
+	for _, f := range files {
+		text.WriteString(fmt.Sprintf("## %s / %s (%d match%s)\n\n", f.ModuleName, f.FilePath, len(f.Matches), pluralSuffixES(len(f.Matches))))
+		if len(f.Matches) == 0 {
+			text.WriteString("_Matched by the full-text index; the terms do not occur together on one line._\n\n")
+			continue
+		}
+
+		var order []string
+		groups := make(map[string][]CodeMatch)
+		for _, m := range f.Matches {
+			if _, ok := groups[m.Block]; !ok {
+				order = append(order, m.Block)
+			}
+			groups[m.Block] = append(groups[m.Block], m)
+		}
+
+		for _, block := range order {
+			matches := groups[block]
+			if len(order) > 1 || block != "" {
+				label := "outside any block"
+				if block != "" {
+					label = "inside " + block
+				}
+				text.WriteString(fmt.Sprintf("**%s** (%d match%s)\n", label, len(matches), pluralSuffixES(len(matches))))
+			}
+			text.WriteString("```\n")
+			text.WriteString(ExtractCodeContext(f.Content, matches, contextLines))
+			text.WriteString("```\n\n")
+		}
 	}
 
 	return text.String()
 }
 
-func ExtractCodeContext(content, query string) string {
+func pluralSuffixES(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "es"
+}
+
+// ExtractCodeContext renders every match with contextLines lines around it.
+// Overlapping windows are merged; matched lines show line:column.
+func ExtractCodeContext(content string, matches []CodeMatch, contextLines int) string {
 	var text strings.Builder
 	lines := strings.Split(content, "\n")
-	queryLower := strings.ToLower(query)
-
-	for i, line := range lines {
-		if strings.Contains(strings.ToLower(line), queryLower) {
-			start := max(i-2, 0)
-			end := min(i+3, len(lines))
-
-			for j := start; j < end; j++ {
-				if j == i {
-					text.WriteString(fmt.Sprintf("→ %d: %s\n", j+1, lines[j]))
-				} else {
-					text.WriteString(fmt.Sprintf("  %d: %s\n", j+1, lines[j]))
+
+	columns := make(map[int][]int)
+	var hitLines []int
+	for _, m := range matches {
+		if _, ok := columns[m.Line]; !ok {
+			hitLines = append(hitLines, m.Line)
+		}
+		columns[m.Line] = append(columns[m.Line], m.Column)
+	}
+
+	shownUntil := 0
+	for idx, line := range hitLines {
+		start := max(max(line-contextLines, 1), shownUntil+1)
+		end := min(line+contextLines, len(lines))
+		if idx > 0 && start > shownUntil+1 {
+			text.WriteString("...\n")
+		}
+		for j := start; j <= end; j++ {
+			if cols, ok := columns[j]; ok {
+				parts := make([]string, len(cols))
+				for k, c := range cols {
+					parts[k] = strconv.Itoa(c)
 				}
+				text.WriteString(fmt.Sprintf("→ %d:%s: %s\n", j, strings.Join(parts, ","), lines[j-1]))
+			} else {
+				text.WriteString(fmt.Sprintf("  %d: %s\n", j, lines[j-1]))
 			}
-			text.WriteString("...\n")
-			break
 		}
+		shownUntil = max(shownUntil, end)
 	}
 
 	return text.String()
@@ -63,12 +145,22 @@ func FileContent(moduleName, filePath, fileType string, sizeBytes int64, content
 	return text.String()
 }
 
-func VariableDefinition(moduleName, variableName, block string) string {
+func VariableDefinition(moduleName, variableName, block string, validations []database.ModuleCondition) string {
 	var text strings.Builder
 	text.WriteString(fmt.Sprintf("# %s / variable \"%s\"\n\n", moduleName, variableName))
 	text.WriteString("```hcl\n")
 	text.WriteString(block)
 	text.WriteString("\n```\n")
+	if len(validations) > 0 {
+		text.WriteString(fmt.Sprintf("\n## Validations (%d)\n\n", len(validations)))
+		for _, v := range validations {
+			text.WriteString(fmt.Sprintf("- `%s`", v.Condition))
+			if v.ErrorMessage != "" {
+				text.WriteString(fmt.Sprintf("\n  %s", v.ErrorMessage))
+			}
+			text.WriteString("\n")
+		}
+	}
 	return text.String()
 }
 
@@ -107,6 +199,41 @@ func PatternComparison(pattern string, results []PatternMatch, showFullBlocks bo
 	return text.String()
 }
 
+func PatternCounts(pattern string, counts map[string]int) string {
+	type row struct {
+		module string
+		count  int
+	}
+	rows := make([]row, 0, len(counts))
+	total := 0
+	for module, count := range counts {
+		rows = append(rows, row{module, count})
+		total += count
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].count == rows[j].count {
+			return rows[i].module < rows[j].module
+		}
+		return rows[i].count > rows[j].count
+	})
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("# Pattern Count: '%s'\n\n", pattern))
+	text.WriteString(fmt.Sprintf("Found %d matches across %d module%s\n\n", total, len(rows), pluralSuffix(len(rows))))
+
+	if len(rows) == 0 {
+		text.WriteString("No matches found.\n")
+		return text.String()
+	}
+
+	text.WriteString("| Module | Matches |\n")
+	text.WriteString("|--------|---------|\n")
+	for _, r := range rows {
+		text.WriteString(fmt.Sprintf("| %s | %d |\n", r.module, r.count))
+	}
+	return text.String()
+}
+
 type PatternMatch struct {
 	ModuleName string
 	FileName   string
@@ -115,6 +242,50 @@ type PatternMatch struct {
 	Summary    string
 }
 
+func AttributeValues(attribute, scope string, values []database.AttributeValueCount) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("# Attribute Values: '%s'\n\n", attribute))
+	if scope != "" {
+		text.WriteString(fmt.Sprintf("**Scope:** %s\n\n", scope))
+	}
+
+	if len(values) == 0 {
+		text.WriteString("No values found.\n")
+		return text.String()
+	}
+
+	total := 0
+	for _, v := range values {
+		total += v.Occurrences
+	}
+	text.WriteString(fmt.Sprintf("Found %d distinct value%s across %d occurrence%s\n\n", len(values), pluralSuffix(len(values)), total, pluralSuffix(total)))
+
+	text.WriteString("| Value | Kind | Occurrences | Modules |\n")
+	text.WriteString("|-------|------|-------------|---------|\n")
+	for _, v := range values {
+		kind := "expression"
+		if v.Literal {
+			kind = "literal"
+		}
+		modules := v.Modules
+		suffix := ""
+		if len(modules) > 5 {
+			suffix = fmt.Sprintf(", +%d more", len(modules)-5)
+			modules = modules[:5]
+		}
+		text.WriteString(fmt.Sprintf("| `%s` | %s | %d | %d (%s%s) |\n",
+			strings.ReplaceAll(strings.ReplaceAll(v.Value, "\n", " "), "|", "\\|"),
+			kind,
+			v.Occurrences,
+			v.ModuleCount,
+			strings.Join(modules, ", "),
+			suffix,
+		))
+	}
+
+	return text.String()
+}
+
 func formatFullBlocks(results []PatternMatch) string {
 	var text strings.Builder
 	for _, result := range results {
@@ -178,6 +349,88 @@ func ExampleList(moduleName string, exampleMap map[string][]string) string {
 	return text.String()
 }
 
+type ExampleInputView struct {
+	Variable string
+	Declared bool
+	Paths    []string
+}
+
+type ExampleCallView struct {
+	Name   string
+	Target string
+	File   string
+	Line   int
+	Inputs []ExampleInputView
+}
+
+type ExampleExplanationView struct {
+	Example string
+	Calls   []ExampleCallView
+}
+
+func ExampleExplanation(moduleName string, views []ExampleExplanationView) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("# Example Inputs for %s\n\n", moduleName))
+
+	if len(views) == 0 {
+		text.WriteString("No examples found for this module.\n")
+		return text.String()
+	}
+
+	for _, v := range views {
+		text.WriteString(fmt.Sprintf("## %s\n\n", v.Example))
+		if len(v.Calls) == 0 {
+			text.WriteString("Does not call the module.\n\n")
+			continue
+		}
+		for _, c := range v.Calls {
+			text.WriteString(fmt.Sprintf("**module \"%s\"** → %s (%s:%d)\n\n", c.Name, c.Target, c.File, c.Line))
+			for _, in := range c.Inputs {
+				text.WriteString(fmt.Sprintf("- `%s`", in.Variable))
+				if !in.Declared {
+					text.WriteString(" *(not a variable of the module)*")
+				}
+				text.WriteString("\n")
+				for _, p := range in.Paths {
+					text.WriteString(fmt.Sprintf("  - `%s`\n", p))
+				}
+			}
+			text.WriteString("\n")
+		}
+	}
+
+	return text.String()
+}
+
+type ExampleFeatureMatch struct {
+	ModuleName string
+	Example    string
+	Matched    []string
+	Paths      []string
+}
+
+func ExampleFeatureMatches(query string, terms []string, matches []ExampleFeatureMatch) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("# Examples for: '%s'\n\n", query))
+	text.WriteString(fmt.Sprintf("**Terms:** %s\n\n", strings.Join(terms, ", ")))
+
+	if len(matches) == 0 {
+		text.WriteString("No examples set inputs matching these terms.\n")
+		return text.String()
+	}
+
+	for _, m := range matches {
+		text.WriteString(fmt.Sprintf("## %s / %s (%d/%d terms)\n\n", m.ModuleName, m.Example, len(m.Matched), len(terms)))
+		text.WriteString(fmt.Sprintf("**Matched:** %s\n", strings.Join(m.Matched, ", ")))
+		for _, p := range m.Paths {
+			text.WriteString(fmt.Sprintf("- `%s`\n", p))
+		}
+		text.WriteString("\n")
+	}
+
+	return text.String()
+}
+
 func ExampleContent(moduleName, exampleName string, files []database.ModuleFile) string {
 	var text strings.Builder
 	text.WriteString(fmt.Sprintf("# %s / examples/%s\n\n", moduleName, exampleName))
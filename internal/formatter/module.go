@@ -3,6 +3,8 @@ package formatter
 
 import (
 	"fmt"
+	"path"
+	"sort"
 	"strings"
 	"time"
 
@@ -29,16 +31,28 @@ func ModuleList(modules []database.Module) string {
 	return text.String()
 }
 
-func SearchResults(query string, modules []database.Module) string {
+// RankedModule is a module search hit with its combined score and the signals
+// that produced it.
+type RankedModule struct {
+	Module  database.Module
+	Score   float64
+	Reasons []string
+}
+
+func SearchResults(query string, modules []RankedModule) string {
 	var text strings.Builder
 	text.WriteString(fmt.Sprintf("# Search Results for '%s' (%d matches)\n\n", query, len(modules)))
 
-	for _, module := range modules {
-		text.WriteString(fmt.Sprintf("**%s**\n", module.Name))
-		if module.Description != "" {
-			text.WriteString(fmt.Sprintf("  %s\n", module.Description))
+	for _, r := range modules {
+		text.WriteString(fmt.Sprintf("**%s** (score %.1f)\n", r.Module.Name, r.Score))
+		if r.Module.Description != "" {
+			text.WriteString(fmt.Sprintf("  %s\n", r.Module.Description))
+		}
+		text.WriteString(fmt.Sprintf("  Repo: %s\n", r.Module.RepoURL))
+		if len(r.Reasons) > 0 {
+			text.WriteString(fmt.Sprintf("  Why: %s\n", strings.Join(r.Reasons, "; ")))
 		}
-		text.WriteString(fmt.Sprintf("  Repo: %s\n\n", module.RepoURL))
+		text.WriteString("\n")
 	}
 
 	if len(modules) == 0 {
@@ -48,7 +62,154 @@ func SearchResults(query string, modules []database.Module) string {
 	return text.String()
 }
 
-func ModuleInfo(module *database.Module, variables []database.ModuleVariable, outputs []database.ModuleOutput, resources []database.ModuleResource, files []database.ModuleFile) string {
+// SemanticMatch is one embedded text of a module and its similarity to the
+// query.
+type SemanticMatch struct {
+	Kind       string
+	Ref        string
+	Content    string
+	Similarity float64
+}
+
+// SemanticHit is a module ranked by semantic_search: Score blends VectorScore
+// (best cosine similarity) with TextScore (BM25 relative to the best hit).
+type SemanticHit struct {
+	Module      database.Module
+	Score       float64
+	VectorScore float64
+	TextScore   float64
+	Matches     []SemanticMatch
+}
+
+func SemanticSearchResults(query, model string, hits []SemanticHit) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("# Semantic Search Results for '%s' (%d matches)\n\n", query, len(hits)))
+	text.WriteString(fmt.Sprintf("_Embedding model: %s_\n\n", model))
+
+	for _, h := range hits {
+		text.WriteString(fmt.Sprintf("**%s** (score %.2f = vector %.2f, text %.2f)\n", h.Module.Name, h.Score, h.VectorScore, h.TextScore))
+		if h.Module.Description != "" {
+			text.WriteString(fmt.Sprintf("  %s\n", h.Module.Description))
+		}
+		for _, m := range h.Matches {
+			snippet := m.Content
+			if runes := []rune(snippet); len(runes) > 160 {
+				snippet = string(runes[:160]) + "…"
+			}
+			text.WriteString(fmt.Sprintf("  - %s `%s` (%.2f): %s\n", m.Kind, m.Ref, m.Similarity, snippet))
+		}
+		text.WriteString("\n")
+	}
+
+	if len(hits) == 0 {
+		text.WriteString("No modules found matching your query.\n")
+	}
+
+	return text.String()
+}
+
+func declarationNoun(kind string, n int) string {
+	if kind == "data" {
+		if n == 1 {
+			return "data source"
+		}
+		return "data sources"
+	}
+	return "resource" + pluralSuffix(n)
+}
+
+// ModulesByType lists the modules declaring resources or data sources that
+// match pattern, with names, files and per-type counts.
+func ModulesByType(kind, pattern string, decls []database.TypeDeclaration) string {
+	var text strings.Builder
+
+	var order []string
+	byModule := make(map[string][]database.TypeDeclaration)
+	for _, d := range decls {
+		if _, ok := byModule[d.ModuleName]; !ok {
+			order = append(order, d.ModuleName)
+		}
+		byModule[d.ModuleName] = append(byModule[d.ModuleName], d)
+	}
+	sort.Strings(order)
+
+	text.WriteString(fmt.Sprintf("# Modules declaring %s '%s' (%d %s in %d module%s)\n\n",
+		declarationNoun(kind, 2), pattern, len(decls), declarationNoun(kind, len(decls)), len(order), pluralSuffix(len(order))))
+
+	if len(decls) == 0 {
+		text.WriteString(fmt.Sprintf("No %s match '%s'. Use * as a wildcard, e.g. azurerm_key_vault* or *_private_endpoint.\n", declarationNoun(kind, 2), pattern))
+		return text.String()
+	}
+
+	for _, name := range order {
+		entries := byModule[name]
+		counts := make(map[string]int)
+		var types []string
+		for _, d := range entries {
+			if counts[d.Type] == 0 {
+				types = append(types, d.Type)
+			}
+			counts[d.Type]++
+		}
+		summary := make([]string, len(types))
+		for i, t := range types {
+			summary[i] = fmt.Sprintf("%s ×%d", t, counts[t])
+		}
+
+		text.WriteString(fmt.Sprintf("## %s (%d)\n\n", name, len(entries)))
+		text.WriteString(fmt.Sprintf("%s\n\n", strings.Join(summary, ", ")))
+		text.WriteString("| Type | Name | File |\n")
+		text.WriteString("|------|------|------|\n")
+		for _, d := range entries {
+			file := d.File
+			if d.Example != "" {
+				file += fmt.Sprintf(" (example %s)", d.Example)
+			}
+			text.WriteString(fmt.Sprintf("| `%s` | `%s` | %s |\n", d.Type, d.Name, file))
+		}
+		text.WriteString("\n")
+	}
+
+	return text.String()
+}
+
+// TypeInventory lists the resource or data source types the catalog covers.
+func TypeInventory(kind, pattern string, inventory []database.TypeCoverage, total int) string {
+	var text strings.Builder
+	title := "Resource"
+	if kind == "data" {
+		title = "Data Source"
+	}
+	text.WriteString(fmt.Sprintf("# %s Type Inventory", title))
+	if pattern != "*" {
+		text.WriteString(fmt.Sprintf(" for '%s'", pattern))
+	}
+	text.WriteString(fmt.Sprintf(" (%d type%s)\n\n", total, pluralSuffix(total)))
+
+	if len(inventory) == 0 {
+		text.WriteString(fmt.Sprintf("No %s types found.\n", declarationNoun(kind, 1)))
+		return text.String()
+	}
+
+	text.WriteString("| Type | Modules | Declarations | Declared in |\n")
+	text.WriteString("|------|---------|--------------|-------------|\n")
+	for _, c := range inventory {
+		modules := append([]string(nil), c.Modules...)
+		sort.Strings(modules)
+		listed := modules
+		if len(listed) > 5 {
+			listed = append(listed[:5:5], fmt.Sprintf("+%d more", len(modules)-5))
+		}
+		text.WriteString(fmt.Sprintf("| `%s` | %d | %d | %s |\n", c.Type, len(modules), c.Count, strings.Join(listed, ", ")))
+	}
+	if len(inventory) < total {
+		text.WriteString(fmt.Sprintf("\n_Showing the %d most widely used of %d types._\n", len(inventory), total))
+	}
+
+	return text.String()
+}
+
+func ModuleInfo(module *database.Module, variables []database.ModuleVariable, outputs []database.ModuleOutput, resources []database.ModuleResource, conditions []database.ModuleCondition, files []database.ModuleFile) string {
 	var text strings.Builder
 	text.WriteString(fmt.Sprintf("# %s\n\n", module.Name))
 
@@ -72,6 +233,10 @@ func ModuleInfo(module *database.Module, variables []database.ModuleVariable, ou
 		text.WriteString(ResourcesSection(resources))
 	}
 
+	if len(conditions) > 0 {
+		text.WriteString(ConditionsSection(conditions))
+	}
+
 	if len(files) > 0 {
 		text.WriteString(FilesSection(files))
 	}
@@ -166,6 +331,264 @@ func ResourcesSection(resources []database.ModuleResource) string {
 	return text.String()
 }
 
+// SubmodulesSection lists the submodules of a repository module; parentName is
+// set instead when the module itself is a submodule.
+func SubmodulesSection(submodules []database.Module, parentName string) string {
+	var text strings.Builder
+	if parentName != "" {
+		text.WriteString(fmt.Sprintf("**Submodule of:** %s\n\n", parentName))
+	}
+	if len(submodules) == 0 {
+		return text.String()
+	}
+	text.WriteString(fmt.Sprintf("## Submodules (%d)\n\n", len(submodules)))
+	for _, m := range submodules {
+		_, sub, _ := strings.Cut(m.Name, "//")
+		text.WriteString(fmt.Sprintf("- `%s` (%s)\n", path.Base(sub), m.Name))
+	}
+	text.WriteString("\nPass `submodule` alongside `module_name` to inspect one.\n\n")
+	return text.String()
+}
+
+type ExampleScopeView struct {
+	Example   database.ModuleExample
+	Variables []database.ModuleVariable
+	Resources []database.ModuleResource
+}
+
+// ExamplesSection lists the module's examples. With detailed set, the
+// variables and resources each example declares are shown as well.
+func ExamplesSection(views []ExampleScopeView, detailed bool) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("## Examples (%d)\n\n", len(views)))
+	for _, v := range views {
+		if !detailed {
+			text.WriteString(fmt.Sprintf("- `%s`\n", v.Example.Name))
+			continue
+		}
+		text.WriteString(fmt.Sprintf("### %s\n\n", v.Example.Name))
+		text.WriteString(fmt.Sprintf("**Path:** %s\n", v.Example.Path))
+		if len(v.Variables) > 0 {
+			names := make([]string, 0, len(v.Variables))
+			for _, variable := range v.Variables {
+				names = append(names, variable.Name)
+			}
+			text.WriteString(fmt.Sprintf("**Variables:** %s\n", strings.Join(names, ", ")))
+		}
+		text.WriteString("\n")
+		for _, r := range v.Resources {
+			text.WriteString(fmt.Sprintf("- `%s.%s`", r.ResourceType, r.ResourceName))
+			if r.SourceFile != "" {
+				text.WriteString(fmt.Sprintf(" (in %s)", r.SourceFile))
+			}
+			text.WriteString("\n")
+		}
+		text.WriteString("\n")
+	}
+	if !detailed {
+		text.WriteString("\nExample variables and resources are not part of the module interface; request them with include_examples.\n")
+	}
+	text.WriteString("\n")
+	return text.String()
+}
+
+type ModuleCoverageView struct {
+	ModuleName        string
+	HasExamples       bool
+	Examples          []string
+	Variables         int
+	UntestedVariables []string
+	NestedPaths       int
+	UntestedPaths     []string
+	Opaque            []string
+}
+
+func coverageCell(total, untested int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d/%d (%d%%)", total-untested, total, (total-untested)*100/total)
+}
+
+// ExampleCoverageCatalog summarises example coverage for many modules, listing
+// modules that no example calls at the end.
+func ExampleCoverageCatalog(views []ModuleCoverageView) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("# Example Coverage (%d module%s)\n\n", len(views), pluralSuffix(len(views))))
+
+	var without []ModuleCoverageView
+	var covered []ModuleCoverageView
+	for _, v := range views {
+		if len(v.Examples) == 0 {
+			without = append(without, v)
+		} else {
+			covered = append(covered, v)
+		}
+	}
+
+	if len(covered) > 0 {
+		text.WriteString("| Module | Examples | Variables set | Optional attributes set |\n")
+		text.WriteString("|--------|----------|---------------|-------------------------|\n")
+		for _, v := range covered {
+			text.WriteString(fmt.Sprintf("| %s | %d | %s | %s |\n",
+				v.ModuleName,
+				len(v.Examples),
+				coverageCell(v.Variables, len(v.UntestedVariables)),
+				coverageCell(v.NestedPaths, len(v.UntestedPaths)),
+			))
+		}
+		text.WriteString("\n")
+	}
+
+	if len(without) > 0 {
+		text.WriteString(fmt.Sprintf("## Modules Without Example Usage (%d)\n\n", len(without)))
+		for _, v := range without {
+			note := ""
+			if v.HasExamples {
+				note = " (has examples, none call the module)"
+			}
+			text.WriteString(fmt.Sprintf("- %s%s\n", v.ModuleName, note))
+		}
+		text.WriteString("\n")
+	}
+
+	return text.String()
+}
+
+// ExampleCoverageDetail lists the inputs of one module that no example sets.
+func ExampleCoverageDetail(v ModuleCoverageView) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("# Example Coverage: %s\n\n", v.ModuleName))
+
+	if len(v.Examples) == 0 {
+		text.WriteString("No example calls this module, so none of its inputs have reference usage.\n")
+		return text.String()
+	}
+
+	text.WriteString(fmt.Sprintf("**Examples:** %s\n", strings.Join(v.Examples, ", ")))
+	text.WriteString(fmt.Sprintf("**Variables set:** %s\n", coverageCell(v.Variables, len(v.UntestedVariables))))
+	text.WriteString(fmt.Sprintf("**Optional attributes set:** %s\n\n", coverageCell(v.NestedPaths, len(v.UntestedPaths))))
+
+	if len(v.UntestedVariables) > 0 {
+		text.WriteString(fmt.Sprintf("## Untested Variables (%d)\n\n", len(v.UntestedVariables)))
+		for _, name := range v.UntestedVariables {
+			text.WriteString(fmt.Sprintf("- `%s`\n", name))
+		}
+		text.WriteString("\n")
+	}
+
+	if len(v.UntestedPaths) > 0 {
+		text.WriteString(fmt.Sprintf("## Untested Optional Attributes (%d)\n\n", len(v.UntestedPaths)))
+		for _, p := range v.UntestedPaths {
+			text.WriteString(fmt.Sprintf("- `%s`\n", p))
+		}
+		text.WriteString("\n")
+	}
+
+	if len(v.Opaque) > 0 {
+		text.WriteString(fmt.Sprintf("**Not inspectable:** %s (set from references, so nested attributes are not visible)\n", strings.Join(v.Opaque, ", ")))
+	}
+
+	return text.String()
+}
+
+func ConditionsSection(conditions []database.ModuleCondition) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("## Validations & Conditions (%d)\n\n", len(conditions)))
+	for _, c := range conditions {
+		text.WriteString(fmt.Sprintf("- **%s %s** %s: `%s`", c.OwnerType, c.OwnerName, c.Kind, c.Condition))
+		if c.ErrorMessage != "" {
+			text.WriteString(fmt.Sprintf("\n  %s", c.ErrorMessage))
+		}
+		text.WriteString("\n")
+	}
+	text.WriteString("\n")
+	return text.String()
+}
+
+func ConditionSearchResults(query string, conditions []database.ModuleCondition, getModuleName func(int64) string) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("# Validation Search Results for '%s' (%d matches)\n\n", query, len(conditions)))
+
+	if len(conditions) == 0 {
+		text.WriteString("No validations or conditions found matching your query.\n")
+		return text.String()
+	}
+
+	for _, c := range conditions {
+		text.WriteString(fmt.Sprintf("## %s / %s %s (%s)\n", getModuleName(c.ModuleID), c.OwnerType, c.OwnerName, c.Kind))
+		if c.SourceFile != "" {
+			text.WriteString(fmt.Sprintf("- **File:** %s\n", c.SourceFile))
+		}
+		text.WriteString(fmt.Sprintf("- **Condition:** `%s`\n", c.Condition))
+		if c.ErrorMessage != "" {
+			text.WriteString(fmt.Sprintf("- **Message:** %s\n", c.ErrorMessage))
+		}
+		text.WriteString("\n")
+	}
+
+	return text.String()
+}
+
+type ModuleMigrationView struct {
+	ModuleName string
+	Migrations []database.ModuleMigration
+}
+
+func AddressMigrations(views []ModuleMigrationView) string {
+	var text strings.Builder
+
+	total := 0
+	for _, v := range views {
+		total += len(v.Migrations)
+	}
+
+	text.WriteString(fmt.Sprintf("# Address Migrations (%d across %d module%s)\n\n", total, len(views), pluralSuffix(len(views))))
+
+	if total == 0 {
+		text.WriteString("No moved, import or removed blocks found.\n")
+		return text.String()
+	}
+
+	for _, view := range views {
+		text.WriteString(fmt.Sprintf("## %s\n\n", view.ModuleName))
+		text.WriteString("| Kind | From | To | Notes | File |\n")
+		text.WriteString("|------|------|----|-------|------|\n")
+		for _, m := range view.Migrations {
+			notes := ""
+			switch m.Kind {
+			case "import":
+				notes = fmt.Sprintf("id: %s", m.ImportID)
+			case "removed":
+				if m.Destroy {
+					notes = "destroys object"
+				} else {
+					notes = "forgets object (destroy = false)"
+				}
+			case "moved":
+				notes = "state move, no replacement"
+			}
+			text.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s |\n",
+				m.Kind,
+				migrationCell(m.FromAddress),
+				migrationCell(m.ToAddress),
+				strings.ReplaceAll(notes, "|", "\\|"),
+				m.SourceFile,
+			))
+		}
+		text.WriteString("\n")
+	}
+
+	return text.String()
+}
+
+func migrationCell(addr string) string {
+	if addr == "" {
+		return "—"
+	}
+	return "`" + strings.ReplaceAll(addr, "|", "\\|") + "`"
+}
+
 func FilesSection(files []database.ModuleFile) string {
 	var text strings.Builder
 	text.WriteString(fmt.Sprintf("## Files (%d)\n\n", len(files)))
@@ -0,0 +1,70 @@
+package formatter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dkooll/wamcp/internal/database"
+)
+
+const queryCellChars = 200
+
+// QueryResults renders the rows of an ad-hoc query as a markdown table. Long
+// cells are cut to keep the response readable.
+func QueryResults(query string, result *database.QueryResult) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("# Query Results (%d row%s)\n\n", len(result.Rows), pluralSuffix(len(result.Rows))))
+	text.WriteString(fmt.Sprintf("```sql\n%s\n```\n\n", strings.TrimSpace(query)))
+
+	if len(result.Rows) == 0 {
+		text.WriteString("No rows returned.\n")
+		return text.String()
+	}
+
+	text.WriteString("| " + strings.Join(result.Columns, " | ") + " |\n")
+	text.WriteString("|" + strings.Repeat("---|", len(result.Columns)) + "\n")
+	for _, row := range result.Rows {
+		cells := make([]string, len(row))
+		for i, v := range row {
+			v = strings.Join(strings.Fields(v), " ")
+			if runes := []rune(v); len(runes) > queryCellChars {
+				v = string(runes[:queryCellChars]) + "…"
+			}
+			cells[i] = strings.ReplaceAll(v, "|", "\\|")
+		}
+		text.WriteString("| " + strings.Join(cells, " | ") + " |\n")
+	}
+
+	if result.Truncated {
+		text.WriteString(fmt.Sprintf("\n_Note: Stopped at %d rows; add a LIMIT, aggregate, or raise max_rows._\n", len(result.Rows)))
+	}
+	return text.String()
+}
+
+// SchemaDescription lists the tables query_index may read.
+func SchemaDescription(tables []database.TableSchema) string {
+	var text strings.Builder
+	text.WriteString("# Index Schema\n\n")
+	text.WriteString("Tables available to `query_index` (SELECT only). Rows with a NULL `example_id` belong to module code; other rows to the example with that id in `module_examples`.\n\n")
+
+	for _, t := range tables {
+		text.WriteString(fmt.Sprintf("## %s (%d row%s)\n\n", t.Name, t.Rows, pluralSuffix(t.Rows)))
+		text.WriteString("| Column | Type | Notes |\n")
+		text.WriteString("|--------|------|-------|\n")
+		for _, c := range t.Columns {
+			var notes []string
+			if c.PrimaryKey {
+				notes = append(notes, "primary key")
+			}
+			if c.NotNull {
+				notes = append(notes, "not null")
+			}
+			text.WriteString(fmt.Sprintf("| %s | %s | %s |\n", c.Name, c.Type, strings.Join(notes, ", ")))
+		}
+		if len(t.Indexes) > 0 {
+			text.WriteString(fmt.Sprintf("\nIndexes: %s\n", strings.Join(t.Indexes, ", ")))
+		}
+		text.WriteString("\n")
+	}
+	return text.String()
+}
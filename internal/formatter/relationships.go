@@ -2,7 +2,6 @@ package formatter
 
 import (
 	"fmt"
-	"sort"
 	"strings"
 
 	"github.com/dkooll/wamcp/internal/database"
@@ -29,10 +28,6 @@ func RelationshipAnalysisAcross(term string, views []ModuleRelationshipView) str
 	text.WriteString(fmt.Sprintf("# Relationship Analysis for '%s' across %d module%s\n\n", term, len(views), pluralSuffix(len(views))))
 	text.WriteString(fmt.Sprintf("Found %d relationship%s.\n\n", totalMatches, pluralSuffix(totalMatches)))
 
-	sort.SliceStable(views, func(i, j int) bool {
-		return views[i].ModuleName < views[j].ModuleName
-	})
-
 	for idx, view := range views {
 		if idx > 0 {
 			text.WriteString("\n")
@@ -54,26 +49,13 @@ func renderRelationshipSection(headingPrefix, moduleName, term string, rels []da
 		return text.String()
 	}
 
-	sort.SliceStable(rels, func(i, j int) bool {
-		if rels[i].FilePath == rels[j].FilePath {
-			if rels[i].BlockType == rels[j].BlockType {
-				if rels[i].AttributePath == rels[j].AttributePath {
-					return rels[i].ReferenceName < rels[j].ReferenceName
-				}
-				return rels[i].AttributePath < rels[j].AttributePath
-			}
-			return rels[i].BlockType < rels[j].BlockType
-		}
-		return rels[i].FilePath < rels[j].FilePath
-	})
-
 	blockHeading := headingPrefix + "#"
 	if len(blockHeading) > 6 {
 		blockHeading = "######"
 	}
 
 	for _, rel := range rels {
-		blockDesc := describeBlock(rel.BlockType, rel.BlockLabels)
+		blockDesc := DescribeBlock(rel.BlockType, rel.BlockLabels)
 		text.WriteString(fmt.Sprintf("%s %s — `%s`\n", blockHeading, blockDesc, rel.AttributePath))
 
 		file, ok := files[rel.FilePath]
@@ -87,7 +69,11 @@ func renderRelationshipSection(headingPrefix, moduleName, term string, rels []da
 			text.WriteString(fmt.Sprintf("- **File:** %s\n", rel.FilePath))
 		}
 
-		text.WriteString(fmt.Sprintf("- **Reference:** `%s` (%s)\n\n", rel.ReferenceName, rel.ReferenceType))
+		text.WriteString(fmt.Sprintf("- **Reference:** `%s` (%s)\n", rel.ReferenceName, rel.ReferenceType))
+		if rel.IteratorSource != "" {
+			text.WriteString(fmt.Sprintf("- **Iterates:** `%s`\n", rel.IteratorSource))
+		}
+		text.WriteString("\n")
 
 		if snippet != "" {
 			text.WriteString("```hcl\n")
@@ -101,7 +87,204 @@ func renderRelationshipSection(headingPrefix, moduleName, term string, rels []da
 	return text.String()
 }
 
-func describeBlock(blockType, labels string) string {
+type DataFlowHop struct {
+	Target    string
+	Via       string
+	File      string
+	Line      int
+	Iteration bool
+}
+
+type DataFlowPath struct {
+	Hops []DataFlowHop
+}
+
+func DataFlowTrace(moduleName, from, to string, paths []DataFlowPath, truncated bool) string {
+	var text strings.Builder
+	if to != "" {
+		text.WriteString(fmt.Sprintf("# Data Flow from `%s` to `%s` in %s\n\n", from, to, moduleName))
+	} else {
+		text.WriteString(fmt.Sprintf("# Data Flow from `%s` in %s\n\n", from, moduleName))
+	}
+	text.WriteString(fmt.Sprintf("Found %d path%s", len(paths), pluralSuffix(len(paths))))
+	if truncated {
+		text.WriteString(" (limit reached, more paths exist)")
+	}
+	text.WriteString(".\n\n")
+
+	if len(paths) == 0 {
+		text.WriteString("No reference chain was found. Symbols passed through functions or for expressions are followed as whole values only.\n")
+		return text.String()
+	}
+
+	for i, p := range paths {
+		last := p.Hops[len(p.Hops)-1]
+		text.WriteString(fmt.Sprintf("## Path %d → `%s`\n\n", i+1, last.Target))
+		text.WriteString(fmt.Sprintf("1. `%s`\n", from))
+		for j, hop := range p.Hops {
+			note := ""
+			if hop.Iteration {
+				note = " (iterates)"
+			}
+			text.WriteString(fmt.Sprintf("%d. `%s`%s via `%s` — %s:%d\n", j+2, hop.Target, note, hop.Via, hop.File, hop.Line))
+		}
+		text.WriteString("\n")
+	}
+
+	return text.String()
+}
+
+type GraphNode struct {
+	ID   string
+	Kind string
+}
+
+type GraphEdge struct {
+	From   string
+	To     string
+	Labels []string
+}
+
+func ModuleGraph(moduleName, format string, nodes []GraphNode, edges []GraphEdge) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("# Dependency Graph for %s\n\n", moduleName))
+	text.WriteString(fmt.Sprintf("%d node%s, %d edge%s.\n\n", len(nodes), pluralSuffix(len(nodes)), len(edges), pluralSuffix(len(edges))))
+
+	if format == "mermaid" {
+		text.WriteString("```mermaid\n")
+		text.WriteString(mermaidGraph(nodes, edges))
+	} else {
+		text.WriteString("```dot\n")
+		text.WriteString(dotGraph(moduleName, nodes, edges))
+	}
+	text.WriteString("```\n")
+	return text.String()
+}
+
+func dotGraph(moduleName string, nodes []GraphNode, edges []GraphEdge) string {
+	shapes := map[string]string{
+		"variable": "invhouse",
+		"local":    "note",
+		"data":     "cylinder",
+		"resource": "box",
+		"module":   "component",
+		"output":   "house",
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("digraph %q {\n", moduleName))
+	text.WriteString("  rankdir=LR;\n")
+	for _, n := range nodes {
+		text.WriteString(fmt.Sprintf("  %q [shape=%s];\n", n.ID, shapes[n.Kind]))
+	}
+	for _, e := range edges {
+		if len(e.Labels) > 0 {
+			text.WriteString(fmt.Sprintf("  %q -> %q [label=%q];\n", e.From, e.To, strings.Join(e.Labels, ", ")))
+		} else {
+			text.WriteString(fmt.Sprintf("  %q -> %q;\n", e.From, e.To))
+		}
+	}
+	text.WriteString("}\n")
+	return text.String()
+}
+
+func mermaidGraph(nodes []GraphNode, edges []GraphEdge) string {
+	shapes := map[string][2]string{
+		"variable": {"([", "])"},
+		"local":    {"{{", "}}"},
+		"data":     {"[(", ")]"},
+		"resource": {"[", "]"},
+		"module":   {"[[", "]]"},
+		"output":   {">", "]"},
+	}
+	quote := func(s string) string {
+		return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+	}
+
+	var text strings.Builder
+	text.WriteString("flowchart LR\n")
+	ids := make(map[string]string, len(nodes))
+	for i, n := range nodes {
+		id := fmt.Sprintf("n%d", i)
+		ids[n.ID] = id
+		shape, ok := shapes[n.Kind]
+		if !ok {
+			shape = shapes["resource"]
+		}
+		text.WriteString(fmt.Sprintf("  %s%s%s%s\n", id, shape[0], quote(n.ID), shape[1]))
+	}
+	for _, e := range edges {
+		if len(e.Labels) > 0 {
+			text.WriteString(fmt.Sprintf("  %s -->|%s| %s\n", ids[e.From], quote(strings.Join(e.Labels, ", ")), ids[e.To]))
+		} else {
+			text.WriteString(fmt.Sprintf("  %s --> %s\n", ids[e.From], ids[e.To]))
+		}
+	}
+	return text.String()
+}
+
+type RelationshipWiring struct {
+	Module    string
+	Block     string
+	Kind      string
+	Reference string
+	Source    string
+	File      string
+	Line      int
+}
+
+// RelationshipAlignment is one attribute aligned across modules. Status is
+// "different sources", "different symbols", "partial" or "identical".
+type RelationshipAlignment struct {
+	Key     string
+	Status  string
+	Wiring  []RelationshipWiring
+	Missing []string
+}
+
+func RelationshipComparison(term string, modules []string, alignments []RelationshipAlignment) string {
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf("# Relationship Comparison for '%s'\n\n", term))
+	text.WriteString(fmt.Sprintf("**Modules:** %s\n\n", strings.Join(modules, ", ")))
+
+	if len(alignments) == 0 {
+		text.WriteString("No matching relationships found in any of the modules.\n")
+		return text.String()
+	}
+
+	counts := make(map[string]int)
+	for _, a := range alignments {
+		counts[a.Status]++
+	}
+	text.WriteString(fmt.Sprintf("Aligned %d attribute%s: %d wired from different sources, %d with different symbols, %d present in only some modules, %d identical.\n\n",
+		len(alignments), pluralSuffix(len(alignments)), counts["different sources"], counts["different symbols"], counts["partial"], counts["identical"]))
+
+	for _, a := range alignments {
+		text.WriteString(fmt.Sprintf("## `%s` — %s\n\n", a.Key, a.Status))
+		text.WriteString("| Module | Block | Kind | Reference | Location |\n")
+		text.WriteString("|--------|-------|------|-----------|----------|\n")
+		for _, w := range a.Wiring {
+			ref := fmt.Sprintf("`%s`", w.Reference)
+			if w.Source != "" {
+				ref += fmt.Sprintf(" ← `%s`", strings.ReplaceAll(w.Source, "|", "\\|"))
+			}
+			location := w.File
+			if w.Line > 0 {
+				location = fmt.Sprintf("%s:%d", w.File, w.Line)
+			}
+			text.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s |\n", w.Module, w.Block, w.Kind, ref, location))
+		}
+		for _, m := range a.Missing {
+			text.WriteString(fmt.Sprintf("| %s | — | — | _not referenced_ | |\n", m))
+		}
+		text.WriteString("\n")
+	}
+
+	return text.String()
+}
+
+// DescribeBlock renders a block for display, e.g. "resource azurerm_subnet this".
+func DescribeBlock(blockType, labels string) string {
 	if labels == "" {
 		return blockType
 	}
@@ -5,6 +5,7 @@ import (
 	"archive/tar"
 	"bytes"
 	"compress/gzip"
+	"database/sql"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -334,7 +335,7 @@ func (s *Syncer) syncRepository(repo GitHubRepo) error {
 		return err
 	}
 
-	if err := s.clearExistingModuleData(moduleID, repo.Name); err != nil {
+	if err := s.clearExistingModuleData(moduleID); err != nil {
 		log.Printf("Warning: failed to clear old data for %s: %v", repo.Name, err)
 	}
 
@@ -398,7 +399,7 @@ func (s *Syncer) insertModuleMetadata(repo GitHubRepo) (int64, error) {
 	return moduleID, nil
 }
 
-func (s *Syncer) clearExistingModuleData(moduleID int64, repoName string) error {
+func (s *Syncer) clearExistingModuleData(moduleID int64) error {
 	existingModule, _ := s.db.GetModuleByID(moduleID)
 	if existingModule != nil && existingModule.ID != 0 {
 		if err := s.db.ClearModuleData(moduleID); err != nil {
@@ -406,7 +407,7 @@ func (s *Syncer) clearExistingModuleData(moduleID int64, repoName string) error
 		}
 	}
 
-	return s.db.DeleteChildModules(repoName)
+	return s.db.DeleteChildModules(moduleID)
 }
 
 func (s *Syncer) syncReadme(moduleID int64, repo GitHubRepo) error {
@@ -677,7 +678,7 @@ func (s *Syncer) resolveTargetModule(moduleID int64, relativePath string, repo G
 		return subID, false
 	}
 
-	childID, err := s.ensureSubmoduleModule(repo, subKey)
+	childID, err := s.ensureSubmoduleModule(moduleID, repo, subKey)
 	if err != nil {
 		log.Printf("Warning: failed to ensure submodule %s for %s: %v", subKey, repo.Name, err)
 		return moduleID, false
@@ -733,7 +734,7 @@ func shouldSkipPath(relativePath string) bool {
 	return false
 }
 
-func (s *Syncer) ensureSubmoduleModule(repo GitHubRepo, subKey string) (int64, error) {
+func (s *Syncer) ensureSubmoduleModule(parentID int64, repo GitHubRepo, subKey string) (int64, error) {
 	submoduleName := fmt.Sprintf("%s//modules/%s", repo.Name, subKey)
 	module := &database.Module{
 		Name:        submoduleName,
@@ -741,6 +742,8 @@ func (s *Syncer) ensureSubmoduleModule(repo GitHubRepo, subKey string) (int64, e
 		Description: fmt.Sprintf("Submodule %s of %s", subKey, repo.Name),
 		RepoURL:     repo.HTMLURL,
 		LastUpdated: repo.UpdatedAt,
+		ParentID:    parentID,
+		Subpath:     "modules/" + subKey,
 	}
 
 	moduleID, err := s.db.InsertModule(module)
@@ -800,12 +803,16 @@ func (s *Syncer) parseAndIndexTerraformFiles(moduleID int64) error {
 		return err
 	}
 
+	exampleIDs := s.indexExamples(moduleID, files)
+
 	for _, file := range files {
 		if file.FileType != "terraform" {
 			continue
 		}
 
-		if err := s.parseAndIndexTerraformFile(moduleID, file); err != nil {
+		dir, _ := ExampleFromPath(file.FilePath)
+		exampleID := exampleIDs[dir]
+		if err := s.parseAndIndexTerraformFile(moduleID, exampleID, file); err != nil {
 			log.Printf("Warning: failed to parse %s: %v", file.FilePath, err)
 		}
 	}
@@ -813,62 +820,149 @@ func (s *Syncer) parseAndIndexTerraformFiles(moduleID int64) error {
 	return nil
 }
 
-func (s *Syncer) parseAndIndexTerraformFile(moduleID int64, file database.ModuleFile) error {
+// indexExamples records one module_examples row per examples/<name>/ directory
+// and returns the example IDs keyed by directory.
+func (s *Syncer) indexExamples(moduleID int64, files []database.ModuleFile) map[string]int64 {
+	ids := make(map[string]int64)
+	names := make(map[string]string)
+	contents := make(map[string]string)
+	var dirs []string
+
+	for _, file := range files {
+		dir, name := ExampleFromPath(file.FilePath)
+		if dir == "" {
+			continue
+		}
+		if _, ok := names[dir]; !ok {
+			dirs = append(dirs, dir)
+			names[dir] = name
+		}
+		if file.FileName == "main.tf" && path.Dir(file.FilePath) == dir {
+			contents[dir] = file.Content
+		}
+	}
+
+	for _, dir := range dirs {
+		id, err := s.db.InsertExample(&database.ModuleExample{
+			ModuleID: moduleID,
+			Name:     names[dir],
+			Path:     dir,
+			Content:  contents[dir],
+		})
+		if err != nil {
+			log.Printf("Warning: failed to insert example %s: %v", dir, err)
+			continue
+		}
+		ids[dir] = id
+	}
+
+	return ids
+}
+
+// ExampleFromPath returns the directory and name of the example a file
+// belongs to. Examples live in examples/<name>/ at the repository root, and
+// submodule files keep their repository path, so a submodule's examples live
+// in modules/<sub>/examples/<name>/. Module code returns empty strings.
+func ExampleFromPath(filePath string) (dir, name string) {
+	parts := strings.Split(filePath, "/")
+	for i := 0; i+2 < len(parts); i += 2 {
+		if parts[i] == "examples" {
+			return strings.Join(parts[:i+2], "/"), parts[i+1]
+		}
+		if parts[i] != "modules" {
+			break
+		}
+	}
+	return "", ""
+}
+
+// parseAndIndexTerraformFile indexes a single file. Files that belong to an
+// example are stored under exampleID so they stay out of the module's own
+// interface; validations and address migrations are only indexed for module code.
+func (s *Syncer) parseAndIndexTerraformFile(moduleID, exampleID int64, file database.ModuleFile) error {
 	body, err := parseHCLBody(file.Content, file.FilePath)
 	if err != nil {
 		return err
 	}
 
-	s.indexVariables(moduleID, body, file.Content)
-	s.indexOutputs(moduleID, body, file.Content)
-	s.indexResources(moduleID, body, file.FileName)
-	s.indexDataSources(moduleID, body, file.FileName)
-	s.indexHCLBlocks(moduleID, file.FilePath, body)
-	s.indexRelationships(moduleID, file.FilePath, body)
+	s.indexVariables(moduleID, exampleID, body, file.Content)
+	s.indexOutputs(moduleID, exampleID, body, file.Content)
+	s.indexResources(moduleID, exampleID, body, file.FileName)
+	s.indexDataSources(moduleID, exampleID, body, file.FileName)
+	if exampleID == 0 {
+		s.indexConditions(moduleID, body, file.Content, file.FileName)
+		s.indexMigrations(moduleID, body, file.Content, file.FileName)
+	}
+	s.indexHCLBlocks(moduleID, exampleID, file.FilePath, body, file.Content)
+	s.indexRelationships(moduleID, exampleID, file.FilePath, body, file.Content)
 
 	return nil
 }
 
-func (s *Syncer) indexVariables(moduleID int64, body *hclsyntax.Body, content string) {
+func (s *Syncer) indexVariables(moduleID, exampleID int64, body *hclsyntax.Body, content string) {
 	variables := extractVariables(body, content)
 	for _, v := range variables {
 		v.ModuleID = moduleID
+		v.ExampleID = exampleID
 		if err := s.db.InsertVariable(&v); err != nil {
 			log.Printf("Warning: failed to insert variable: %v", err)
 		}
 	}
 }
 
-func (s *Syncer) indexOutputs(moduleID int64, body *hclsyntax.Body, content string) {
+func (s *Syncer) indexOutputs(moduleID, exampleID int64, body *hclsyntax.Body, content string) {
 	outputs := extractOutputs(body, content)
 	for _, o := range outputs {
 		o.ModuleID = moduleID
+		o.ExampleID = exampleID
 		if err := s.db.InsertOutput(&o); err != nil {
 			log.Printf("Warning: failed to insert output: %v", err)
 		}
 	}
 }
 
-func (s *Syncer) indexResources(moduleID int64, body *hclsyntax.Body, fileName string) {
+func (s *Syncer) indexResources(moduleID, exampleID int64, body *hclsyntax.Body, fileName string) {
 	resources := extractResources(body, fileName)
 	for _, r := range resources {
 		r.ModuleID = moduleID
+		r.ExampleID = exampleID
 		if err := s.db.InsertResource(&r); err != nil {
 			log.Printf("Warning: failed to insert resource: %v", err)
 		}
 	}
 }
 
-func (s *Syncer) indexDataSources(moduleID int64, body *hclsyntax.Body, fileName string) {
+func (s *Syncer) indexDataSources(moduleID, exampleID int64, body *hclsyntax.Body, fileName string) {
 	dataSources := extractDataSources(body, fileName)
 	for _, d := range dataSources {
 		d.ModuleID = moduleID
+		d.ExampleID = exampleID
 		if err := s.db.InsertDataSource(&d); err != nil {
 			log.Printf("Warning: failed to insert data source: %v", err)
 		}
 	}
 }
 
+func (s *Syncer) indexConditions(moduleID int64, body *hclsyntax.Body, content, fileName string) {
+	conditions := extractConditions(body, content, fileName)
+	for _, c := range conditions {
+		c.ModuleID = moduleID
+		if err := s.db.InsertCondition(&c); err != nil {
+			log.Printf("Warning: failed to insert condition: %v", err)
+		}
+	}
+}
+
+func (s *Syncer) indexMigrations(moduleID int64, body *hclsyntax.Body, content, fileName string) {
+	migrations := extractMigrations(body, content, fileName)
+	for _, m := range migrations {
+		m.ModuleID = moduleID
+		if err := s.db.InsertMigration(&m); err != nil {
+			log.Printf("Warning: failed to insert migration: %v", err)
+		}
+	}
+}
+
 func parseHCLBody(content string, filename string) (*hclsyntax.Body, error) {
 	parser := hclparse.NewParser()
 	file, diags := parser.ParseHCL([]byte(content), filename)
@@ -994,6 +1088,127 @@ func extractDataSources(body *hclsyntax.Body, fileName string) []database.Module
 	return dataSources
 }
 
+// extractConditions collects variable validation rules, resource and data source
+// lifecycle preconditions/postconditions, and output preconditions.
+func extractConditions(body *hclsyntax.Body, content, fileName string) []database.ModuleCondition {
+	var conditions []database.ModuleCondition
+
+	collect := func(bdy *hclsyntax.Body, kinds map[string]struct{}, ownerType, ownerName string) {
+		for _, nb := range bdy.Blocks {
+			if _, ok := kinds[nb.Type]; !ok {
+				continue
+			}
+			attr, ok := nb.Body.Attributes["condition"]
+			if !ok {
+				continue
+			}
+			condition := database.ModuleCondition{
+				Kind:       nb.Type,
+				OwnerType:  ownerType,
+				OwnerName:  ownerName,
+				Condition:  strings.TrimSpace(expressionText(content, attr.Expr.Range())),
+				SourceFile: fileName,
+			}
+			if msg, ok := nb.Body.Attributes["error_message"]; ok {
+				condition.ErrorMessage = conditionMessage(msg, content)
+			}
+			conditions = append(conditions, condition)
+		}
+	}
+
+	validation := map[string]struct{}{"validation": {}}
+	checks := map[string]struct{}{"precondition": {}, "postcondition": {}}
+	asserts := map[string]struct{}{"assert": {}}
+
+	for _, block := range body.Blocks {
+		switch block.Type {
+		case "variable":
+			if len(block.Labels) > 0 {
+				collect(block.Body, validation, "variable", block.Labels[0])
+			}
+		case "output":
+			if len(block.Labels) > 0 {
+				collect(block.Body, checks, "output", block.Labels[0])
+			}
+		case "check":
+			if len(block.Labels) > 0 {
+				collect(block.Body, asserts, "check", block.Labels[0])
+			}
+		case "resource", "data":
+			if len(block.Labels) < 2 {
+				continue
+			}
+			for _, nb := range block.Body.Blocks {
+				if nb.Type == "lifecycle" {
+					collect(nb.Body, checks, block.Type, block.Labels[0]+"."+block.Labels[1])
+				}
+			}
+		}
+	}
+
+	return conditions
+}
+
+// extractMigrations collects the moved, import and removed blocks that describe
+// how resource addresses change between module versions.
+func extractMigrations(body *hclsyntax.Body, content, fileName string) []database.ModuleMigration {
+	var migrations []database.ModuleMigration
+
+	addr := func(bdy *hclsyntax.Body, name string) string {
+		if attr, ok := bdy.Attributes[name]; ok {
+			return strings.TrimSpace(expressionText(content, attr.Expr.Range()))
+		}
+		return ""
+	}
+
+	for _, block := range body.Blocks {
+		switch block.Type {
+		case "moved", "import", "removed":
+		default:
+			continue
+		}
+
+		migration := database.ModuleMigration{
+			Kind:        block.Type,
+			FromAddress: addr(block.Body, "from"),
+			ToAddress:   addr(block.Body, "to"),
+			Destroy:     true,
+			SourceFile:  fileName,
+		}
+
+		if attr, ok := block.Body.Attributes["id"]; ok {
+			migration.ImportID = conditionMessage(attr, content)
+		}
+
+		if block.Type == "removed" {
+			for _, nb := range block.Body.Blocks {
+				if nb.Type != "lifecycle" {
+					continue
+				}
+				if attr, ok := nb.Body.Attributes["destroy"]; ok {
+					migration.Destroy = attributeIsTrue(attr, content)
+				}
+			}
+		}
+
+		migrations = append(migrations, migration)
+	}
+
+	return migrations
+}
+
+func conditionMessage(attr *hclsyntax.Attribute, content string) string {
+	if literal, ok := attr.Expr.(*hclsyntax.LiteralValueExpr); ok && literal.Val.Type() == cty.String {
+		return literal.Val.AsString()
+	}
+	if tmpl, ok := attr.Expr.(*hclsyntax.TemplateExpr); ok && tmpl.IsStringLiteral() {
+		if val, diags := tmpl.Value(nil); !diags.HasErrors() && val.Type() == cty.String {
+			return val.AsString()
+		}
+	}
+	return strings.TrimSpace(expressionText(content, attr.Expr.Range()))
+}
+
 func attributeIsTrue(attr *hclsyntax.Attribute, content string) bool {
 	if literal, ok := attr.Expr.(*hclsyntax.LiteralValueExpr); ok && literal.Val.Type() == cty.Bool {
 		return literal.Val.True()
@@ -1003,34 +1218,93 @@ func attributeIsTrue(attr *hclsyntax.Attribute, content string) bool {
 	return strings.EqualFold(text, "true")
 }
 
-func (s *Syncer) indexHCLBlocks(moduleID int64, filePath string, body *hclsyntax.Body) {
-	var walk func(b *hclsyntax.Body)
-	walk = func(b *hclsyntax.Body) {
+// indexHCLBlocks records every block in the file, top-level and nested, with a
+// link to its enclosing block so structural queries can be answered from the index.
+// Attribute values are stored per block, keyed by their path below the top-level block.
+func (s *Syncer) indexHCLBlocks(moduleID, exampleID int64, filePath string, body *hclsyntax.Body, content string) {
+	var walk func(b *hclsyntax.Body, parentID int64, root *hclsyntax.Block, prefix string)
+	walk = func(b *hclsyntax.Body, parentID int64, root *hclsyntax.Block, prefix string) {
 		for _, bl := range b.Blocks {
 			blockType := bl.Type
-			if blockType == "resource" || blockType == "dynamic" || blockType == "lifecycle" {
-				typeLabel := ""
-				if blockType == "resource" && len(bl.Labels) >= 2 {
-					typeLabel = bl.Labels[0]
-				} else if blockType == "dynamic" && len(bl.Labels) >= 1 {
-					typeLabel = bl.Labels[0]
-				}
-				rng := bl.Range()
-				start := int(rng.Start.Byte)
-				end := int(rng.End.Byte)
-				paths := collectAttrPaths(bl.Body, "")
-				attrPaths := strings.Join(paths, "\n")
-				_, err := s.db.InsertHCLBlock(moduleID, filePath, blockType, typeLabel, start, end, attrPaths)
-				if err != nil {
-					log.Printf("Warning: failed to insert hcl block %s in %s: %v", blockType, filePath, err)
+			typeLabel := ""
+			if len(bl.Labels) > 0 {
+				typeLabel = bl.Labels[0]
+			} else if blockType == "moved" || blockType == "removed" {
+				typeLabel = blockAddress(bl.Body, "from")
+			} else if blockType == "import" {
+				typeLabel = blockAddress(bl.Body, "to")
+			}
+			rng := bl.Range()
+			start := int(rng.Start.Byte)
+			end := int(rng.End.Byte)
+			paths := collectAttrPaths(bl.Body, "")
+			attrPaths := strings.Join(paths, "\n")
+			id, err := s.db.InsertHCLBlock(moduleID, parentID, exampleID, filePath, blockType, typeLabel, strings.Join(bl.Labels, "."), start, end, attrPaths)
+			if err != nil {
+				log.Printf("Warning: failed to insert hcl block %s in %s: %v", blockType, filePath, err)
+				continue
+			}
+
+			blockRoot, blockPrefix := root, prefix
+			if blockRoot == nil {
+				blockRoot = bl
+			} else {
+				segment := bl.Type
+				if len(bl.Labels) > 0 {
+					segment = joinAttributePath(segment, strings.Join(bl.Labels, "."))
 				}
+				blockPrefix = joinAttributePath(prefix, segment)
 			}
 			if bl.Body != nil {
-				walk(bl.Body)
+				s.indexHCLAttributes(moduleID, id, exampleID, filePath, blockRoot, blockPrefix, bl.Body, content)
+				walk(bl.Body, id, blockRoot, blockPrefix)
 			}
 		}
 	}
-	walk(body)
+	walk(body, 0, nil, "")
+}
+
+func (s *Syncer) indexHCLAttributes(moduleID, blockID, exampleID int64, filePath string, root *hclsyntax.Block, prefix string, body *hclsyntax.Body, content string) {
+	rootLabel := ""
+	if len(root.Labels) > 0 {
+		rootLabel = root.Labels[0]
+	}
+	for name, attr := range body.Attributes {
+		expression, literal := NormalizeExpression(attr.Expr, content)
+		value := sql.NullString{}
+		if literal {
+			value = sql.NullString{String: expression, Valid: true}
+		}
+		rng := attr.SrcRange
+		err := s.db.InsertHCLAttribute(&database.HCLAttribute{
+			ModuleID:      moduleID,
+			BlockID:       blockID,
+			ExampleID:     exampleID,
+			FilePath:      filePath,
+			RootType:      root.Type,
+			RootLabel:     rootLabel,
+			AttributePath: joinAttributePath(prefix, name),
+			Value:         value,
+			Expression:    strings.Join(strings.Fields(expressionText(content, attr.Expr.Range())), " "),
+			StartByte:     int64(rng.Start.Byte),
+			EndByte:       int64(rng.End.Byte),
+		})
+		if err != nil {
+			log.Printf("Warning: failed to insert attribute %s in %s: %v", name, filePath, err)
+		}
+	}
+}
+
+func blockAddress(b *hclsyntax.Body, name string) string {
+	attr, ok := b.Attributes[name]
+	if !ok {
+		return ""
+	}
+	traversal, diags := hcl.AbsTraversalForExpr(attr.Expr)
+	if diags.HasErrors() {
+		return ""
+	}
+	return traversalToString(traversal)
 }
 
 func collectAttrPaths(b *hclsyntax.Body, prefix string) []string {
@@ -1055,10 +1329,11 @@ func collectAttrPaths(b *hclsyntax.Body, prefix string) []string {
 	return out
 }
 
-func (s *Syncer) indexRelationships(moduleID int64, filePath string, body *hclsyntax.Body) {
+func (s *Syncer) indexRelationships(moduleID, exampleID int64, filePath string, body *hclsyntax.Body, content string) {
 	for _, block := range body.Blocks {
-		rels := collectRelationships(moduleID, filePath, block)
+		rels := collectRelationships(moduleID, filePath, block, content)
 		for _, rel := range rels {
+			rel.ExampleID = exampleID
 			if err := s.db.InsertRelationship(&rel); err != nil {
 				log.Printf("Warning: failed to insert relationship for %s: %v", filePath, err)
 			}
@@ -1066,7 +1341,20 @@ func (s *Syncer) indexRelationships(moduleID int64, filePath string, body *hclsy
 	}
 }
 
-func collectRelationships(moduleID int64, filePath string, block *hclsyntax.Block) []database.HCLRelationship {
+// iteratorScope maps the iterator symbols visible at a point in a block (each,
+// count and dynamic block iterators) to the expression they iterate over.
+type iteratorScope map[string]string
+
+func (sc iteratorScope) with(name, source string) iteratorScope {
+	out := make(iteratorScope, len(sc)+1)
+	for k, v := range sc {
+		out[k] = v
+	}
+	out[name] = source
+	return out
+}
+
+func collectRelationships(moduleID int64, filePath string, block *hclsyntax.Block, content string) []database.HCLRelationship {
 	if block.Body == nil {
 		return nil
 	}
@@ -1074,22 +1362,37 @@ func collectRelationships(moduleID int64, filePath string, block *hclsyntax.Bloc
 	blockLabels := strings.Join(block.Labels, ".")
 	var results []database.HCLRelationship
 
-	var walk func(prefix string, body *hclsyntax.Body)
-	walk = func(prefix string, body *hclsyntax.Body) {
+	scope := iteratorScope{}
+	if attr, ok := block.Body.Attributes["for_each"]; ok {
+		scope = scope.with("each", iteratorSourceText(attr.Expr, content))
+	}
+	if attr, ok := block.Body.Attributes["count"]; ok {
+		scope = scope.with("count", iteratorSourceText(attr.Expr, content))
+	}
+
+	// attrScope applies to the attributes of body, blockScope to its nested
+	// blocks; they differ for dynamic blocks, whose for_each is evaluated
+	// outside the iterator it introduces. The iterator argument of a dynamic
+	// block declares a symbol rather than reading one.
+	var walk func(prefix string, body *hclsyntax.Body, dynamicBody bool, attrScope, blockScope iteratorScope)
+	walk = func(prefix string, body *hclsyntax.Body, dynamicBody bool, attrScope, blockScope iteratorScope) {
 		if body == nil {
 			return
 		}
 
 		for name, attr := range body.Attributes {
+			if dynamicBody && name == "iterator" {
+				continue
+			}
 			attrPath := joinAttributePath(prefix, name)
-			traversals := attr.Expr.Variables()
+			traversals := expressionReferences(attr.Expr)
 			if len(traversals) == 0 {
 				continue
 			}
 
 			seen := make(map[string]struct{})
 			for _, traversal := range traversals {
-				refType, refName := classifyTraversal(traversal)
+				refType, refName, source := classifyTraversal(traversal, attrScope)
 				if refType == "" || refName == "" {
 					continue
 				}
@@ -1100,15 +1403,16 @@ func collectRelationships(moduleID int64, filePath string, block *hclsyntax.Bloc
 
 				rng := attr.Expr.Range()
 				results = append(results, database.HCLRelationship{
-					ModuleID:      moduleID,
-					FilePath:      filePath,
-					BlockType:     block.Type,
-					BlockLabels:   blockLabels,
-					AttributePath: attrPath,
-					ReferenceType: refType,
-					ReferenceName: refName,
-					StartByte:     int64(rng.Start.Byte),
-					EndByte:       int64(rng.End.Byte),
+					ModuleID:       moduleID,
+					FilePath:       filePath,
+					BlockType:      block.Type,
+					BlockLabels:    blockLabels,
+					AttributePath:  attrPath,
+					ReferenceType:  refType,
+					ReferenceName:  refName,
+					IteratorSource: source,
+					StartByte:      int64(rng.Start.Byte),
+					EndByte:        int64(rng.End.Byte),
 				})
 			}
 		}
@@ -1118,14 +1422,115 @@ func collectRelationships(moduleID int64, filePath string, block *hclsyntax.Bloc
 			if len(child.Labels) > 0 {
 				segment = joinAttributePath(segment, strings.Join(child.Labels, "."))
 			}
-			walk(joinAttributePath(prefix, segment), child.Body)
+
+			childScope := blockScope
+			dynamic := child.Type == "dynamic" && len(child.Labels) > 0 && child.Body != nil
+			if dynamic {
+				source := ""
+				if attr, ok := child.Body.Attributes["for_each"]; ok {
+					source = iteratorSourceText(attr.Expr, content)
+				}
+				childScope = blockScope.with(dynamicIteratorName(child), source)
+			}
+			walk(joinAttributePath(prefix, segment), child.Body, dynamic, blockScope, childScope)
 		}
 	}
 
-	walk("", block.Body)
+	walk("", block.Body, false, scope, scope)
 	return results
 }
 
+// dynamicIteratorName returns the symbol a dynamic block binds each element
+// to: the block label unless overridden by an iterator argument.
+func dynamicIteratorName(block *hclsyntax.Block) string {
+	if attr, ok := block.Body.Attributes["iterator"]; ok {
+		if traversal, diags := hcl.AbsTraversalForExpr(attr.Expr); !diags.HasErrors() && len(traversal) == 1 {
+			return traversal.RootName()
+		}
+	}
+	return block.Labels[0]
+}
+
+func iteratorSourceText(expr hclsyntax.Expression, content string) string {
+	text, _ := NormalizeExpression(expr, content)
+	return text
+}
+
+// expressionReferences returns the traversals an expression reads. Symbols
+// bound by for expressions are excluded by Variables; lookup(x, "key") with a
+// literal key is narrowed to x.key so the reference names the field it reads.
+func expressionReferences(expr hclsyntax.Expression) []hcl.Traversal {
+	traversals := expr.Variables()
+	if len(traversals) == 0 {
+		return nil
+	}
+
+	available := make(map[string]int)
+	for _, t := range traversals {
+		available[traversalToString(t)]++
+	}
+
+	narrowed := make(map[string]int)
+	var refined []hcl.Traversal
+	hclsyntax.VisitAll(expr, func(node hclsyntax.Node) hcl.Diagnostics {
+		call, ok := node.(*hclsyntax.FunctionCallExpr)
+		if !ok || call.Name != "lookup" || len(call.Args) < 2 {
+			return nil
+		}
+		base, ok := call.Args[0].(*hclsyntax.ScopeTraversalExpr)
+		if !ok {
+			return nil
+		}
+		key, ok := literalString(call.Args[1])
+		if !ok {
+			return nil
+		}
+		name := traversalToString(base.Traversal)
+		if available[name] == 0 {
+			return nil
+		}
+		available[name]--
+		narrowed[name]++
+
+		t := append(hcl.Traversal{}, base.Traversal...)
+		if hclsyntax.ValidIdentifier(key) {
+			t = append(t, hcl.TraverseAttr{Name: key})
+		} else {
+			t = append(t, hcl.TraverseIndex{Key: cty.StringVal(key)})
+		}
+		refined = append(refined, t)
+		return nil
+	})
+
+	out := make([]hcl.Traversal, 0, len(traversals))
+	for _, t := range traversals {
+		name := traversalToString(t)
+		if narrowed[name] > 0 {
+			narrowed[name]--
+			continue
+		}
+		out = append(out, t)
+	}
+	return append(out, refined...)
+}
+
+func literalString(expr hclsyntax.Expression) (string, bool) {
+	switch e := expr.(type) {
+	case *hclsyntax.TemplateExpr:
+		if !e.IsStringLiteral() {
+			return "", false
+		}
+	case *hclsyntax.LiteralValueExpr:
+	default:
+		return "", false
+	}
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() || val.Type() != cty.String || val.IsNull() {
+		return "", false
+	}
+	return val.AsString(), true
+}
+
 func joinAttributePath(prefix, name string) string {
 	if prefix == "" {
 		return name
@@ -1136,47 +1541,65 @@ func joinAttributePath(prefix, name string) string {
 	return prefix + "." + name
 }
 
-func classifyTraversal(traversal hcl.Traversal) (string, string) {
+// classifyTraversal returns the reference type and name of a traversal, plus
+// the iterated expression when it reads an iterator visible in scope.
+func classifyTraversal(traversal hcl.Traversal, scope iteratorScope) (string, string, string) {
 	if len(traversal) == 0 {
-		return "", ""
+		return "", "", ""
 	}
 
 	root, ok := traversal[0].(hcl.TraverseRoot)
 	if !ok {
-		return "", ""
+		return "", "", ""
 	}
 
 	rootName := root.Name
 	refName := traversalToString(traversal)
 	if refName == "" {
-		return "", ""
+		return "", "", ""
+	}
+
+	if source, ok := scope[rootName]; ok {
+		if rootName == "count" {
+			return "count", refName, source
+		}
+		return "loop", refName, source
 	}
 
 	switch rootName {
 	case "var":
-		return "variable", refName
+		return "variable", refName, ""
 	case "local":
-		return "local", refName
+		return "local", refName, ""
 	case "module":
-		return "module_output", refName
+		return "module_output", refName, ""
 	case "data":
-		return "data_source", refName
+		return "data_source", refName, ""
 	case "path":
-		return "path", refName
+		return "path", refName, ""
 	case "terraform":
-		return "terraform", refName
+		return "terraform", refName, ""
 	case "each":
-		return "loop", refName
+		return "loop", refName, ""
 	case "self":
-		return "self", refName
+		return "self", refName, ""
 	case "count":
-		return "count", refName
+		return "count", refName, ""
 	default:
-		if strings.Contains(rootName, "_") {
-			return "resource", refName
+		// Resource addresses are <provider>_<type>.<name>; anything else is an
+		// unresolved symbol.
+		if _, named := traversalStep(traversal, 1).(hcl.TraverseAttr); named && strings.Contains(rootName, "_") {
+			return "resource", refName, ""
 		}
-		return "reference", refName
+		return "reference", refName, ""
+	}
+}
+
+func traversalStep(traversal hcl.Traversal, i int) hcl.Traverser {
+	if i >= len(traversal) {
+		return nil
 	}
+	return traversal[i]
 }
 
 func traversalToString(traversal hcl.Traversal) string {
@@ -1210,6 +1633,35 @@ func expressionText(content string, rng hcl.Range) string {
 	return string(data[start:end])
 }
 
+// NormalizeExpression returns the value of a constant expression (strings
+// unquoted, numbers and bools in canonical form) with literal set, or the
+// whitespace-collapsed source text of any other expression.
+func NormalizeExpression(expr hclsyntax.Expression, content string) (string, bool) {
+	switch e := expr.(type) {
+	case *hclsyntax.TemplateExpr:
+		if e.IsStringLiteral() {
+			if val, diags := e.Value(nil); !diags.HasErrors() && val.Type() == cty.String {
+				return val.AsString(), true
+			}
+		}
+	case *hclsyntax.LiteralValueExpr:
+		switch {
+		case e.Val.IsNull():
+			return "null", true
+		case e.Val.Type() == cty.String:
+			return e.Val.AsString(), true
+		case e.Val.Type() == cty.Bool:
+			if e.Val.True() {
+				return "true", true
+			}
+			return "false", true
+		case e.Val.Type() == cty.Number:
+			return e.Val.AsBigFloat().Text('f', -1), true
+		}
+	}
+	return strings.Join(strings.Fields(expressionText(content, expr.Range())), " "), false
+}
+
 func providerFromType(fullType string) string {
 	return util.ExtractProvider(fullType)
 }
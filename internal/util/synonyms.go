@@ -1,6 +1,12 @@
 package util
 
-import "strings"
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
 
 func ExpandQueryVariants(q string) []string {
 	base := strings.TrimSpace(q)
@@ -25,3 +31,167 @@ func ExpandQueryVariants(q string) []string {
 	}
 	return out
 }
+
+// ExpandDomainVariants returns the separator variants of q and of every
+// synonym expansion of q.
+func ExpandDomainVariants(q string) []string {
+	seen := make(map[string]struct{})
+	var out []string
+	for _, phrase := range ExpandSynonyms(q) {
+		for _, v := range ExpandQueryVariants(phrase) {
+			if _, ok := seen[v]; ok || v == "" {
+				continue
+			}
+			seen[v] = struct{}{}
+			out = append(out, v)
+		}
+	}
+	if len(out) == 0 {
+		return []string{""}
+	}
+	return out
+}
+
+// defaultSynonyms maps Azure short names to the terms they stand for. The
+// first expansion is the canonical spelling used when a prompt names the
+// short form.
+var defaultSynonyms = map[string][]string{
+	"kv":   {"key vault", "keyvault"},
+	"vnet": {"virtual network"},
+	"pe":   {"private endpoint"},
+	"aks":  {"kubernetes cluster"},
+	"law":  {"log analytics workspace"},
+	"sa":   {"storage account"},
+	"nsg":  {"network security group"},
+	"pip":  {"public ip"},
+	"agw":  {"application gateway"},
+	"acr":  {"container registry"},
+	"rg":   {"resource group"},
+	"uai":  {"user assigned identity"},
+	"pdns": {"private dns zone"},
+}
+
+var (
+	synonymsMu sync.RWMutex
+	synonyms   = defaultSynonyms
+	// synonymGroups maps every normalized term to the group it belongs to,
+	// short form first.
+	synonymGroups = buildSynonymGroups(defaultSynonyms)
+)
+
+func buildSynonymGroups(m map[string][]string) map[string][]string {
+	groups := make(map[string][]string)
+	for short, expansions := range m {
+		group := []string{normalizeTerm(short)}
+		for _, e := range expansions {
+			if e = normalizeTerm(e); e != "" && e != group[0] {
+				group = append(group, e)
+			}
+		}
+		for _, term := range group {
+			groups[term] = group
+		}
+	}
+	return groups
+}
+
+// LoadSynonyms extends the synonym dictionary with a JSON file mapping short
+// names to their expansions, e.g. {"fw": ["firewall"], "kv": ["key vault"]}.
+// An entry for a short name that already exists replaces its expansions.
+func LoadSynonyms(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var extra map[string][]string
+	if err := json.Unmarshal(data, &extra); err != nil {
+		return fmt.Errorf("invalid synonyms file %s: %w", path, err)
+	}
+
+	synonymsMu.Lock()
+	defer synonymsMu.Unlock()
+	merged := make(map[string][]string, len(synonyms)+len(extra))
+	for k, v := range synonyms {
+		merged[k] = v
+	}
+	for k, v := range extra {
+		merged[normalizeTerm(k)] = v
+	}
+	synonyms = merged
+	synonymGroups = buildSynonymGroups(merged)
+	return nil
+}
+
+// ExpandSynonyms returns q followed by q with each known term swapped for its
+// synonyms, and with azurerm resource types swapped for their words and the
+// other way around ("key vault" ⇄ azurerm_key_vault).
+func ExpandSynonyms(q string) []string {
+	base := strings.TrimSpace(q)
+	out := []string{base}
+	words := strings.Fields(normalizeTerm(base))
+	if len(words) == 0 {
+		return out
+	}
+
+	seen := map[string]struct{}{strings.ToLower(base): {}}
+	add := func(s string) {
+		if _, ok := seen[s]; !ok && s != "" {
+			seen[s] = struct{}{}
+			out = append(out, s)
+		}
+	}
+
+	synonymsMu.RLock()
+	groups := synonymGroups
+	synonymsMu.RUnlock()
+
+	if rest, ok := strings.CutPrefix(strings.Join(words, " "), "azurerm "); ok {
+		add(rest)
+		words = strings.Fields(rest)
+	}
+
+	// Longest runs first, so "log analytics workspace" is replaced as one term.
+	for size := len(words); size >= 1; size-- {
+		for i := 0; i+size <= len(words); i++ {
+			term := strings.Join(words[i:i+size], " ")
+			group, ok := groups[term]
+			if !ok {
+				continue
+			}
+			for _, alt := range group {
+				if alt == term {
+					continue
+				}
+				expanded := append(append(append([]string{}, words[:i]...), alt), words[i+size:]...)
+				add(strings.Join(expanded, " "))
+			}
+		}
+	}
+
+	if len(words) > 1 {
+		add("azurerm_" + strings.Join(words, "_"))
+	}
+	for _, v := range out[1:] {
+		if strings.Contains(v, " ") && !strings.HasPrefix(v, "azurerm_") {
+			add("azurerm_" + strings.ReplaceAll(v, " ", "_"))
+		}
+	}
+	return out
+}
+
+// CanonicalTerm returns the canonical expansion of a short name such as "pe"
+// ("private endpoint"), or term unchanged when it is not a known short name.
+func CanonicalTerm(term string) string {
+	synonymsMu.RLock()
+	defer synonymsMu.RUnlock()
+	key := normalizeTerm(term)
+	if expansions, ok := synonyms[key]; ok && len(expansions) > 0 {
+		return normalizeTerm(expansions[0])
+	}
+	return term
+}
+
+func normalizeTerm(s string) string {
+	spaced := strings.NewReplacer("-", " ", "_", " ", "/", " ").Replace(strings.ToLower(s))
+	return strings.Join(strings.Fields(spaced), " ")
+}
@@ -0,0 +1,584 @@
+package mcp
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/dkooll/wamcp/internal/indexer"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// Block queries select HCL blocks structurally. Grammar:
+//
+//	query    := selector { ('>' | '>>') selector } [ '|' 'count' ]
+//	selector := blocktype { "label" } [ expr ]
+//	expr     := and { ('OR' | '||') and }
+//	and      := term { term }
+//	term     := '!' term | '(' expr ')' | 'has:' path | path op value
+//	op       := '=' | '!=' | '~'
+//
+// '>' requires the right-hand block to be a direct child of the left-hand one,
+// '>>' any descendant. Labels accept '*' wildcards; resource and data types
+// match by prefix. '~' is a case-insensitive substring match. Examples:
+//
+//	resource "azurerm_storage_account" min_tls_version != "TLS1_2"
+//	resource "azurerm_*" !has:tags
+//	resource "azurerm_*" > dynamic "identity" (has:identity_ids OR type = "UserAssigned")
+//	resource "azurerm_key_vault" >> network_acls | count
+type blockQuery struct {
+	Steps []queryStep
+	Count bool
+}
+
+type queryStep struct {
+	Selector querySelector
+	// Descendant is true when this step is joined to the previous one with '>>'.
+	Descendant bool
+}
+
+type querySelector struct {
+	BlockType string
+	Labels    []string
+	Prefix    bool
+	Filter    queryExpr
+}
+
+type queryExpr interface {
+	eval(n *queryNode) bool
+}
+
+type andExpr []queryExpr
+
+type orExpr []queryExpr
+
+type notExpr struct{ expr queryExpr }
+
+type hasExpr struct{ path string }
+
+type compareExpr struct {
+	path  string
+	op    string
+	value string
+}
+
+func (e andExpr) eval(n *queryNode) bool {
+	for _, sub := range e {
+		if !sub.eval(n) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e orExpr) eval(n *queryNode) bool {
+	for _, sub := range e {
+		if sub.eval(n) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e notExpr) eval(n *queryNode) bool {
+	return !e.expr.eval(n)
+}
+
+func (e hasExpr) eval(n *queryNode) bool {
+	body, _ := n.body()
+	return body != nil && hasPath(body, e.path)
+}
+
+// eval compares the attribute value at path; a missing attribute never matches,
+// so use !has: to select blocks where it is absent.
+func (e compareExpr) eval(n *queryNode) bool {
+	body, content := n.body()
+	if body == nil {
+		return false
+	}
+	got, ok := attributeValueAt(body, content, e.path)
+	if !ok {
+		return false
+	}
+	switch e.op {
+	case "=":
+		return got == e.value
+	case "!=":
+		return got != e.value
+	case "~":
+		return strings.Contains(strings.ToLower(got), strings.ToLower(e.value))
+	}
+	return false
+}
+
+// queryNode is a block being evaluated against a query. Bodies and parents are
+// loaded lazily so index-backed evaluation only parses what filters need.
+type queryNode struct {
+	Type   string
+	Labels []string
+
+	loadBody   func() (*hclsyntax.Body, string)
+	loadParent func() *queryNode
+
+	bodyLoaded   bool
+	parsedBody   *hclsyntax.Body
+	content      string
+	parentLoaded bool
+	parentNode   *queryNode
+}
+
+func (n *queryNode) body() (*hclsyntax.Body, string) {
+	if !n.bodyLoaded {
+		n.bodyLoaded = true
+		if n.loadBody != nil {
+			n.parsedBody, n.content = n.loadBody()
+		}
+	}
+	return n.parsedBody, n.content
+}
+
+func (n *queryNode) parent() *queryNode {
+	if !n.parentLoaded {
+		n.parentLoaded = true
+		if n.loadParent != nil {
+			n.parentNode = n.loadParent()
+		}
+	}
+	return n.parentNode
+}
+
+func (q blockQuery) target() querySelector {
+	return q.Steps[len(q.Steps)-1].Selector
+}
+
+func (q blockQuery) matches(n *queryNode) bool {
+	return q.matchStep(n, len(q.Steps)-1)
+}
+
+func (q blockQuery) matchStep(n *queryNode, idx int) bool {
+	if n == nil || !q.Steps[idx].Selector.matches(n) {
+		return false
+	}
+	if idx == 0 {
+		return true
+	}
+	if !q.Steps[idx].Descendant {
+		return q.matchStep(n.parent(), idx-1)
+	}
+	for anc := n.parent(); anc != nil; anc = anc.parent() {
+		if q.matchStep(anc, idx-1) {
+			return true
+		}
+	}
+	return false
+}
+
+func (sel querySelector) matches(n *queryNode) bool {
+	if n.Type != sel.BlockType || len(n.Labels) < len(sel.Labels) {
+		return false
+	}
+	for i, want := range sel.Labels {
+		prefix := sel.Prefix && i == len(sel.Labels)-1
+		if !labelMatches(want, n.Labels[i], prefix) {
+			return false
+		}
+	}
+	return sel.Filter == nil || sel.Filter.eval(n)
+}
+
+// attributeValueAt resolves a dotted path through nested blocks to an attribute
+// and returns its normalized value: string literals unquoted, other
+// expressions as their source text.
+func attributeValueAt(bdy *hclsyntax.Body, content, path string) (string, bool) {
+	parts := strings.Split(path, ".")
+	for len(parts) > 1 {
+		var next *hclsyntax.Body
+		for _, bl := range bdy.Blocks {
+			if bl.Type == parts[0] {
+				next = bl.Body
+				break
+			}
+		}
+		if next == nil {
+			return "", false
+		}
+		bdy = next
+		parts = parts[1:]
+	}
+	attr, ok := bdy.Attributes[parts[0]]
+	if !ok {
+		return "", false
+	}
+	value, _ := indexer.NormalizeExpression(attr.Expr, content)
+	return value, true
+}
+
+// parseBlockSnippet parses the source of a single block and returns its body.
+func parseBlockSnippet(snippet string) *hclsyntax.Body {
+	file, diags := hclparse.NewParser().ParseHCL([]byte(snippet), "block.tf")
+	if diags.HasErrors() {
+		return nil
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok || len(body.Blocks) == 0 {
+		return nil
+	}
+	return body.Blocks[0].Body
+}
+
+// bareBlockType reports whether q is a lone block type without labels,
+// filters or further steps, which is indistinguishable from a plain word.
+func (q blockQuery) bareBlockType() bool {
+	if len(q.Steps) != 1 || q.Count {
+		return false
+	}
+	sel := q.Steps[0].Selector
+	return len(sel.Labels) == 0 && sel.Filter == nil
+}
+
+// looksLikeBlockQuery reports whether a pattern uses query syntax, so syntax
+// errors are surfaced instead of silently falling back to text search.
+func looksLikeBlockQuery(pattern string) bool {
+	trimmed := strings.TrimSpace(pattern)
+	if strings.Contains(trimmed, "has:") || strings.Contains(trimmed, " > ") || strings.Contains(trimmed, ">>") || strings.Contains(trimmed, "| count") {
+		return true
+	}
+	head, rest, ok := strings.Cut(trimmed, " ")
+	return ok && blockTypeRegex.MatchString(head) && strings.HasPrefix(strings.TrimSpace(rest), `"`)
+}
+
+// QuerySyntaxError describes where a block query failed to parse.
+type QuerySyntaxError struct {
+	Column  int
+	Message string
+}
+
+func (e *QuerySyntaxError) Error() string {
+	return fmt.Sprintf("query syntax error at column %d: %s", e.Column, e.Message)
+}
+
+type queryTokenKind int
+
+const (
+	qtEOF queryTokenKind = iota
+	qtIdent
+	qtString
+	qtHas
+	qtOp
+	qtChild
+	qtDescendant
+	qtLParen
+	qtRParen
+	qtNot
+	qtOr
+	qtPipe
+)
+
+type queryToken struct {
+	kind queryTokenKind
+	text string
+	pos  int
+	// open marks a string whose closing quote is missing at the end of the
+	// query; it matches labels by prefix.
+	open bool
+}
+
+func (t queryToken) describe() string {
+	switch t.kind {
+	case qtEOF:
+		return "end of query"
+	case qtString:
+		return fmt.Sprintf("string %q", t.text)
+	case qtHas:
+		return "has:" + t.text
+	}
+	return fmt.Sprintf("'%s'", t.text)
+}
+
+func isQueryIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.' || r == '*' || r == '/'
+}
+
+func lexBlockQuery(input string) ([]queryToken, error) {
+	runes := []rune(input)
+	var tokens []queryToken
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		pos := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != '"' {
+				j++
+			}
+			if j >= len(runes) {
+				// A quote left open at the end is a label prefix, as in
+				// resource "azurerm_ or resource "azurerm_ {.
+				text := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(string(runes[i+1:])), "{"))
+				if text == "" || strings.IndexFunc(text, func(r rune) bool { return !isQueryIdentRune(r) }) >= 0 {
+					return nil, &QuerySyntaxError{Column: pos, Message: "unterminated string"}
+				}
+				tokens = append(tokens, queryToken{kind: qtString, text: text, pos: pos, open: true})
+				i = j
+				continue
+			}
+			tokens = append(tokens, queryToken{kind: qtString, text: string(runes[i+1 : j]), pos: pos})
+			i = j + 1
+		case r == '>':
+			if i+1 < len(runes) && runes[i+1] == '>' {
+				tokens = append(tokens, queryToken{kind: qtDescendant, text: ">>", pos: pos})
+				i += 2
+			} else {
+				tokens = append(tokens, queryToken{kind: qtChild, text: ">", pos: pos})
+				i++
+			}
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: qtLParen, text: "(", pos: pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: qtRParen, text: ")", pos: pos})
+			i++
+		case r == '|':
+			if i+1 < len(runes) && runes[i+1] == '|' {
+				tokens = append(tokens, queryToken{kind: qtOr, text: "||", pos: pos})
+				i += 2
+			} else {
+				tokens = append(tokens, queryToken{kind: qtPipe, text: "|", pos: pos})
+				i++
+			}
+		case r == '!':
+			if i+1 < len(runes) && runes[i+1] == '=' {
+				tokens = append(tokens, queryToken{kind: qtOp, text: "!=", pos: pos})
+				i += 2
+			} else {
+				tokens = append(tokens, queryToken{kind: qtNot, text: "!", pos: pos})
+				i++
+			}
+		case r == '=':
+			i++
+			if i < len(runes) && runes[i] == '=' {
+				i++
+			}
+			tokens = append(tokens, queryToken{kind: qtOp, text: "=", pos: pos})
+		case r == '~':
+			tokens = append(tokens, queryToken{kind: qtOp, text: "~", pos: pos})
+			i++
+		case r == '{' && strings.TrimSpace(string(runes[i+1:])) == "":
+			// A trailing '{' is how the block is written in HCL, as in
+			// dynamic "identity" {; it adds nothing to the query.
+			i = len(runes)
+		case r == '{' || r == '}':
+			return nil, &QuerySyntaxError{Column: pos, Message: fmt.Sprintf("unexpected '%c': queries select blocks by type and labels, not by block bodies", r)}
+		case isQueryIdentRune(r):
+			j := i
+			for j < len(runes) && isQueryIdentRune(runes[j]) {
+				j++
+			}
+			word := string(runes[i:j])
+			if word == "has" && j < len(runes) && runes[j] == ':' {
+				k := j + 1
+				for k < len(runes) && isQueryIdentRune(runes[k]) {
+					k++
+				}
+				if k == j+1 {
+					return nil, &QuerySyntaxError{Column: pos, Message: "has: needs an attribute path (e.g. has:lifecycle.ignore_changes)"}
+				}
+				tokens = append(tokens, queryToken{kind: qtHas, text: string(runes[j+1 : k]), pos: pos})
+				i = k
+				continue
+			}
+			kind := qtIdent
+			if word == "OR" || word == "or" {
+				kind = qtOr
+			}
+			tokens = append(tokens, queryToken{kind: kind, text: word, pos: pos})
+			i = j
+		default:
+			return nil, &QuerySyntaxError{Column: pos, Message: fmt.Sprintf("unexpected character '%c'", r)}
+		}
+	}
+	tokens = append(tokens, queryToken{kind: qtEOF, pos: len(runes) + 1})
+	return tokens, nil
+}
+
+type blockQueryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func parseBlockQuery(input string) (blockQuery, error) {
+	tokens, err := lexBlockQuery(input)
+	if err != nil {
+		return blockQuery{}, err
+	}
+
+	p := &blockQueryParser{tokens: tokens}
+	var q blockQuery
+
+	sel, err := p.parseSelector()
+	if err != nil {
+		return blockQuery{}, err
+	}
+	q.Steps = append(q.Steps, queryStep{Selector: sel})
+
+	for p.peek().kind == qtChild || p.peek().kind == qtDescendant {
+		descendant := p.next().kind == qtDescendant
+		sel, err := p.parseSelector()
+		if err != nil {
+			return blockQuery{}, err
+		}
+		q.Steps = append(q.Steps, queryStep{Selector: sel, Descendant: descendant})
+	}
+
+	if p.peek().kind == qtPipe {
+		p.next()
+		tok := p.next()
+		if tok.kind != qtIdent || !strings.EqualFold(tok.text, "count") {
+			return blockQuery{}, p.errorAt(tok, "expected 'count' after '|'")
+		}
+		q.Count = true
+	}
+
+	if tok := p.peek(); tok.kind != qtEOF {
+		return blockQuery{}, p.errorAt(tok, "expected '>', '>>', '| count' or end of query")
+	}
+
+	return q, nil
+}
+
+func (p *blockQueryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *blockQueryParser) peekAt(offset int) queryToken {
+	if p.pos+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *blockQueryParser) next() queryToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != qtEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *blockQueryParser) errorAt(tok queryToken, msg string) error {
+	return &QuerySyntaxError{Column: tok.pos, Message: fmt.Sprintf("%s, got %s", msg, tok.describe())}
+}
+
+func (p *blockQueryParser) parseSelector() (querySelector, error) {
+	tok := p.next()
+	if tok.kind != qtIdent || !blockTypeRegex.MatchString(tok.text) {
+		return querySelector{}, p.errorAt(tok, "expected block type (e.g. resource, dynamic, lifecycle)")
+	}
+
+	sel := querySelector{BlockType: tok.text, Prefix: prefixLabelBlockTypes[tok.text]}
+	for p.peek().kind == qtString {
+		labelTok := p.next()
+		label := strings.TrimSpace(labelTok.text)
+		if label == "" {
+			return querySelector{}, &QuerySyntaxError{Column: tok.pos, Message: "labels must not be empty"}
+		}
+		sel.Labels = append(sel.Labels, label)
+		sel.Prefix = sel.Prefix || labelTok.open
+	}
+
+	if p.startsTerm() {
+		filter, err := p.parseOr()
+		if err != nil {
+			return querySelector{}, err
+		}
+		sel.Filter = filter
+	}
+
+	return sel, nil
+}
+
+func (p *blockQueryParser) startsTerm() bool {
+	switch p.peek().kind {
+	case qtNot, qtLParen, qtHas:
+		return true
+	case qtIdent:
+		return p.peekAt(1).kind == qtOp
+	}
+	return false
+}
+
+func (p *blockQueryParser) parseOr() (queryExpr, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	group := orExpr{first}
+	for p.peek().kind == qtOr {
+		p.next()
+		next, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		group = append(group, next)
+	}
+	if len(group) == 1 {
+		return first, nil
+	}
+	return group, nil
+}
+
+func (p *blockQueryParser) parseAnd() (queryExpr, error) {
+	var terms andExpr
+	for {
+		term, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if !p.startsTerm() {
+			break
+		}
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return terms, nil
+}
+
+func (p *blockQueryParser) parseTerm() (queryExpr, error) {
+	tok := p.next()
+	switch tok.kind {
+	case qtNot:
+		inner, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr: inner}, nil
+	case qtLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != qtRParen {
+			return nil, p.errorAt(closing, "expected ')'")
+		}
+		return inner, nil
+	case qtHas:
+		return hasExpr{path: tok.text}, nil
+	case qtIdent:
+		op := p.next()
+		if op.kind != qtOp {
+			return nil, p.errorAt(op, fmt.Sprintf("expected '=', '!=' or '~' after %s", tok.text))
+		}
+		val := p.next()
+		if val.kind != qtString && val.kind != qtIdent {
+			return nil, p.errorAt(val, "expected a value (quoted string, number, true/false or null)")
+		}
+		return compareExpr{path: tok.text, op: op.text, value: val.text}, nil
+	}
+	return nil, p.errorAt(tok, "expected has:<path>, '!', '(' or an attribute comparison")
+}
@@ -0,0 +1,355 @@
+package mcp
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func TestLexBlockQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		kinds []queryTokenKind
+		texts []string
+	}{
+		{
+			name:  "selector with labels",
+			input: `resource "azurerm_*" "this"`,
+			kinds: []queryTokenKind{qtIdent, qtString, qtString, qtEOF},
+			texts: []string{"resource", "azurerm_*", "this", ""},
+		},
+		{
+			name:  "open quote and trailing brace",
+			input: `resource "azurerm_ {`,
+			kinds: []queryTokenKind{qtIdent, qtString, qtEOF},
+			texts: []string{"resource", "azurerm_", ""},
+		},
+		{
+			name:  "child and descendant",
+			input: `resource > dynamic >> content`,
+			kinds: []queryTokenKind{qtIdent, qtChild, qtIdent, qtDescendant, qtIdent, qtEOF},
+			texts: []string{"resource", ">", "dynamic", ">>", "content", ""},
+		},
+		{
+			name:  "negated has",
+			input: `!has:lifecycle.ignore_changes`,
+			kinds: []queryTokenKind{qtNot, qtHas, qtEOF},
+			texts: []string{"!", "lifecycle.ignore_changes", ""},
+		},
+		{
+			name:  "or spellings",
+			input: `has:a OR has:b || has:c or has:d`,
+			kinds: []queryTokenKind{qtHas, qtOr, qtHas, qtOr, qtHas, qtOr, qtHas, qtEOF},
+			texts: []string{"a", "OR", "b", "||", "c", "or", "d", ""},
+		},
+		{
+			name:  "operators and parentheses",
+			input: `(sku = "Premium" || name != x) tier ~ std`,
+			kinds: []queryTokenKind{qtLParen, qtIdent, qtOp, qtString, qtOr, qtIdent, qtOp, qtIdent, qtRParen, qtIdent, qtOp, qtIdent, qtEOF},
+			texts: []string{"(", "sku", "=", "Premium", "||", "name", "!=", "x", ")", "tier", "~", "std", ""},
+		},
+		{
+			name:  "double equals and count",
+			input: `enabled == true | count`,
+			kinds: []queryTokenKind{qtIdent, qtOp, qtIdent, qtPipe, qtIdent, qtEOF},
+			texts: []string{"enabled", "=", "true", "|", "count", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := lexBlockQuery(tt.input)
+			if err != nil {
+				t.Fatalf("lexBlockQuery(%q) error: %v", tt.input, err)
+			}
+			var kinds []queryTokenKind
+			var texts []string
+			for _, tok := range tokens {
+				kinds = append(kinds, tok.kind)
+				texts = append(texts, tok.text)
+			}
+			if !reflect.DeepEqual(kinds, tt.kinds) {
+				t.Errorf("kinds = %v, want %v", kinds, tt.kinds)
+			}
+			if !reflect.DeepEqual(texts, tt.texts) {
+				t.Errorf("texts = %q, want %q", texts, tt.texts)
+			}
+		})
+	}
+}
+
+func TestParseBlockQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  blockQuery
+	}{
+		{
+			name:  "type and labels",
+			input: `resource "azurerm_storage_account" "this"`,
+			want: blockQuery{Steps: []queryStep{
+				{Selector: querySelector{BlockType: "resource", Labels: []string{"azurerm_storage_account", "this"}, Prefix: true}},
+			}},
+		},
+		{
+			name:  "child relation",
+			input: `resource "azurerm_*" > dynamic "identity"`,
+			want: blockQuery{Steps: []queryStep{
+				{Selector: querySelector{BlockType: "resource", Labels: []string{"azurerm_*"}, Prefix: true}},
+				{Selector: querySelector{BlockType: "dynamic", Labels: []string{"identity"}}},
+			}},
+		},
+		{
+			name:  "descendant relation with count",
+			input: `resource "azurerm_key_vault" >> network_acls | count`,
+			want: blockQuery{
+				Steps: []queryStep{
+					{Selector: querySelector{BlockType: "resource", Labels: []string{"azurerm_key_vault"}, Prefix: true}},
+					{Selector: querySelector{BlockType: "network_acls"}, Descendant: true},
+				},
+				Count: true,
+			},
+		},
+		{
+			name:  "open quote is a label prefix",
+			input: `dynamic "ip_`,
+			want: blockQuery{Steps: []queryStep{
+				{Selector: querySelector{BlockType: "dynamic", Labels: []string{"ip_"}, Prefix: true}},
+			}},
+		},
+		{
+			name:  "trailing brace",
+			input: `dynamic "contact" {`,
+			want: blockQuery{Steps: []queryStep{
+				{Selector: querySelector{BlockType: "dynamic", Labels: []string{"contact"}}},
+			}},
+		},
+		{
+			name:  "negated has",
+			input: `resource "azurerm_*" !has:tags`,
+			want: blockQuery{Steps: []queryStep{
+				{Selector: querySelector{BlockType: "resource", Labels: []string{"azurerm_*"}, Prefix: true, Filter: notExpr{expr: hasExpr{path: "tags"}}}},
+			}},
+		},
+		{
+			name:  "or binds looser than and",
+			input: `dynamic has:a has:b OR type = "UserAssigned"`,
+			want: blockQuery{Steps: []queryStep{
+				{Selector: querySelector{BlockType: "dynamic", Filter: orExpr{
+					andExpr{hasExpr{path: "a"}, hasExpr{path: "b"}},
+					compareExpr{path: "type", op: "=", value: "UserAssigned"},
+				}}},
+			}},
+		},
+		{
+			name:  "parentheses group an or",
+			input: `dynamic "identity" (has:identity_ids || type ~ user) !has:x`,
+			want: blockQuery{Steps: []queryStep{
+				{Selector: querySelector{BlockType: "dynamic", Labels: []string{"identity"}, Filter: andExpr{
+					orExpr{hasExpr{path: "identity_ids"}, compareExpr{path: "type", op: "~", value: "user"}},
+					notExpr{expr: hasExpr{path: "x"}},
+				}}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseBlockQuery(tt.input)
+			if err != nil {
+				t.Fatalf("parseBlockQuery(%q) error: %v", tt.input, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseBlockQuery(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBlockQueryErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		column  int
+		message string
+	}{
+		{input: `resource "azurerm_key vault`, column: 10, message: "unterminated string"},
+		{input: `resource "x" > dynamic "`, column: 24, message: "unterminated string"},
+		{input: `resource "x" { name = 1 }`, column: 14, message: "unexpected '{'"},
+		{input: `lifecycle }`, column: 11, message: "unexpected '}'"},
+		{input: `resource "x" has:`, column: 14, message: "has: needs an attribute path"},
+		{input: `resource "x" @`, column: 14, message: "unexpected character '@'"},
+		{input: `"x"`, column: 1, message: "expected block type"},
+		{input: `resource >`, column: 11, message: "got end of query"},
+		{input: `resource "x" | sum`, column: 16, message: "expected 'count' after '|'"},
+		{input: `resource "x" (has:a`, column: 20, message: "expected ')'"},
+		{input: `resource "x" sku = `, column: 20, message: "expected a value"},
+		{input: `resource "x" ""`, column: 1, message: "labels must not be empty"},
+		{input: `resource "x" has:a )`, column: 20, message: "expected '>', '>>', '| count' or end of query"},
+		{input: `resource "x" !`, column: 15, message: "expected has:<path>, '!', '('"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := parseBlockQuery(tt.input)
+			var syntaxErr *QuerySyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("parseBlockQuery(%q) error = %v, want a QuerySyntaxError", tt.input, err)
+			}
+			if syntaxErr.Column != tt.column {
+				t.Errorf("column = %d, want %d (%v)", syntaxErr.Column, tt.column, err)
+			}
+			if !strings.Contains(syntaxErr.Message, tt.message) {
+				t.Errorf("message = %q, want it to contain %q", syntaxErr.Message, tt.message)
+			}
+		})
+	}
+}
+
+const blockQueryFixture = `
+resource "azurerm_storage_account" "sa" {
+  name            = "sa"
+  min_tls_version = "TLS1_0"
+  tags            = var.tags
+
+  dynamic "identity" {
+    for_each = var.identity
+    content {
+      type         = "UserAssigned"
+      identity_ids = identity.value.ids
+    }
+  }
+
+  lifecycle {
+    ignore_changes = [tags]
+  }
+}
+
+resource "azurerm_key_vault" "kv" {
+  name     = "kv"
+  sku_name = "premium"
+
+  network_acls {
+    default_action = "Deny"
+  }
+}
+
+data "azurerm_client_config" "current" {}
+
+removed {
+  from = azurerm_key_vault.old
+
+  lifecycle {
+    destroy = false
+  }
+}
+`
+
+// matchedBlocks evaluates q against every block of content and returns the
+// matches as "type label.label".
+func matchedBlocks(t *testing.T, content string, q blockQuery) []string {
+	t.Helper()
+	file, diags := hclparse.NewParser().ParseHCL([]byte(content), "main.tf")
+	if diags.HasErrors() {
+		t.Fatalf("fixture does not parse: %v", diags)
+	}
+
+	var out []string
+	var walk func(body *hclsyntax.Body, parent *queryNode)
+	walk = func(body *hclsyntax.Body, parent *queryNode) {
+		for _, bl := range body.Blocks {
+			node := &queryNode{
+				Type:         bl.Type,
+				Labels:       bl.Labels,
+				bodyLoaded:   true,
+				parsedBody:   bl.Body,
+				content:      content,
+				parentLoaded: true,
+				parentNode:   parent,
+			}
+			if q.matches(node) {
+				out = append(out, strings.TrimSpace(bl.Type+" "+strings.Join(bl.Labels, ".")))
+			}
+			walk(bl.Body, node)
+		}
+	}
+	walk(file.Body.(*hclsyntax.Body), nil)
+	return out
+}
+
+func TestBlockQueryMatches(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: `resource "azurerm_storage"`, want: []string{"resource azurerm_storage_account.sa"}},
+		{query: `resource "azurerm_*" "kv"`, want: []string{"resource azurerm_key_vault.kv"}},
+		{query: `resource "azurerm_*" !has:tags`, want: []string{"resource azurerm_key_vault.kv"}},
+		{query: `resource "azurerm_*" has:lifecycle.ignore_changes`, want: []string{"resource azurerm_storage_account.sa"}},
+		{query: `resource "azurerm_storage_account" min_tls_version != "TLS1_2"`, want: []string{"resource azurerm_storage_account.sa"}},
+		{query: `resource "azurerm_*" sku_name ~ "PREM"`, want: []string{"resource azurerm_key_vault.kv"}},
+		{query: `resource "azurerm_*" name = "sa" OR sku_name = "premium"`, want: []string{"resource azurerm_storage_account.sa", "resource azurerm_key_vault.kv"}},
+		{query: `resource "azurerm_*" (has:tags || has:network_acls) name = "kv"`, want: []string{"resource azurerm_key_vault.kv"}},
+		{query: `resource "azurerm_*" > dynamic "identity"`, want: []string{"dynamic identity"}},
+		{query: `resource > content`, want: nil},
+		{query: `resource >> content type = "UserAssigned"`, want: []string{"content"}},
+		{query: `resource > lifecycle`, want: []string{"lifecycle"}},
+		{query: `removed > lifecycle has:destroy`, want: []string{"lifecycle"}},
+		{query: `lifecycle`, want: []string{"lifecycle", "lifecycle"}},
+		{query: `data "azurerm_client_config"`, want: []string{"data azurerm_client_config.current"}},
+		{query: `resource "azurerm_key_vault" >> network_acls default_action = "Allow"`, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := parseBlockQuery(tt.query)
+			if err != nil {
+				t.Fatalf("parseBlockQuery(%q) error: %v", tt.query, err)
+			}
+			if got := matchedBlocks(t, blockQueryFixture, q); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matches = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePatternQuery(t *testing.T) {
+	indexed := func(blockType string) bool {
+		return blockType == "ip_configuration" || blockType == "lifecycle"
+	}
+
+	tests := []struct {
+		pattern string
+		query   bool
+		wantErr bool
+	}{
+		{pattern: `dynamic "identity"`, query: true},
+		{pattern: `ip_configuration`, query: true},
+		{pattern: `lifecycle {`, query: true},
+		{pattern: `for_each`, query: false},
+		{pattern: `subnet_id`, query: false},
+		{pattern: `subnet_id | count`, query: true},
+		{pattern: `azurerm_storage_account.this.id`, query: false},
+		{pattern: `resource "azurerm_`, query: true},
+		{pattern: `dynamic "contact" {`, query: true},
+		{pattern: `resource "azurerm_key vault`, wantErr: true},
+		{pattern: `resource "x" { name = 1 }`, wantErr: true},
+		{pattern: `resource "x" !has:`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			q, err := parsePatternQuery(tt.pattern, indexed)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePatternQuery(%q) error = %v, want error %v", tt.pattern, err, tt.wantErr)
+			}
+			if !tt.wantErr && (q != nil) != tt.query {
+				t.Errorf("parsePatternQuery(%q) query = %v, want query %v", tt.pattern, q != nil, tt.query)
+			}
+		})
+	}
+}
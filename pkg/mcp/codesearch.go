@@ -0,0 +1,198 @@
+package mcp
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+
+	"github.com/dkooll/wamcp/internal/database"
+	"github.com/dkooll/wamcp/internal/formatter"
+)
+
+// codePattern is a compiled search_code query for the regex, literal and
+// symbol modes. prefilter is an FTS5 expression every matching file satisfies,
+// or empty when the pattern has no usable literal text.
+type codePattern struct {
+	re        *regexp.Regexp
+	prefilter string
+	symbol    bool
+}
+
+// ftsHighlightPattern locates full-text hits in file content: any of the query
+// variants, case-insensitively, on the token boundaries the FTS index uses.
+// Words of a variant may be joined by any separator, so "key vault" also
+// highlights key_vault.
+func ftsHighlightPattern(variants []string) *codePattern {
+	alternatives := make([]string, 0, len(variants))
+	for _, v := range variants {
+		if words := strings.Fields(v); len(words) > 0 {
+			for i, w := range words {
+				words[i] = regexp.QuoteMeta(w)
+			}
+			alternatives = append(alternatives, strings.Join(words, `[^\pL\pN]+`))
+		}
+	}
+	if len(alternatives) == 0 {
+		return nil
+	}
+	return &codePattern{
+		re:     regexp.MustCompile(`(?i)(?:^|[^\pL\pN])(` + strings.Join(alternatives, "|") + `)(?:[^\pL\pN]|$)`),
+		symbol: true,
+	}
+}
+
+// compileCodePattern builds the matcher for a search mode. Literal and symbol
+// searches are case-sensitive; a symbol only matches as a whole identifier, so
+// subnet_id matches var.subnet_id but not subnet_ids.
+func compileCodePattern(mode, query string) (*codePattern, error) {
+	var expr string
+	switch mode {
+	case "regex":
+		expr = query
+	case "literal":
+		expr = regexp.QuoteMeta(query)
+	case "symbol":
+		expr = `(?:^|[^\w-])(` + regexp.QuoteMeta(query) + `)(?:[^\w-]|$)`
+	default:
+		return nil, fmt.Errorf("unsupported mode '%s'", mode)
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %v", err)
+	}
+
+	var prefilter string
+	if mode == "symbol" {
+		prefilter = ftsPrefilter([]string{query}, true)
+	} else if parsed, err := syntax.Parse(expr, syntax.Perl); err == nil {
+		prefilter = ftsPrefilter(requiredLiterals(parsed.Simplify()), false)
+	}
+	return &codePattern{re: re, prefilter: prefilter, symbol: mode == "symbol"}, nil
+}
+
+// requiredLiterals returns literal runs that any match of re must contain.
+func requiredLiterals(re *syntax.Regexp) []string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		return []string{string(re.Rune)}
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredLiterals(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min >= 1 {
+			return requiredLiterals(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		var runs []string
+		var cur strings.Builder
+		flush := func() {
+			if cur.Len() > 0 {
+				runs = append(runs, cur.String())
+				cur.Reset()
+			}
+		}
+		for _, sub := range re.Sub {
+			if sub.Op == syntax.OpLiteral {
+				cur.WriteString(string(sub.Rune))
+				continue
+			}
+			flush()
+			runs = append(runs, requiredLiterals(sub)...)
+		}
+		flush()
+		return runs
+	}
+	return nil
+}
+
+// ftsPrefilter turns literal runs into an FTS5 expression of token phrases.
+// Unless the runs are whole identifiers, a run may start or end inside a
+// token, so a leading word is dropped and a trailing word becomes a prefix.
+func ftsPrefilter(runs []string, whole bool) string {
+	isWord := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+	var phrases []string
+	for _, run := range runs {
+		words := strings.FieldsFunc(run, func(r rune) bool { return !isWord(r) })
+		if len(words) == 0 {
+			continue
+		}
+		runes := []rune(run)
+		prefix := false
+		if !whole {
+			if isWord(runes[0]) {
+				words = words[1:]
+			}
+			prefix = isWord(runes[len(runes)-1])
+		}
+		if len(words) == 0 {
+			continue
+		}
+		phrase := `"` + strings.ToLower(strings.Join(words, " ")) + `"`
+		if prefix {
+			phrase += "*"
+		}
+		phrases = append(phrases, phrase)
+	}
+	return strings.Join(phrases, " AND ")
+}
+
+// findCodeMatches returns every match of p in content with the line and
+// column it starts at. Patterns run against the whole file, so regular
+// expressions may span lines.
+func (p *codePattern) findCodeMatches(content string) []formatter.CodeMatch {
+	var matches []formatter.CodeMatch
+	line, lineStart, scanned := 1, 0, 0
+	for _, loc := range p.re.FindAllStringSubmatchIndex(content, -1) {
+		start := loc[0]
+		if p.symbol {
+			start = loc[2]
+		}
+		for ; scanned < start; scanned++ {
+			if content[scanned] == '\n' {
+				line++
+				lineStart = scanned + 1
+			}
+		}
+		lineEnd := strings.IndexByte(content[lineStart:], '\n')
+		if lineEnd < 0 {
+			lineEnd = len(content) - lineStart
+		}
+		matches = append(matches, formatter.CodeMatch{
+			Line:   line,
+			Column: len([]rune(content[lineStart:start])) + 1,
+			Offset: start,
+			Text:   content[lineStart : lineStart+lineEnd],
+		})
+	}
+	return matches
+}
+
+// annotateBlocks records the top-level block enclosing each match.
+func annotateBlocks(matches []formatter.CodeMatch, blocks []database.HCLBlock) {
+	for i := range matches {
+		for _, b := range blocks {
+			if int64(matches[i].Offset) >= b.StartByte && int64(matches[i].Offset) < b.EndByte {
+				matches[i].Block = strings.TrimSpace(b.BlockType + " " + b.Labels.String)
+				break
+			}
+		}
+	}
+}
+
+// normalizeFileType maps common extensions to the file types recorded at
+// index time, so "tf" and "md" work as well as "terraform" and "markdown".
+func normalizeFileType(fileType string) string {
+	switch ft := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(fileType), ".")); ft {
+	case "tf", "hcl":
+		return "terraform"
+	case "md":
+		return "markdown"
+	case "yml":
+		return "yaml"
+	default:
+		return ft
+	}
+}
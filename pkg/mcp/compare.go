@@ -0,0 +1,102 @@
+package mcp
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/dkooll/wamcp/internal/database"
+	"github.com/dkooll/wamcp/internal/formatter"
+)
+
+// alignmentKey identifies an attribute across modules regardless of the
+// blocks each module sets it on: resource, data and module arguments align on
+// attribute path, outputs and locals on their own name.
+func alignmentKey(rel database.HCLRelationship) string {
+	switch rel.BlockType {
+	case "resource", "data", "module":
+		return rel.AttributePath
+	case "locals":
+		return "local." + rel.AttributePath
+	case "output":
+		return "output." + rel.BlockLabels
+	}
+	return rel.BlockType + " · " + rel.AttributePath
+}
+
+// alignRelationships groups the relationships of each module by alignment key
+// and classifies how the wiring differs between modules.
+func alignRelationships(modules []string, rels map[string][]database.HCLRelationship, files map[string]map[string]*database.ModuleFile) []formatter.RelationshipAlignment {
+	byKey := make(map[string]map[string][]formatter.RelationshipWiring)
+	for _, name := range modules {
+		for _, rel := range rels[name] {
+			key := alignmentKey(rel)
+			if byKey[key] == nil {
+				byKey[key] = make(map[string][]formatter.RelationshipWiring)
+			}
+			w := formatter.RelationshipWiring{
+				Module:    name,
+				Block:     formatter.DescribeBlock(rel.BlockType, rel.BlockLabels),
+				Kind:      rel.ReferenceType,
+				Reference: rel.ReferenceName,
+				Source:    rel.IteratorSource,
+				File:      rel.FilePath,
+			}
+			if f, ok := files[name][rel.FilePath]; ok {
+				w.Line = lineForByte(f.Content, rel.StartByte)
+			}
+			byKey[key][name] = append(byKey[key][name], w)
+		}
+	}
+
+	out := make([]formatter.RelationshipAlignment, 0, len(byKey))
+	for key, perModule := range byKey {
+		a := formatter.RelationshipAlignment{Key: key}
+		kinds := make(map[string]bool)
+		symbols := make(map[string]bool)
+		for _, name := range modules {
+			wiring, ok := perModule[name]
+			if !ok {
+				a.Missing = append(a.Missing, name)
+				continue
+			}
+			a.Wiring = append(a.Wiring, wiring...)
+			kinds[wiringSignature(wiring, func(w formatter.RelationshipWiring) string { return w.Kind })] = true
+			symbols[wiringSignature(wiring, func(w formatter.RelationshipWiring) string { return w.Kind + ":" + w.Reference })] = true
+		}
+
+		switch {
+		case len(a.Missing) > 0:
+			a.Status = "partial"
+		case len(kinds) > 1:
+			a.Status = "different sources"
+		case len(symbols) > 1:
+			a.Status = "different symbols"
+		default:
+			a.Status = "identical"
+		}
+		out = append(out, a)
+	}
+
+	rank := map[string]int{"different sources": 0, "different symbols": 1, "partial": 2, "identical": 3}
+	sort.Slice(out, func(i, j int) bool {
+		if rank[out[i].Status] != rank[out[j].Status] {
+			return rank[out[i].Status] < rank[out[j].Status]
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out
+}
+
+func wiringSignature(wiring []formatter.RelationshipWiring, part func(formatter.RelationshipWiring) string) string {
+	seen := make(map[string]bool)
+	var parts []string
+	for _, w := range wiring {
+		p := part(w)
+		if !seen[p] {
+			seen[p] = true
+			parts = append(parts, p)
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "|")
+}
@@ -0,0 +1,445 @@
+package mcp
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/dkooll/wamcp/internal/database"
+	"github.com/dkooll/wamcp/internal/formatter"
+)
+
+// flowEdge is one indexed reference: the attribute Attribute of block To reads
+// the symbol From (below which it reads Field). Iterator reads (each.value.x,
+// count.index, <dynamic>.value.x) carry the iteration attribute they depend on
+// in Iter instead of a From symbol.
+type flowEdge struct {
+	From      string
+	Field     string
+	Iter      string
+	To        string
+	Attribute string
+	Rel       database.HCLRelationship
+}
+
+// flowGraph is the per-module reference graph built from hcl_relationships.
+type flowGraph struct {
+	consumers map[string][]flowEdge
+	iterators map[string][]flowEdge
+}
+
+func buildFlowGraph(rels []database.HCLRelationship) *flowGraph {
+	g := &flowGraph{
+		consumers: make(map[string][]flowEdge),
+		iterators: make(map[string][]flowEdge),
+	}
+	for _, rel := range rels {
+		to := blockNode(rel.BlockType, rel.BlockLabels, rel.AttributePath)
+		if to == "" {
+			continue
+		}
+		edge := flowEdge{To: to, Attribute: rel.AttributePath, Rel: rel}
+
+		if iter, field, ok := iteratorReference(rel); ok {
+			edge.Iter = iter
+			edge.Field = field
+			key := to + "|" + iter
+			g.iterators[key] = append(g.iterators[key], edge)
+			continue
+		}
+
+		from, field := referenceNode(rel.ReferenceType, rel.ReferenceName)
+		if from == "" || from == to {
+			continue
+		}
+		edge.From = from
+		edge.Field = field
+		g.consumers[from] = append(g.consumers[from], edge)
+	}
+	return g
+}
+
+// blockNode names the graph node for the block that holds a reference.
+func blockNode(blockType, labels, attrPath string) string {
+	switch blockType {
+	case "resource":
+		return labels
+	case "data":
+		return "data." + labels
+	case "module":
+		return "module." + labels
+	case "output":
+		return "output." + labels
+	case "locals":
+		name, _, _ := strings.Cut(attrPath, ".")
+		return "local." + name
+	}
+	return ""
+}
+
+// referenceNode splits a reference into the graph node it points at and the
+// field path read below it, e.g. var.config.subnet_id -> (var.config, subnet_id).
+func referenceNode(refType, refName string) (string, string) {
+	segments := 0
+	switch refType {
+	case "variable", "local", "module_output", "resource":
+		segments = 2
+	case "data_source":
+		segments = 3
+	default:
+		return "", ""
+	}
+
+	parts := strings.Split(refName, ".")
+	if len(parts) < segments {
+		return "", ""
+	}
+	for i := 0; i < segments; i++ {
+		parts[i], _, _ = strings.Cut(parts[i], "[")
+	}
+	return strings.Join(parts[:segments], "."), strings.Join(parts[segments:], ".")
+}
+
+// iteratorReference recognises references to the current iteration element
+// and returns the attribute that defines the iteration plus the field read
+// from the element.
+func iteratorReference(rel database.HCLRelationship) (string, string, bool) {
+	root, rest, _ := strings.Cut(rel.ReferenceName, ".")
+	field := strings.TrimPrefix(strings.TrimPrefix(rest, "value"), ".")
+	switch root {
+	case "each":
+		return "for_each", field, true
+	case "count":
+		return "count", "", true
+	}
+
+	marker := "dynamic." + root + "."
+	if idx := strings.Index("."+rel.AttributePath, "."+marker); idx >= 0 {
+		return rel.AttributePath[:idx+len(marker)-1] + ".for_each", field, true
+	}
+
+	// Dynamic blocks with a custom iterator name: the indexer resolved the
+	// reference as a loop, so it belongs to the innermost enclosing dynamic.
+	if rel.ReferenceType == "loop" {
+		segments := strings.Split(rel.AttributePath, ".")
+		for i := len(segments) - 2; i >= 0; i-- {
+			if segments[i] == "dynamic" {
+				return strings.Join(segments[:i+2], ".") + ".for_each", field, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+func isIterationAttribute(attr string) bool {
+	return attr == "for_each" || attr == "count" || strings.HasSuffix(attr, ".for_each") && strings.Contains(attr, "dynamic.")
+}
+
+func nodeKind(node string) string {
+	root, _, _ := strings.Cut(node, ".")
+	switch root {
+	case "var":
+		return "variable"
+	case "local":
+		return "local"
+	case "module":
+		return "module"
+	case "data":
+		return "data"
+	case "output":
+		return "output"
+	}
+	return "resource"
+}
+
+// parseFlowSymbol splits a user supplied symbol such as var.config.subnet_id or
+// azurerm_subnet.this into node and field.
+func parseFlowSymbol(symbol string) (string, string) {
+	symbol = strings.TrimSpace(symbol)
+	refType := "resource"
+	switch nodeKind(symbol) {
+	case "variable":
+		refType = "variable"
+	case "local":
+		refType = "local"
+	case "module":
+		refType = "module_output"
+	case "data":
+		refType = "data_source"
+	case "output":
+		return symbol, ""
+	}
+	return referenceNode(refType, symbol)
+}
+
+// fieldsCompatible reports whether a reference reading ref below a node can
+// carry the value at field; an empty side means the whole value.
+func fieldsCompatible(ref, field string) bool {
+	if ref == "" || field == "" || ref == field {
+		return true
+	}
+	return strings.HasPrefix(ref, field+".") || strings.HasPrefix(field, ref+".")
+}
+
+// nextField is the part of field still to be located after a hop that read ref.
+func nextField(ref, field string) string {
+	switch {
+	case field == "":
+		return ""
+	case ref == "":
+		return field
+	case strings.HasPrefix(field, ref+"."):
+		return strings.TrimPrefix(field, ref+".")
+	}
+	return ""
+}
+
+// matchesFlowTarget reports whether a hop lands on the requested target, which
+// may name a node, a node attribute, or a resource type attribute such as
+// azurerm_private_endpoint.subnet_id.
+func matchesFlowTarget(e flowEdge, target string) bool {
+	candidates := []string{e.To, e.To + "." + e.Attribute}
+	if nodeKind(e.To) == "resource" {
+		resourceType, _, _ := strings.Cut(e.To, ".")
+		candidates = append(candidates, resourceType+"."+e.Attribute)
+	}
+	for _, c := range candidates {
+		if c == target || strings.HasPrefix(c, target+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// tracePaths walks the graph from node (reading field) and returns each path
+// that reaches target, or, without a target, each path that ends at a resource,
+// data source or module argument (for input symbols) or at an output (for
+// resources, data sources and module calls).
+func (g *flowGraph) tracePaths(node, field, target string, maxDepth, limit int) ([][]flowEdge, bool) {
+	toOutputs := false
+	switch nodeKind(node) {
+	case "resource", "data", "module":
+		toOutputs = true
+	}
+
+	var (
+		paths     [][]flowEdge
+		truncated bool
+		visited   = make(map[string]bool)
+	)
+
+	var walk func(node, field, iter string, path []flowEdge)
+	walk = func(node, field, iter string, path []flowEdge) {
+		if len(path) >= maxDepth {
+			return
+		}
+		next := g.consumers[node]
+		if iter != "" {
+			next = g.iterators[node+"|"+iter]
+		}
+		for _, e := range next {
+			if len(paths) >= limit {
+				truncated = true
+				return
+			}
+			if !fieldsCompatible(e.Field, field) {
+				continue
+			}
+			key := e.To + "." + e.Attribute
+			if visited[key] {
+				continue
+			}
+			visited[key] = true
+
+			hop := append(append([]flowEdge(nil), path...), e)
+			nf := nextField(e.Field, field)
+			kind := nodeKind(e.To)
+
+			switch {
+			case target != "" && matchesFlowTarget(e, target):
+				paths = append(paths, hop)
+			case isIterationAttribute(e.Attribute):
+				// Elements are read relative to the iterated collection, so the
+				// remaining field no longer applies below this hop.
+				walk(e.To, "", e.Attribute, hop)
+			case kind == "local":
+				walk(e.To, nf, "", hop)
+			case kind == "output":
+				if target == "" {
+					paths = append(paths, hop)
+				}
+			case target != "" || toOutputs:
+				walk(e.To, "", "", hop)
+			default:
+				paths = append(paths, hop)
+			}
+
+			visited[key] = false
+		}
+	}
+
+	walk(node, field, "", nil)
+	return paths, truncated
+}
+
+// declaredNodes lists the graph nodes a module declares, so blocks nothing
+// references still appear in an exported graph.
+func declaredNodes(blocks []database.HCLBlock) []string {
+	var nodes []string
+	for _, b := range blocks {
+		labels := b.Labels.String
+		switch b.BlockType {
+		case "variable":
+			nodes = append(nodes, "var."+labels)
+		case "locals":
+			for _, attr := range strings.Split(b.AttrPaths.String, "\n") {
+				if attr != "" && !strings.Contains(attr, ".") {
+					nodes = append(nodes, "local."+attr)
+				}
+			}
+		default:
+			if node := blockNode(b.BlockType, labels, ""); node != "" {
+				nodes = append(nodes, node)
+			}
+		}
+	}
+	return nodes
+}
+
+// graphNodeID maps a node to its identity in an exported graph; collapsing
+// folds resources and data sources into one node per type.
+func graphNodeID(node string, collapse bool) string {
+	if !collapse {
+		return node
+	}
+	switch nodeKind(node) {
+	case "resource":
+		resourceType, _, _ := strings.Cut(node, ".")
+		return resourceType
+	case "data":
+		parts := strings.SplitN(node, ".", 3)
+		if len(parts) == 3 {
+			return parts[0] + "." + parts[1]
+		}
+	}
+	return node
+}
+
+// edgeLabel names the argument a dependency feeds: the top-level attribute, or
+// dynamic.<name> for dynamic blocks. Locals and outputs need no label.
+func edgeLabel(e flowEdge) string {
+	switch nodeKind(e.To) {
+	case "local", "output":
+		return ""
+	}
+	parts := strings.Split(e.Attribute, ".")
+	if parts[0] == "dynamic" && len(parts) > 1 {
+		return parts[0] + "." + parts[1]
+	}
+	return parts[0]
+}
+
+// moduleGraph assembles the dependency graph of a module, optionally collapsed
+// by type and narrowed to nodes matching term plus their direct neighbours.
+func moduleGraph(g *flowGraph, declared []string, collapse bool, term string) ([]formatter.GraphNode, []formatter.GraphEdge) {
+	nodes := make(map[string]string)
+	for _, n := range declared {
+		nodes[graphNodeID(n, collapse)] = nodeKind(n)
+	}
+
+	type edgeKey struct{ from, to string }
+	labels := make(map[edgeKey]map[string]bool)
+	for from, edges := range g.consumers {
+		for _, e := range edges {
+			key := edgeKey{graphNodeID(from, collapse), graphNodeID(e.To, collapse)}
+			if key.from == key.to {
+				continue
+			}
+			nodes[key.from] = nodeKind(from)
+			nodes[key.to] = nodeKind(e.To)
+			if labels[key] == nil {
+				labels[key] = make(map[string]bool)
+			}
+			if l := edgeLabel(e); l != "" {
+				labels[key][l] = true
+			}
+		}
+	}
+
+	var selected map[string]bool
+	if term = strings.ToLower(strings.TrimSpace(term)); term != "" {
+		selected = make(map[string]bool)
+		for id := range nodes {
+			if strings.Contains(strings.ToLower(id), term) {
+				selected[id] = true
+			}
+		}
+	}
+	keepEdge := func(from, to string) bool {
+		return selected == nil || selected[from] || selected[to]
+	}
+	keep := func(id string) bool {
+		if selected == nil || selected[id] {
+			return true
+		}
+		for key := range labels {
+			if key.from == id && selected[key.to] || key.to == id && selected[key.from] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var outNodes []formatter.GraphNode
+	for id, kind := range nodes {
+		if keep(id) {
+			outNodes = append(outNodes, formatter.GraphNode{ID: id, Kind: kind})
+		}
+	}
+	sort.Slice(outNodes, func(i, j int) bool {
+		if outNodes[i].Kind != outNodes[j].Kind {
+			return graphKindOrder(outNodes[i].Kind) < graphKindOrder(outNodes[j].Kind)
+		}
+		return outNodes[i].ID < outNodes[j].ID
+	})
+
+	var outEdges []formatter.GraphEdge
+	for key, set := range labels {
+		if !keepEdge(key.from, key.to) {
+			continue
+		}
+		edge := formatter.GraphEdge{From: key.from, To: key.to}
+		for l := range set {
+			edge.Labels = append(edge.Labels, l)
+		}
+		sort.Strings(edge.Labels)
+		outEdges = append(outEdges, edge)
+	}
+	sort.Slice(outEdges, func(i, j int) bool {
+		if outEdges[i].From != outEdges[j].From {
+			return outEdges[i].From < outEdges[j].From
+		}
+		return outEdges[i].To < outEdges[j].To
+	})
+
+	return outNodes, outEdges
+}
+
+func graphKindOrder(kind string) int {
+	switch kind {
+	case "variable":
+		return 0
+	case "local":
+		return 1
+	case "data":
+		return 2
+	case "resource":
+		return 3
+	case "module":
+		return 4
+	}
+	return 5
+}
+
+func lineForByte(content string, offset int64) int {
+	return 1 + strings.Count(content[:min(max(int(offset), 0), len(content))], "\n")
+}
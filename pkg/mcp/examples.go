@@ -0,0 +1,492 @@
+package mcp
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/dkooll/wamcp/internal/database"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// exampleCall is a module block inside an example that calls the module
+// (or one of its submodules), with the inputs it sets.
+type exampleCall struct {
+	Example database.ModuleExample
+	Name    string
+	Target  string
+	File    string
+	Line    int
+	Inputs  []exampleInput
+}
+
+// exampleInput is one argument of an example module call. Paths holds the
+// nested attribute paths set below the variable, with map and list keys
+// replaced by '*' when the variable type declares a collection.
+type exampleInput struct {
+	Variable string
+	Declared bool
+	Paths    []string
+}
+
+// typeNode is the shape of a variable type constraint. A nil node means the
+// shape is unknown (any, tuple, or unparseable); a node without Attrs or Elem
+// is a primitive.
+type typeNode struct {
+	Attrs    map[string]*typeNode
+	Elem     *typeNode
+	Optional bool
+}
+
+// typePath is an attribute path declared by a variable type.
+type typePath struct {
+	Path     string
+	Optional bool
+}
+
+var moduleMetaArguments = map[string]bool{
+	"source":     true,
+	"version":    true,
+	"providers":  true,
+	"depends_on": true,
+	"count":      true,
+	"for_each":   true,
+}
+
+// exampleModuleCalls returns the calls an example makes to the module it
+// belongs to or to one of that module's submodules.
+func (s *Server) exampleModuleCalls(module *database.Module, ex database.ModuleExample, files map[string]*database.ModuleFile) []exampleCall {
+	blocks, err := s.db.GetExampleBlocks(ex.ID, "module")
+	if err != nil {
+		return nil
+	}
+
+	rootName, _, _ := strings.Cut(module.Name, "//")
+
+	var calls []exampleCall
+	for _, b := range blocks {
+		file, ok := files[b.FilePath]
+		if !ok {
+			continue
+		}
+		snippet := blockSource(file.Content, b.StartByte, b.EndByte)
+		body := parseBlockSnippet(snippet)
+		if body == nil {
+			continue
+		}
+		sourceAttr, ok := body.Attributes["source"]
+		if !ok {
+			continue
+		}
+		source, _ := sourceAttr.Expr.Value(nil)
+		if source.IsNull() || !source.IsKnown() || source.Type() != cty.String {
+			continue
+		}
+		target := moduleCallTarget(source.AsString(), ex.Path, rootName)
+		if target == "" {
+			continue
+		}
+
+		call := exampleCall{
+			Example: ex,
+			Name:    b.Labels.String,
+			Target:  target,
+			File:    b.FilePath,
+			Line:    lineForByte(file.Content, b.StartByte),
+		}
+
+		variables := s.variableTypes(target)
+		names := make([]string, 0, len(body.Attributes))
+		for name := range body.Attributes {
+			if !moduleMetaArguments[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			t, declared := variables[name]
+			seen := make(map[string]bool)
+			collectSetPaths(body.Attributes[name].Expr, t, name, seen)
+			delete(seen, name)
+			paths := make([]string, 0, len(seen))
+			for p := range seen {
+				paths = append(paths, p)
+			}
+			sort.Strings(paths)
+			call.Inputs = append(call.Inputs, exampleInput{Variable: name, Declared: declared || variables == nil, Paths: paths})
+		}
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+// moduleCallTarget resolves a module source used in an example to the name of
+// the called module: the root module, a submodule (root//modules/x), or "" when
+// the source points elsewhere. Relative sources are resolved from the example
+// directory; registry and git sources are matched by repository name.
+func moduleCallTarget(source, examplePath, rootName string) string {
+	if strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") {
+		resolved := path.Clean(path.Join(examplePath, source))
+		switch {
+		case resolved == ".":
+			return rootName
+		case strings.HasPrefix(resolved, "modules/"):
+			return rootName + "//" + resolved
+		}
+		return ""
+	}
+
+	base, sub, _ := strings.Cut(strings.TrimPrefix(source, "git::"), "//")
+	if sub != "" {
+		sub, _, _ = strings.Cut(sub, "?")
+		sub = "//" + strings.TrimSuffix(sub, "/")
+	}
+
+	parts := strings.Split(base, "/")
+	if len(parts) == 3 && !strings.Contains(parts[0], ".") {
+		if "terraform-"+parts[2]+"-"+parts[1] == rootName {
+			return rootName + sub
+		}
+		return ""
+	}
+
+	base, _, _ = strings.Cut(base, "?")
+	base = strings.TrimSuffix(base, ".git")
+	if path.Base(base) == rootName {
+		return rootName + sub
+	}
+	return ""
+}
+
+// variableTypes parses the type constraints of a module's variables, keyed by
+// variable name. It returns nil when the module is not indexed.
+func (s *Server) variableTypes(moduleName string) map[string]*typeNode {
+	module, err := s.db.GetModule(moduleName)
+	if err != nil {
+		return nil
+	}
+	variables, err := s.db.GetModuleVariables(module.ID)
+	if err != nil {
+		return nil
+	}
+	types := make(map[string]*typeNode, len(variables))
+	for _, v := range variables {
+		types[v.Name] = parseTypeConstraint(v.Type)
+	}
+	return types
+}
+
+func parseTypeConstraint(text string) *typeNode {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	expr, diags := hclsyntax.ParseExpression([]byte(text), "type.tf", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil
+	}
+	return typeFromExpr(expr)
+}
+
+func typeFromExpr(expr hclsyntax.Expression) *typeNode {
+	switch e := expr.(type) {
+	case *hclsyntax.ScopeTraversalExpr:
+		if e.Traversal.RootName() == "any" {
+			return nil
+		}
+		return &typeNode{}
+	case *hclsyntax.FunctionCallExpr:
+		if len(e.Args) == 0 {
+			return nil
+		}
+		switch e.Name {
+		case "object":
+			obj, ok := e.Args[0].(*hclsyntax.ObjectConsExpr)
+			if !ok {
+				return nil
+			}
+			node := &typeNode{Attrs: make(map[string]*typeNode, len(obj.Items))}
+			for _, item := range obj.Items {
+				if key := objectKey(item.KeyExpr); key != "" {
+					node.Attrs[key] = typeFromExpr(item.ValueExpr)
+				}
+			}
+			return node
+		case "optional":
+			node := typeFromExpr(e.Args[0])
+			if node == nil {
+				node = &typeNode{}
+			}
+			node.Optional = true
+			return node
+		case "map", "list", "set":
+			return &typeNode{Elem: typeFromExpr(e.Args[0])}
+		}
+	}
+	return nil
+}
+
+// typePaths lists every attribute path a type declares below prefix; collection
+// elements contribute a '*' segment.
+func typePaths(t *typeNode, prefix string) []typePath {
+	if t == nil {
+		return nil
+	}
+	var out []typePath
+	if t.Elem != nil {
+		out = append(out, typePaths(t.Elem, prefix+".*")...)
+	}
+	keys := make([]string, 0, len(t.Attrs))
+	for k := range t.Attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		child := t.Attrs[k]
+		p := prefix + "." + k
+		out = append(out, typePath{Path: p, Optional: child != nil && child.Optional})
+		out = append(out, typePaths(child, p)...)
+	}
+	return out
+}
+
+// collectSetPaths records the attribute paths an argument value sets, following
+// object and tuple constructors (and both branches of conditionals and merge
+// arguments). Paths stop at any other expression since its shape is unknown.
+func collectSetPaths(expr hclsyntax.Expression, t *typeNode, prefix string, seen map[string]bool) {
+	seen[prefix] = true
+
+	switch e := expr.(type) {
+	case *hclsyntax.ObjectConsExpr:
+		for _, item := range e.Items {
+			key := objectKey(item.KeyExpr)
+			if key == "" {
+				continue
+			}
+			var child *typeNode
+			segment := key
+			switch {
+			case t != nil && t.Attrs != nil:
+				child = t.Attrs[key]
+			case t != nil && t.Elem != nil:
+				segment = "*"
+				child = t.Elem
+			}
+			collectSetPaths(item.ValueExpr, child, prefix+"."+segment, seen)
+		}
+	case *hclsyntax.TupleConsExpr:
+		if t != nil && t.Elem != nil {
+			for _, item := range e.Exprs {
+				collectSetPaths(item, t.Elem, prefix+".*", seen)
+			}
+		}
+	case *hclsyntax.ConditionalExpr:
+		collectSetPaths(e.TrueResult, t, prefix, seen)
+		collectSetPaths(e.FalseResult, t, prefix, seen)
+	case *hclsyntax.ParenthesesExpr:
+		collectSetPaths(e.Expression, t, prefix, seen)
+	case *hclsyntax.FunctionCallExpr:
+		if e.Name == "merge" {
+			for _, arg := range e.Args {
+				collectSetPaths(arg, t, prefix, seen)
+			}
+		}
+	}
+}
+
+func objectKey(expr hclsyntax.Expression) string {
+	if key, ok := expr.(*hclsyntax.ObjectConsKeyExpr); ok {
+		if name := hcl.ExprAsKeyword(key.Wrapped); name != "" {
+			return name
+		}
+		expr = key.Wrapped
+	}
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() || val.IsNull() || !val.IsKnown() || val.Type() != cty.String {
+		return ""
+	}
+	return val.AsString()
+}
+
+var exampleQueryStopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "the": true, "with": true, "that": true, "which": true,
+	"show": true, "me": true, "find": true, "example": true, "examples": true, "using": true,
+	"uses": true, "use": true, "configures": true, "configure": true, "configured": true,
+	"sets": true, "set": true, "for": true, "of": true, "to": true, "in": true, "on": true,
+	"enabled": true, "enable": true, "enables": true, "module": true, "is": true, "are": true,
+}
+
+// featureTerms splits text into lower-case terms, dropping stopwords and a
+// plural 's' so "private endpoints" and private_endpoint compare equal.
+func featureTerms(text string, dropStopwords bool) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return (r < 'a' || r > 'z') && (r < '0' || r > '9')
+	})
+	var out []string
+	for _, f := range fields {
+		if dropStopwords && exampleQueryStopwords[f] {
+			continue
+		}
+		if len(f) > 3 && strings.HasSuffix(f, "s") && !strings.HasSuffix(f, "ss") {
+			f = strings.TrimSuffix(f, "s")
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// matchExampleFeatures reports which query terms an example call covers and the
+// set paths that contributed to the match.
+func matchExampleFeatures(terms []string, exampleName string, calls []exampleCall) (matched []string, paths []string) {
+	pathTerms := make(map[string][]string)
+	add := func(p string) {
+		if _, ok := pathTerms[p]; !ok {
+			pathTerms[p] = featureTerms(p, false)
+		}
+	}
+	for _, c := range calls {
+		for _, in := range c.Inputs {
+			add(in.Variable)
+			for _, p := range in.Paths {
+				add(p)
+			}
+		}
+	}
+	nameTerms := featureTerms(exampleName, false)
+
+	hitPaths := make(map[string]bool)
+	for _, term := range terms {
+		found := false
+		for _, nt := range nameTerms {
+			if nt == term {
+				found = true
+			}
+		}
+		for p, pts := range pathTerms {
+			for _, pt := range pts {
+				if pt == term {
+					found = true
+					hitPaths[p] = true
+					break
+				}
+			}
+		}
+		if found {
+			matched = append(matched, term)
+		}
+	}
+
+	for p := range hitPaths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return matched, paths
+}
+
+// moduleCoverage is how much of a module's input surface its examples exercise.
+// Nested paths are the optional attributes declared in variable types.
+type moduleCoverage struct {
+	Module       database.Module
+	Examples     []string
+	Variables    []database.ModuleVariable
+	SetVariables map[string]bool
+	Paths        []string
+	SetPaths     map[string]bool
+	Opaque       []string
+}
+
+// exampleCoverage cross-references each module's variables with what the
+// module calls in every indexed example set.
+func (s *Server) exampleCoverage(modules []database.Module) ([]moduleCoverage, error) {
+	examples, err := s.db.ListExamples()
+	if err != nil {
+		return nil, err
+	}
+
+	type targetUsage struct {
+		examples map[string]bool
+		paths    map[string]bool
+		opaque   map[string]bool
+	}
+	usage := make(map[string]*targetUsage)
+
+	var (
+		owner *database.Module
+		files map[string]*database.ModuleFile
+	)
+	for _, ex := range examples {
+		if owner == nil || owner.ID != ex.ModuleID {
+			owner, err = s.db.GetModuleByID(ex.ModuleID)
+			if err != nil {
+				owner = nil
+				continue
+			}
+			files = s.moduleFileMap(owner.ID)
+		}
+		for _, call := range s.exampleModuleCalls(owner, ex, files) {
+			u, ok := usage[call.Target]
+			if !ok {
+				u = &targetUsage{examples: map[string]bool{}, paths: map[string]bool{}, opaque: map[string]bool{}}
+				usage[call.Target] = u
+			}
+			u.examples[ex.Name] = true
+			for _, in := range call.Inputs {
+				u.paths[in.Variable] = true
+				if len(in.Paths) == 0 {
+					u.opaque[in.Variable] = true
+				}
+				for _, p := range in.Paths {
+					u.paths[p] = true
+				}
+			}
+		}
+	}
+
+	coverage := make([]moduleCoverage, 0, len(modules))
+	for _, m := range modules {
+		variables, err := s.db.GetModuleVariables(m.ID)
+		if err != nil {
+			return nil, err
+		}
+		c := moduleCoverage{Module: m, Variables: variables, SetVariables: map[string]bool{}, SetPaths: map[string]bool{}}
+		u := usage[m.Name]
+		if u != nil {
+			for name := range u.examples {
+				c.Examples = append(c.Examples, name)
+			}
+			sort.Strings(c.Examples)
+		}
+
+		for _, v := range variables {
+			set := u != nil && u.paths[v.Name]
+			if set {
+				c.SetVariables[v.Name] = true
+			}
+			var nested []typePath
+			for _, tp := range typePaths(parseTypeConstraint(v.Type), v.Name) {
+				if tp.Optional {
+					nested = append(nested, tp)
+				}
+			}
+			if len(nested) == 0 {
+				continue
+			}
+			// A variable passed as a reference or function result hides which
+			// attributes it sets, so its nested paths cannot be judged.
+			if set && u.opaque[v.Name] {
+				c.Opaque = append(c.Opaque, v.Name)
+				continue
+			}
+			for _, tp := range nested {
+				c.Paths = append(c.Paths, tp.Path)
+				if u != nil && u.paths[tp.Path] {
+					c.SetPaths[tp.Path] = true
+				}
+			}
+		}
+		coverage = append(coverage, c)
+	}
+	return coverage, nil
+}
@@ -0,0 +1,181 @@
+package mcp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dkooll/wamcp/internal/database"
+)
+
+// relationshipIntent is what interpretRelationshipPrompt understood from a
+// natural-language relationship request.
+type relationshipIntent struct {
+	Modules       []*database.Module
+	Query         string
+	Limit         int
+	ReferenceType string
+	FilePath      string
+	ExcludePaths  []string
+}
+
+// Summary renders the interpretation so callers can see how the prompt was read.
+func (i relationshipIntent) Summary() string {
+	var parts []string
+	if len(i.Modules) > 0 {
+		names := make([]string, len(i.Modules))
+		for idx, m := range i.Modules {
+			names[idx] = m.Name
+		}
+		parts = append(parts, "modules: "+strings.Join(names, ", "))
+	} else {
+		parts = append(parts, "modules: all")
+	}
+	if i.Query != "" {
+		parts = append(parts, fmt.Sprintf("query: `%s`", i.Query))
+	}
+	if i.ReferenceType != "" {
+		parts = append(parts, "reference_type: "+i.ReferenceType)
+	}
+	if i.FilePath != "" {
+		parts = append(parts, fmt.Sprintf("files: `%s`", i.FilePath))
+	}
+	for _, p := range i.ExcludePaths {
+		parts = append(parts, fmt.Sprintf("excluding `%s`", p))
+	}
+	if i.Limit > 0 {
+		parts = append(parts, fmt.Sprintf("limit: %d", i.Limit))
+	}
+	return "_Interpreted prompt as " + strings.Join(parts, " · ") + "_\n\n"
+}
+
+var referenceKindPhrases = []struct {
+	re   *regexp.Regexp
+	kind string
+}{
+	{referenceKindRegex(`data[\s_-]*sources?`), "data_source"},
+	{referenceKindRegex(`module[\s_-]*outputs?`), "module_output"},
+	{referenceKindRegex(`variables?|inputs?`), "variable"},
+	{referenceKindRegex(`locals?`), "local"},
+	{referenceKindRegex(`resources?`), "resource"},
+	{referenceKindRegex(`loops?|iterators?|for_each`), "loop"},
+}
+
+// referenceKindRegex matches a reference kind phrase when it is marked as a
+// restriction: "only data sources", "data sources only" or "from variables".
+func referenceKindRegex(phrase string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)\b(?:(?:only|just)\s+(?:the\s+)?(?:` + phrase + `)|(?:` + phrase + `)\s+only|(?:from|via|through)\s+(?:the\s+)?(?:` + phrase + `))\b`)
+}
+
+var (
+	examplesExclusionRegex = regexp.MustCompile(`(?i)\b(?:not|excluding|except|without|outside(?:\s+of)?)\s+(?:in\s+|from\s+)?(?:the\s+|any\s+)?examples?\b`)
+	examplesOnlyRegex      = regexp.MustCompile(`(?i)\b(?:only\s+)?(?:in|within|inside|from)\s+(?:the\s+)?examples?\b(?:\s+only)?`)
+	fileExclusionRegex     = regexp.MustCompile(`(?i)\b(?:not|excluding|except|without)\s+(?:in\s+|from\s+)?(?:file\s+)?([\w./*-]+\.(?:tf|tfvars))\b`)
+	fileScopeRegex         = regexp.MustCompile(`(?i)\b(?:in|within|inside|from)\s+(?:the\s+)?(?:file\s+)?([\w./*-]+\.(?:tf|tfvars))\b`)
+	promptLimitRegex       = regexp.MustCompile(`(?i)\b(?:top|first|limit)\s+(\d{1,3})\b`)
+	allModulesRegex        = regexp.MustCompile(`(?i)\b(?:across|in|over)\s+(?:all\s+|every\s+|the\s+)*(?:modules|repos|repositories)\b|\bevery\s+module\b`)
+	moduleConnectors       = map[string]bool{"and": true, "vs": true, "versus": true, "or": true, "plus": true}
+)
+
+// extractReferenceKind recognises "only data sources", "data sources only" and
+// "from variables" style phrases.
+func extractReferenceKind(prompt string) (string, string) {
+	for _, phrase := range referenceKindPhrases {
+		if loc := phrase.re.FindStringIndex(prompt); loc != nil {
+			return phrase.kind, prompt[:loc[0]] + " " + prompt[loc[1]:]
+		}
+	}
+	return "", prompt
+}
+
+// extractFileScopes pulls example and file scoping phrases out of the prompt.
+// Negations are matched first so "not in examples" never reads as a scope.
+func extractFileScopes(prompt string) (string, []string, string) {
+	var include string
+	var exclude []string
+
+	if examplesExclusionRegex.MatchString(prompt) {
+		exclude = append(exclude, "examples/*")
+		prompt = examplesExclusionRegex.ReplaceAllString(prompt, " ")
+	}
+	prompt = fileExclusionRegex.ReplaceAllStringFunc(prompt, func(match string) string {
+		exclude = append(exclude, fileExclusionRegex.FindStringSubmatch(match)[1])
+		return " "
+	})
+	if m := fileScopeRegex.FindStringSubmatch(prompt); m != nil {
+		include = m[1]
+		prompt = strings.Replace(prompt, m[0], " ", 1)
+	} else if examplesOnlyRegex.MatchString(prompt) {
+		include = "examples/*"
+		prompt = examplesOnlyRegex.ReplaceAllString(prompt, " ")
+	}
+	return include, exclude, prompt
+}
+
+// extendModuleList grows the module found at tokens[indices] through connector
+// words ("redis and app", "kv vs sa") and returns all modules in prompt order.
+// Only exact names and aliases count here, since the full-text fallback of
+// resolveModule would accept ordinary words.
+func (s *Server) extendModuleList(tokens []promptToken, primary *database.Module, indices []int) ([]*database.Module, []int) {
+	modules := []*database.Module{primary}
+	seen := map[int64]bool{primary.ID: true}
+
+	tryWindow := func(start, end int) (*database.Module, bool) {
+		if start < 0 || end > len(tokens) || start >= end {
+			return nil, false
+		}
+		for _, candidate := range candidateModuleForms(tokens[start:end]) {
+			if m, err := s.strictModule(candidate); err == nil && !seen[m.ID] {
+				return m, true
+			}
+		}
+		return nil, false
+	}
+
+	first, last := indices[0], indices[len(indices)-1]
+	for first-1 >= 0 && moduleConnectors[tokens[first-1].Lower] {
+		found := false
+		for window := 3; window >= 1; window-- {
+			if m, ok := tryWindow(first-1-window, first-1); ok {
+				seen[m.ID] = true
+				modules = append([]*database.Module{m}, modules...)
+				for i := first - 1 - window; i < first; i++ {
+					indices = append(indices, i)
+				}
+				first -= 1 + window
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	for last+1 < len(tokens) && moduleConnectors[tokens[last+1].Lower] {
+		found := false
+		for window := 3; window >= 1; window-- {
+			if m, ok := tryWindow(last+2, last+2+window); ok {
+				seen[m.ID] = true
+				modules = append(modules, m)
+				for i := last + 1; i < last+2+window; i++ {
+					indices = append(indices, i)
+				}
+				last += 1 + window
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return modules, indices
+}
+
+// strictModule resolves a module by exact name or alias only.
+func (s *Server) strictModule(nameOrAlias string) (*database.Module, error) {
+	if m, err := s.db.GetModule(nameOrAlias); err == nil {
+		return m, nil
+	}
+	return s.db.ResolveModuleByAlias(nameOrAlias)
+}
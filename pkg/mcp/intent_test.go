@@ -0,0 +1,255 @@
+package mcp
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dkooll/wamcp/internal/database"
+)
+
+// newIntentServer returns a server over a fresh database holding a few
+// modules and the short aliases the prompts use.
+func newIntentServer(t *testing.T) *Server {
+	t.Helper()
+	db, err := database.New(filepath.Join(t.TempDir(), "intent.db"))
+	if err != nil {
+		// The schema needs FTS5, which go-sqlite3 only builds with -tags fts5.
+		t.Skipf("database unavailable: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	modules := map[string][]string{
+		"terraform-azure-kv":    {"kv", "keyvault"},
+		"terraform-azure-sa":    {"sa", "storage"},
+		"terraform-azure-vnet":  {"vnet"},
+		"terraform-azure-redis": {"redis"},
+		"terraform-azure-app":   {"app"},
+		"terraform-azure-aks":   {"aks"},
+	}
+	for name, aliases := range modules {
+		id, err := db.InsertModule(&database.Module{Name: name, FullName: "org/" + name})
+		if err != nil {
+			t.Fatalf("insert module %s: %v", name, err)
+		}
+		for _, alias := range aliases {
+			if err := db.InsertModuleAlias(id, alias, 10, "test"); err != nil {
+				t.Fatalf("insert alias %s: %v", alias, err)
+			}
+		}
+	}
+	return &Server{db: db}
+}
+
+func TestInterpretRelationshipPrompt(t *testing.T) {
+	s := newIntentServer(t)
+
+	tests := []struct {
+		prompt        string
+		modules       []string
+		query         string
+		referenceType string
+		filePath      string
+		exclude       []string
+		limit         int
+	}{
+		{
+			prompt:  "Show subnet interactions in redis and explain it.",
+			modules: []string{"terraform-azure-redis"},
+			query:   "subnet",
+		},
+		{
+			prompt: "Where do we reference subnet_id across modules, top 3",
+			query:  "subnet_id",
+			limit:  3,
+		},
+		{
+			prompt:  "Highlight private endpoint usage in terraform-azure-kv, top 5 hits",
+			modules: []string{"terraform-azure-kv"},
+			query:   "private_endpoint",
+			limit:   5,
+		},
+		{
+			prompt:  "Compare subnet_id relationships between redis and terraform-azure-app",
+			modules: []string{"terraform-azure-redis", "terraform-azure-app"},
+			query:   "subnet_id",
+		},
+		{
+			prompt:  "show subnet_id in kv, sa and vnet",
+			modules: []string{"terraform-azure-kv", "terraform-azure-sa", "terraform-azure-vnet"},
+			query:   "subnet_id",
+		},
+		{
+			prompt:        "show only data sources in kv, not in examples",
+			modules:       []string{"terraform-azure-kv"},
+			referenceType: "data_source",
+			exclude:       []string{"examples/*"},
+		},
+		{
+			prompt:        "tenant_id from variables in sa",
+			modules:       []string{"terraform-azure-sa"},
+			query:         "tenant_id",
+			referenceType: "variable",
+		},
+		{
+			prompt:        "which loops only read subnet_id in aks",
+			modules:       []string{"terraform-azure-aks"},
+			query:         "subnet_id",
+			referenceType: "loop",
+		},
+		{
+			prompt:   "show subnet_id in main.tf of vnet",
+			modules:  []string{"terraform-azure-vnet"},
+			query:    "subnet_id",
+			filePath: "main.tf",
+		},
+		{
+			prompt:  "find key_vault_id in kv excluding outputs.tf, first 10",
+			modules: []string{"terraform-azure-kv"},
+			query:   "key_vault_id",
+			exclude: []string{"outputs.tf"},
+			limit:   10,
+		},
+		{
+			prompt:   "list subnet_id usage only in the examples of kv",
+			modules:  []string{"terraform-azure-kv"},
+			query:    "subnet_id",
+			filePath: "examples/*",
+		},
+		{
+			prompt:   "show everything in main.tf of kv",
+			modules:  []string{"terraform-azure-kv"},
+			query:    "everything",
+			filePath: "main.tf",
+		},
+		{
+			prompt:  "location across all modules, not in examples, limit 20",
+			query:   "location",
+			exclude: []string{"examples/*"},
+			limit:   20,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prompt, func(t *testing.T) {
+			intent, err := s.interpretRelationshipPrompt(tt.prompt)
+			if err != nil {
+				t.Fatalf("interpretRelationshipPrompt: %v", err)
+			}
+			var modules []string
+			for _, m := range intent.Modules {
+				modules = append(modules, m.Name)
+			}
+			if !reflect.DeepEqual(modules, tt.modules) {
+				t.Errorf("modules = %v, want %v", modules, tt.modules)
+			}
+			if intent.Query != tt.query {
+				t.Errorf("query = %q, want %q", intent.Query, tt.query)
+			}
+			if intent.ReferenceType != tt.referenceType {
+				t.Errorf("reference type = %q, want %q", intent.ReferenceType, tt.referenceType)
+			}
+			if intent.FilePath != tt.filePath {
+				t.Errorf("file path = %q, want %q", intent.FilePath, tt.filePath)
+			}
+			if !reflect.DeepEqual(intent.ExcludePaths, tt.exclude) {
+				t.Errorf("exclude paths = %v, want %v", intent.ExcludePaths, tt.exclude)
+			}
+			if intent.Limit != tt.limit {
+				t.Errorf("limit = %d, want %d", intent.Limit, tt.limit)
+			}
+		})
+	}
+}
+
+func TestInterpretRelationshipPromptErrors(t *testing.T) {
+	s := newIntentServer(t)
+
+	for _, prompt := range []string{"", "   ", "top 5"} {
+		t.Run(prompt, func(t *testing.T) {
+			if intent, err := s.interpretRelationshipPrompt(prompt); err == nil {
+				t.Errorf("interpretRelationshipPrompt(%q) = %+v, want an error", prompt, intent)
+			}
+		})
+	}
+}
+
+func TestExtractReferenceKind(t *testing.T) {
+	tests := []struct {
+		prompt string
+		kind   string
+	}{
+		{"show only data sources in kv", "data_source"},
+		{"data_sources only", "data_source"},
+		{"just the module outputs", "module_output"},
+		{"subnet_id from variables", "variable"},
+		{"via inputs", "variable"},
+		{"only locals", "local"},
+		{"through the resources", "resource"},
+		{"only for_each", "loop"},
+		{"show data sources in kv", ""},
+		{"subnet_id in kv", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prompt, func(t *testing.T) {
+			if kind, _ := extractReferenceKind(tt.prompt); kind != tt.kind {
+				t.Errorf("extractReferenceKind(%q) = %q, want %q", tt.prompt, kind, tt.kind)
+			}
+		})
+	}
+}
+
+func TestExtractFileScopes(t *testing.T) {
+	tests := []struct {
+		prompt  string
+		include string
+		exclude []string
+	}{
+		{"subnet_id in main.tf", "main.tf", nil},
+		{"subnet_id within file modules/subnet/main.tf", "modules/subnet/main.tf", nil},
+		{"subnet_id not in examples", "", []string{"examples/*"}},
+		{"subnet_id excluding the examples", "", []string{"examples/*"}},
+		{"subnet_id in examples only", "examples/*", nil},
+		{"subnet_id not in variables.tf", "", []string{"variables.tf"}},
+		{"subnet_id in main.tf, not in examples", "main.tf", []string{"examples/*"}},
+		{"subnet_id in kv", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prompt, func(t *testing.T) {
+			include, exclude, _ := extractFileScopes(tt.prompt)
+			if include != tt.include {
+				t.Errorf("include = %q, want %q", include, tt.include)
+			}
+			if !reflect.DeepEqual(exclude, tt.exclude) {
+				t.Errorf("exclude = %v, want %v", exclude, tt.exclude)
+			}
+		})
+	}
+}
+
+func TestDeriveQueryFromTokens(t *testing.T) {
+	tests := []struct {
+		name      string
+		prompt    string
+		moduleIdx []int
+		scoped    bool
+		want      string
+	}{
+		{"before module", "show subnet_id in kv", []int{3}, false, "subnet_id"},
+		{"after module", "in kv show subnet_id", []int{1}, false, "subnet_id"},
+		{"numbers dropped", "subnet_id 42", nil, false, "subnet_id"},
+		{"filler falls back", "show me in", nil, false, "show me in"},
+		{"filler when scoped", "show me in", nil, true, ""},
+		{"scoped keeps terms", "show tenant_id", nil, true, "tenant_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deriveQueryFromTokens(tokenizePrompt(tt.prompt), tt.moduleIdx, tt.scoped); got != tt.want {
+				t.Errorf("deriveQueryFromTokens(%q) = %q, want %q", tt.prompt, got, tt.want)
+			}
+		})
+	}
+}
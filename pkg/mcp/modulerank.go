@@ -0,0 +1,189 @@
+package mcp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dkooll/wamcp/internal/database"
+	"github.com/dkooll/wamcp/internal/formatter"
+	"github.com/dkooll/wamcp/internal/util"
+)
+
+// Weights of the module ranking signals. Text relevance is normalized to
+// textWeight for the best BM25 hit, so structured evidence (aliases, tags and
+// the resource types a module creates) decides between modules that merely
+// mention the query in their README.
+const (
+	textWeight     = 4.0
+	aliasWeight    = 2.0
+	tagWeightCap   = 4
+	resourceWeight = 4.0
+	textCandidates = 200
+)
+
+// rankTerms splits a module query into lowercase words plus the joined forms
+// aliases are written in ("private dns" also yields private-dns and privatedns).
+func rankTerms(query string) (words, aliases []string) {
+	spaced := strings.NewReplacer("-", " ", "_", " ", "/", " ", ".", " ").Replace(strings.ToLower(query))
+	seen := make(map[string]struct{})
+	for _, w := range strings.Fields(spaced) {
+		if _, ok := seen[w]; ok {
+			continue
+		}
+		seen[w] = struct{}{}
+		words = append(words, w)
+	}
+	aliases = append(aliases, words...)
+	if len(words) > 1 {
+		aliases = append(aliases, strings.Join(words, "-"), strings.Join(words, ""))
+	}
+	return words, aliases
+}
+
+// rankModules scores modules for query and its synonym expansions, keeping the
+// best scoring reading of the query per module, and explains each score.
+func (s *Server) rankModules(query string, limit int) ([]formatter.RankedModule, error) {
+	best := make(map[int64]*formatter.RankedModule)
+	for i, variant := range util.ExpandSynonyms(query) {
+		// Resource type spellings add nothing over their words here.
+		if strings.HasPrefix(variant, "azurerm_") {
+			continue
+		}
+		ranked, err := s.scoreModules(variant)
+		if err != nil {
+			return nil, err
+		}
+		for id, r := range ranked {
+			if i > 0 {
+				r.Reasons = append([]string{fmt.Sprintf("via synonym '%s'", variant)}, r.Reasons...)
+			}
+			if cur, ok := best[id]; !ok || r.Score > cur.Score {
+				best[id] = r
+			}
+		}
+	}
+
+	results := make([]formatter.RankedModule, 0, len(best))
+	for id, r := range best {
+		module, err := s.db.GetModuleByID(id)
+		if err != nil {
+			continue
+		}
+		r.Module = *module
+		results = append(results, *r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Module.Name < results[j].Module.Name
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// scoreModules combines BM25 over name, description and README with matching
+// aliases, tags and resource types for a single reading of a query.
+func (s *Server) scoreModules(query string) (map[int64]*formatter.RankedModule, error) {
+	words, aliases := rankTerms(query)
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	ranked := make(map[int64]*formatter.RankedModule)
+	entry := func(id int64) *formatter.RankedModule {
+		if r, ok := ranked[id]; ok {
+			return r
+		}
+		r := &formatter.RankedModule{}
+		ranked[id] = r
+		return r
+	}
+
+	parts := make([]string, len(words))
+	for i, w := range words {
+		parts[i] = `"` + strings.ReplaceAll(w, `"`, `""`) + `"`
+	}
+	text, err := s.db.ModuleTextScores(strings.Join(parts, " OR "), textCandidates)
+	if err != nil {
+		return nil, err
+	}
+	best := 0.0
+	for _, score := range text {
+		best = max(best, score)
+	}
+	for id, score := range text {
+		if best <= 0 {
+			break
+		}
+		points := textWeight * score / best
+		r := entry(id)
+		r.Score += points
+		r.Reasons = append(r.Reasons, fmt.Sprintf("text match +%.1f (BM25 %.2f)", points, score))
+	}
+
+	aliasHits, err := s.db.ModuleAliasSignals(aliases)
+	if err != nil {
+		return nil, err
+	}
+	for _, sig := range aliasHits {
+		points := aliasWeight * float64(sig.Weight)
+		r := entry(sig.ModuleID)
+		r.Score += points
+		r.Reasons = append(r.Reasons, fmt.Sprintf("alias '%s' +%.1f", sig.Value, points))
+	}
+
+	tagHits, err := s.db.ModuleTagSignals(words)
+	if err != nil {
+		return nil, err
+	}
+	for _, sig := range tagHits {
+		points := float64(min(sig.Weight, tagWeightCap))
+		r := entry(sig.ModuleID)
+		r.Score += points
+		r.Reasons = append(r.Reasons, fmt.Sprintf("tag '%s' +%.1f", sig.Value, points))
+	}
+
+	typeHits, err := s.db.ResourceTypeSignals(words)
+	if err != nil {
+		return nil, err
+	}
+	byModule := make(map[int64][]database.ModuleSignal)
+	for _, sig := range typeHits {
+		byModule[sig.ModuleID] = append(byModule[sig.ModuleID], sig)
+	}
+	for id, sigs := range byModule {
+		// A module scores by the resource type covering most query words, so
+		// azurerm_private_dns_zone beats separate private and dns resources.
+		covered := 0
+		var types []string
+		for _, sig := range sigs {
+			covered = max(covered, termsInResourceType(sig.Value, words))
+			types = append(types, fmt.Sprintf("%s ×%d", sig.Value, sig.Weight))
+		}
+		sort.Strings(types)
+		points := resourceWeight * float64(covered) / float64(len(words))
+		r := entry(id)
+		r.Score += points
+		r.Reasons = append(r.Reasons, fmt.Sprintf("resource types +%.1f (%s)", points, strings.Join(types, ", ")))
+	}
+
+	return ranked, nil
+}
+
+func termsInResourceType(resourceType string, words []string) int {
+	parts := make(map[string]struct{})
+	for _, p := range strings.Split(resourceType, "_") {
+		parts[p] = struct{}{}
+	}
+	n := 0
+	for _, w := range words {
+		if _, ok := parts[w]; ok {
+			n++
+		}
+	}
+	return n
+}
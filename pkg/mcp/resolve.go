@@ -0,0 +1,356 @@
+package mcp
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dkooll/wamcp/internal/database"
+)
+
+// How a module name was resolved, from most to least certain.
+const (
+	matchExact  = "exact"
+	matchAlias  = "alias"
+	matchPrefix = "prefix"
+	matchFTS    = "fts"
+)
+
+const (
+	// minMatchConfidence is the confidence below which resolution refuses to
+	// guess and lists candidates instead.
+	minMatchConfidence  = 0.6
+	aliasConfidence     = 0.95
+	maxModuleCandidates = 5
+	minCandidateScore   = 0.5
+	// ftsScoreScale is the BM25 score at which a full-text hit counts as half
+	// strong.
+	ftsScoreScale = 1.0
+)
+
+// ftsFieldWeight scales full-text confidence by the column that matched. A
+// README-only hit cannot reach minMatchConfidence even when it is the sole
+// hit: 0.9 * 0.6 < 0.6.
+var ftsFieldWeight = map[string]float64{
+	"name":        1,
+	"description": 0.85,
+	"readme":      0.6,
+}
+
+// genericModuleWords appear in nearly every module name and say nothing about
+// which module was meant.
+var genericModuleWords = map[string]struct{}{
+	"terraform": {}, "azure": {}, "azurerm": {}, "module": {}, "modules": {},
+}
+
+// moduleMatch is a resolved module with how it matched and how sure the match
+// is, from 0 to 1.
+type moduleMatch struct {
+	Module     *database.Module
+	Query      string
+	Kind       string
+	Confidence float64
+	Detail     string
+}
+
+// moduleNotFoundError reports a name that matched no module, or only a guess
+// below minMatchConfidence.
+type moduleNotFoundError struct {
+	Query string
+	Guess *moduleMatch
+}
+
+func (e *moduleNotFoundError) Error() string {
+	return fmt.Sprintf("module not found for '%s'", e.Query)
+}
+
+type moduleCandidate struct {
+	Name   string
+	Score  float64
+	Reason string
+}
+
+// resolveModule resolves a module name or alias. Matches other than exact
+// names are recorded so the tool response can say how the name was read.
+func (s *Server) resolveModule(nameOrAlias string) (*database.Module, error) {
+	match, err := s.matchModule(nameOrAlias)
+	if err != nil {
+		return nil, err
+	}
+	if match.Kind != matchExact {
+		s.resolved = append(s.resolved, *match)
+	}
+	return match.Module, nil
+}
+
+// matchModule tries an exact name, an alias, an alias prefix and full-text
+// search in turn, and refuses prefix and full-text guesses below
+// minMatchConfidence.
+func (s *Server) matchModule(nameOrAlias string) (*moduleMatch, error) {
+	query := strings.TrimSpace(nameOrAlias)
+	if query == "" {
+		return nil, &moduleNotFoundError{Query: nameOrAlias}
+	}
+	if m, err := s.db.GetModule(query); err == nil {
+		return &moduleMatch{Module: m, Query: query, Kind: matchExact, Confidence: 1}, nil
+	}
+	if m, err := s.db.ResolveModuleByAlias(query); err == nil {
+		return &moduleMatch{Module: m, Query: query, Kind: matchAlias, Confidence: aliasConfidence, Detail: fmt.Sprintf("alias '%s'", strings.ToLower(query))}, nil
+	}
+
+	var guess *moduleMatch
+	if m, err := s.db.ResolveModuleByAliasPrefix(query); err == nil {
+		if guess, err = s.prefixMatch(m, query); err != nil {
+			return nil, err
+		}
+	}
+	if guess == nil {
+		var err error
+		if guess, err = s.ftsMatch(query); err != nil {
+			return nil, err
+		}
+	}
+	if guess != nil && guess.Confidence >= minMatchConfidence {
+		return guess, nil
+	}
+	return nil, &moduleNotFoundError{Query: query, Guess: guess}
+}
+
+// prefixMatch rates an alias prefix match by how much of the alias the query
+// covers, divided among the module families that have an alias with the same
+// prefix. A module and its submodules count as one family.
+func (s *Server) prefixMatch(m *database.Module, query string) (*moduleMatch, error) {
+	aliases, err := s.db.ListModuleAliases()
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.ToLower(query)
+	families := make(map[int64]struct{})
+	alias := ""
+	for _, a := range aliases {
+		if !strings.HasPrefix(a.Alias, prefix) {
+			continue
+		}
+		family := a.ModuleID
+		if a.ParentID != 0 {
+			family = a.ParentID
+		}
+		families[family] = struct{}{}
+		if a.ModuleID == m.ID && (alias == "" || len(a.Alias) < len(alias)) {
+			alias = a.Alias
+		}
+	}
+	if alias == "" || len(families) == 0 {
+		return nil, nil
+	}
+
+	coverage := float64(len(prefix)) / float64(len(alias))
+	match := &moduleMatch{
+		Module:     m,
+		Query:      query,
+		Kind:       matchPrefix,
+		Confidence: (0.5 + 0.4*coverage) / float64(len(families)),
+		Detail:     fmt.Sprintf("prefix of alias '%s'", alias),
+	}
+	if len(families) > 1 {
+		match.Detail += fmt.Sprintf(", shared by %d modules", len(families))
+	}
+	return match, nil
+}
+
+// ftsMatch takes the best full-text hit for query as a phrase. Its confidence
+// grows with its BM25 lead over the runner-up, so a near tie is unsure, and
+// with its absolute score, so a sole but weak hit is not taken as certain. A
+// hit outside the module name counts for less, and one only in a README stays
+// below minMatchConfidence.
+func (s *Server) ftsMatch(query string) (*moduleMatch, error) {
+	hits, err := s.db.ModuleTextMatches(`"`+strings.ReplaceAll(query, `"`, `""`)+`"`, 2)
+	if err != nil {
+		// Queries the FTS5 tokenizer cannot use are not errors here.
+		return nil, nil
+	}
+	if len(hits) == 0 || hits[0].Score <= 0 {
+		return nil, nil
+	}
+	top, second := hits[0], 0.0
+	if len(hits) > 1 {
+		second = max(hits[1].Score, 0)
+	}
+	m, err := s.db.GetModuleByID(top.ModuleID)
+	if err != nil {
+		return nil, err
+	}
+
+	margin := 1 - second/top.Score
+	strength := top.Score / (top.Score + ftsScoreScale)
+	confidence := (0.45 + 0.45*margin) * (0.75 + 0.25*strength) * ftsFieldWeight[top.Field]
+	detail := fmt.Sprintf("full-text match on %s, BM25 %.2f", top.Field, top.Score)
+	if second > 0 {
+		detail += fmt.Sprintf(" vs %.2f for the runner-up", second)
+	}
+	return &moduleMatch{Module: m, Query: query, Kind: matchFTS, Confidence: confidence, Detail: detail}, nil
+}
+
+// moduleCandidates ranks modules by how close their name or aliases are to
+// query in edit distance and by the words they share with it. Words common to
+// all module names are left out of both.
+func (s *Server) moduleCandidates(query string, guess *moduleMatch) ([]moduleCandidate, error) {
+	modules, err := s.db.ListModules()
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := s.db.ListModuleAliases()
+	if err != nil {
+		return nil, err
+	}
+	byModule := make(map[int64][]string)
+	for _, a := range aliases {
+		byModule[a.ModuleID] = append(byModule[a.ModuleID], a.Alias)
+	}
+
+	specific := specificWords(query)
+	q := strings.Join(specific, "-")
+
+	var candidates []moduleCandidate
+	for _, m := range modules {
+		best := moduleCandidate{Name: m.Name}
+		names := append([]string{m.Name}, byModule[m.ID]...)
+		vocabulary := make(map[string]struct{})
+		for i, name := range names {
+			nameWords := specificWords(name)
+			for _, w := range nameWords {
+				vocabulary[w] = struct{}{}
+			}
+			core := strings.Join(nameWords, "-")
+			if q == "" || core == "" {
+				continue
+			}
+			distance := editDistance(q, core)
+			if score := 1 - float64(distance)/float64(max(len(q), len(core))); score > best.Score {
+				kind := "alias"
+				if i == 0 {
+					kind = "name"
+				}
+				best.Score = score
+				best.Reason = fmt.Sprintf("edit distance %d to %s '%s'", distance, kind, name)
+			}
+		}
+
+		var shared []string
+		for _, w := range specific {
+			if _, ok := vocabulary[w]; ok {
+				shared = append(shared, w)
+			}
+		}
+		if len(specific) > 0 {
+			if overlap := float64(len(shared)) / float64(len(specific)); overlap > best.Score {
+				best.Score = overlap
+				best.Reason = fmt.Sprintf("shares '%s' with its name or aliases", strings.Join(shared, "', '"))
+			}
+		}
+
+		isGuess := guess != nil && guess.Module.ID == m.ID
+		if isGuess {
+			best.Score = max(best.Score, guess.Confidence)
+			best.Reason = fmt.Sprintf("best guess: %s, confidence %.2f", guess.Detail, guess.Confidence)
+		}
+		if isGuess || best.Score >= minCandidateScore {
+			candidates = append(candidates, best)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].Name < candidates[j].Name
+	})
+	if len(candidates) > maxModuleCandidates {
+		candidates = candidates[:maxModuleCandidates]
+	}
+	return candidates, nil
+}
+
+// specificWords returns the words of a module name or query without the ones
+// every module shares, so terraform-azure-kvv compares as kvv.
+func specificWords(name string) []string {
+	words, _ := rankTerms(name)
+	var specific []string
+	for _, w := range words {
+		if _, generic := genericModuleWords[w]; !generic {
+			specific = append(specific, w)
+		}
+	}
+	return specific
+}
+
+// moduleNotFound explains a failed resolution, listing the closest modules so
+// the caller can retry with an exact name.
+func (s *Server) moduleNotFound(moduleName, submodule string, err error) map[string]any {
+	if errors.Is(err, errSubmoduleNotFound) {
+		return ErrorResponse(fmt.Sprintf("Submodule '%s' not found in module '%s'", submodule, moduleName))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Module '%s' not found", moduleName)
+	var notFound *moduleNotFoundError
+	if !errors.As(err, &notFound) {
+		return ErrorResponse(b.String())
+	}
+	if g := notFound.Guess; g != nil {
+		fmt.Fprintf(&b, ": the closest %s match, %s, has confidence %.2f, below the %.2f required", g.Kind, g.Module.Name, g.Confidence, minMatchConfidence)
+	}
+	b.WriteString(".")
+
+	candidates, cerr := s.moduleCandidates(notFound.Query, notFound.Guess)
+	if cerr != nil || len(candidates) == 0 {
+		b.WriteString(" Use list_modules or search_modules to find it.")
+		return ErrorResponse(b.String())
+	}
+	b.WriteString("\n\nDid you mean:\n")
+	for _, c := range candidates {
+		fmt.Fprintf(&b, "- %s (%s)\n", c.Name, c.Reason)
+	}
+	return ErrorResponse(b.String())
+}
+
+// resolutionNote says how each module name of a tool call was resolved when
+// it was not an exact name.
+func resolutionNote(matches []moduleMatch) string {
+	var b strings.Builder
+	seen := make(map[string]struct{})
+	for _, m := range matches {
+		key := m.Query + "\x00" + m.Module.Name
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		fmt.Fprintf(&b, "_Resolved '%s' to %s by %s match (%s, confidence %.2f)._\n", m.Query, m.Module.Name, m.Kind, m.Detail, m.Confidence)
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return b.String() + "\n"
+}
+
+// editDistance is the Levenshtein distance between a and b in bytes.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,74 @@
+package mcp
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dkooll/wamcp/internal/database"
+)
+
+func TestMatchModuleFullText(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "resolve.db"))
+	if err != nil {
+		// The schema needs FTS5, which go-sqlite3 only builds with -tags fts5.
+		t.Skipf("database unavailable: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, m := range []database.Module{
+		{Name: "terraform-azure-kv", Description: "Terraform module for key vaults", ReadmeContent: "Creates a key vault with purge protection."},
+		{Name: "terraform-azure-sa", Description: "Terraform module for storage accounts", ReadmeContent: "Creates storage accounts and containers."},
+		{Name: "terraform-azure-kusto", Description: "Terraform module for data explorer clusters", ReadmeContent: "Creates a data explorer cluster."},
+		{Name: "terraform-azure-adx", Description: "Terraform module for data explorer pools", ReadmeContent: "Creates data explorer pools."},
+	} {
+		if _, err := db.InsertModule(&m); err != nil {
+			t.Fatalf("insert module %s: %v", m.Name, err)
+		}
+	}
+	s := &Server{db: db}
+
+	tests := []struct {
+		query  string
+		module string
+		field  string
+	}{
+		{query: "kusto", module: "terraform-azure-kusto", field: "name"},
+		{query: "key vaults", module: "terraform-azure-kv", field: "description"},
+		{query: "purge protection", field: "readme"},
+		{query: "data explorer", field: "description"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			match, err := s.matchModule(tt.query)
+			if tt.module != "" {
+				if err != nil {
+					t.Fatalf("matchModule(%q) error: %v", tt.query, err)
+				}
+				if match.Module.Name != tt.module || match.Kind != matchFTS {
+					t.Fatalf("matchModule(%q) = %s by %s, want %s by %s", tt.query, match.Module.Name, match.Kind, tt.module, matchFTS)
+				}
+				if want := "full-text match on " + tt.field; !strings.HasPrefix(match.Detail, want) {
+					t.Errorf("detail = %q, want prefix %q", match.Detail, want)
+				}
+				return
+			}
+
+			var notFound *moduleNotFoundError
+			if !errors.As(err, &notFound) {
+				t.Fatalf("matchModule(%q) = %v, %v, want a refused guess", tt.query, match, err)
+			}
+			if notFound.Guess == nil {
+				t.Fatalf("matchModule(%q) made no guess", tt.query)
+			}
+			if notFound.Guess.Confidence >= minMatchConfidence {
+				t.Errorf("guess confidence = %.2f, want below %.2f", notFound.Guess.Confidence, minMatchConfidence)
+			}
+			if want := "full-text match on " + tt.field; !strings.HasPrefix(notFound.Guess.Detail, want) {
+				t.Errorf("guess detail = %q, want prefix %q", notFound.Guess.Detail, want)
+			}
+		})
+	}
+}
@@ -42,3 +42,11 @@ func UnmarshalArgs[T any](args any) (T, error) {
 	err = json.Unmarshal(argsBytes, &result)
 	return result, err
 }
+
+// prependResponseText adds text in front of the first content block of a
+// response built by SuccessResponse or ErrorResponse.
+func prependResponseText(resp map[string]any, text string) {
+	if blocks, ok := resp["content"].([]ContentBlock); ok && len(blocks) > 0 {
+		blocks[0].Text = text + blocks[0].Text
+	}
+}
@@ -0,0 +1,237 @@
+package mcp
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dkooll/wamcp/internal/database"
+	"github.com/dkooll/wamcp/internal/embedding"
+	"github.com/dkooll/wamcp/internal/formatter"
+)
+
+const (
+	semanticChunkChars   = 800
+	semanticReadmeChunks = 20
+	semanticBatchSize    = 64
+	semanticMatchesShown = 3
+)
+
+// SetEmbedder replaces the embedder used by semantic_search. Vectors are
+// stored per embedder name, so switching embedders never mixes vectors.
+func (s *Server) SetEmbedder(e embedding.Embedder) {
+	s.embedMutex.Lock()
+	defer s.embedMutex.Unlock()
+	s.embedder = e
+}
+
+// embeddingSources splits a module into the texts that get a vector: its name
+// and description, README chunks, input variables and top-level blocks.
+func (s *Server) embeddingSources(m database.Module) []database.ModuleEmbedding {
+	var sources []database.ModuleEmbedding
+	add := func(kind, ref, content string) {
+		if content = strings.TrimSpace(content); content != "" {
+			sources = append(sources, database.ModuleEmbedding{ModuleID: m.ID, Kind: kind, Ref: ref, Content: content})
+		}
+	}
+
+	// Always embed the module itself, so modules without other text are not
+	// picked up again on every search.
+	add("module", m.Name, strings.Join(strings.Fields(m.Name+" "+m.Description), " "))
+
+	for i, chunk := range chunkReadme(m.ReadmeContent) {
+		if i == semanticReadmeChunks {
+			break
+		}
+		add("readme", fmt.Sprintf("README #%d", i+1), chunk)
+	}
+
+	if variables, err := s.db.GetModuleVariables(m.ID); err == nil {
+		for _, v := range variables {
+			add("variable", "var."+v.Name, v.Name+": "+v.Description)
+		}
+	}
+
+	if blocks, err := s.db.GetModuleBlocks(m.ID); err == nil {
+		for _, b := range blocks {
+			if b.BlockType != "resource" && b.BlockType != "data" && b.BlockType != "module" {
+				continue
+			}
+			ref := strings.TrimSpace(b.BlockType + " " + b.Labels.String)
+			content := ref + " " + strings.ReplaceAll(b.TypeLabel.String, "_", " ") + " " + strings.ReplaceAll(b.AttrPaths.String, "\n", " ")
+			add("block", ref, truncateUTF8(content, semanticChunkChars))
+		}
+	}
+	return sources
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a multi-byte rune.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// chunkReadme splits markdown into paragraphs merged up to
+// semanticChunkChars, leaving out fenced code.
+func chunkReadme(readme string) []string {
+	var chunks []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			chunks = append(chunks, current.String())
+			current.Reset()
+		}
+	}
+
+	inFence := false
+	for _, para := range strings.Split(readme, "\n\n") {
+		if strings.Count(para, "```")%2 == 1 {
+			inFence = !inFence
+			continue
+		}
+		para = strings.Join(strings.Fields(para), " ")
+		if inFence || para == "" || strings.HasPrefix(para, "```") {
+			continue
+		}
+		if current.Len() > 0 && current.Len()+len(para) > semanticChunkChars {
+			flush()
+		}
+		if current.Len() > 0 {
+			current.WriteString(" ")
+		}
+		current.WriteString(para)
+	}
+	flush()
+	return chunks
+}
+
+// ensureEmbeddings embeds every module that has no vectors for the current
+// embedder. Re-synced modules lose their vectors and are embedded again here.
+func (s *Server) ensureEmbeddings() (embedding.Embedder, error) {
+	s.embedMutex.Lock()
+	defer s.embedMutex.Unlock()
+
+	model := s.embedder.Name()
+	modules, err := s.db.ModulesWithoutEmbeddings(model)
+	if err != nil {
+		return nil, err
+	}
+	if len(modules) > 0 {
+		log.Printf("Embedding %d modules with %s", len(modules), model)
+	}
+
+	for _, m := range modules {
+		sources := s.embeddingSources(m)
+		for start := 0; start < len(sources); start += semanticBatchSize {
+			batch := sources[start:min(start+semanticBatchSize, len(sources))]
+			texts := make([]string, len(batch))
+			for i, src := range batch {
+				texts[i] = src.Content
+			}
+			vectors, err := s.embedder.Embed(texts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to embed %s: %w", m.Name, err)
+			}
+			for i := range batch {
+				batch[i].Model = model
+				batch[i].Vector = vectors[i]
+			}
+		}
+		if err := s.db.InsertEmbeddings(sources); err != nil {
+			return nil, err
+		}
+	}
+	return s.embedder, nil
+}
+
+// semanticSearch ranks modules by blending the best cosine similarity of any
+// of their texts with their normalized BM25 score; vectorWeight is the share
+// of the vector score.
+func (s *Server) semanticSearch(query string, limit int, vectorWeight float64) ([]formatter.SemanticHit, string, error) {
+	embedder, err := s.ensureEmbeddings()
+	if err != nil {
+		return nil, "", err
+	}
+	queryVectors, err := embedder.Embed([]string{query})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to embed query: %w", err)
+	}
+	queryVector := queryVectors[0]
+
+	hits := make(map[int64]*formatter.SemanticHit)
+	entry := func(id int64) *formatter.SemanticHit {
+		if h, ok := hits[id]; ok {
+			return h
+		}
+		h := &formatter.SemanticHit{}
+		hits[id] = h
+		return h
+	}
+
+	err = s.db.ScanEmbeddings(embedder.Name(), func(e database.ModuleEmbedding) {
+		sim := embedding.Cosine(queryVector, e.Vector)
+		if sim <= 0 {
+			return
+		}
+		h := entry(e.ModuleID)
+		h.VectorScore = max(h.VectorScore, sim)
+		h.Matches = append(h.Matches, formatter.SemanticMatch{Kind: e.Kind, Ref: e.Ref, Content: e.Content, Similarity: sim})
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Terms are stemmed, so each matches as a prefix: "subnet"* also finds
+	// subnets.
+	if words := featureTerms(query, true); len(words) > 0 {
+		parts := make([]string, len(words))
+		for i, w := range words {
+			parts[i] = `"` + w + `"*`
+		}
+		text, err := s.db.ModuleTextScores(strings.Join(parts, " OR "), textCandidates)
+		if err != nil {
+			return nil, "", err
+		}
+		best := 0.0
+		for _, score := range text {
+			best = max(best, score)
+		}
+		for id, score := range text {
+			if best > 0 {
+				entry(id).TextScore = score / best
+			}
+		}
+	}
+
+	results := make([]formatter.SemanticHit, 0, len(hits))
+	for id, h := range hits {
+		module, err := s.db.GetModuleByID(id)
+		if err != nil {
+			continue
+		}
+		h.Module = *module
+		h.Score = vectorWeight*h.VectorScore + (1-vectorWeight)*h.TextScore
+		sort.Slice(h.Matches, func(i, j int) bool { return h.Matches[i].Similarity > h.Matches[j].Similarity })
+		if len(h.Matches) > semanticMatchesShown {
+			h.Matches = h.Matches[:semanticMatchesShown]
+		}
+		results = append(results, *h)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Module.Name < results[j].Module.Name
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, embedder.Name(), nil
+}
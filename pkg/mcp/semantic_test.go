@@ -0,0 +1,142 @@
+package mcp
+
+import (
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/dkooll/wamcp/internal/database"
+	"github.com/dkooll/wamcp/internal/embedding"
+)
+
+func TestChunkReadme(t *testing.T) {
+	long := strings.Repeat("word ", 60)
+
+	tests := []struct {
+		name   string
+		readme string
+		want   []string
+	}{
+		{
+			name:   "paragraphs merge",
+			readme: "# Key Vault\n\nCreates a vault\nwith secrets.",
+			want:   []string{"# Key Vault Creates a vault with secrets."},
+		},
+		{
+			name:   "fence without blank lines",
+			readme: "Intro.\n\n```hcl\nmodule \"kv\" {}\n```\n\nOutro.",
+			want:   []string{"Intro. Outro."},
+		},
+		{
+			name:   "fence spanning blank lines",
+			readme: "Intro.\n\n```hcl\nname = \"kv\"\n\nsku = \"standard\"\n\nlocation = \"westeurope\"\n```\n\nOutro.",
+			want:   []string{"Intro. Outro."},
+		},
+		{
+			name:   "chunks stay under the limit",
+			readme: long + "\n\n" + long + "\n\n" + long,
+			want: []string{
+				strings.TrimSpace(long) + " " + strings.TrimSpace(long),
+				strings.TrimSpace(long),
+			},
+		},
+		{
+			name:   "empty",
+			readme: "\n\n```\ncode\n```\n\n",
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chunkReadme(tt.readme)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("chunkReadme = %q, want %q", got, tt.want)
+			}
+			for _, chunk := range got {
+				if len(chunk) > semanticChunkChars {
+					t.Errorf("chunk of %d bytes exceeds %d", len(chunk), semanticChunkChars)
+				}
+			}
+		})
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"subnet", 10, "subnet"},
+		{"subnet", 3, "sub"},
+		{"zoné", 4, "zon"},
+		{"zoné", 5, "zoné"},
+		{"日本", 4, "日"},
+		{"日本", 2, ""},
+	}
+
+	for _, tt := range tests {
+		got := truncateUTF8(tt.s, tt.n)
+		if got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("truncateUTF8(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSemanticSearchBlend(t *testing.T) {
+	db, err := database.New(filepath.Join(t.TempDir(), "semantic.db"))
+	if err != nil {
+		// The schema needs FTS5, which go-sqlite3 only builds with -tags fts5.
+		t.Skipf("database unavailable: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, m := range []database.Module{
+		{Name: "terraform-azure-kv", Description: "Key vault with private endpoints", ReadmeContent: "Creates a key vault and its private endpoint."},
+		{Name: "terraform-azure-sa", Description: "Storage accounts", ReadmeContent: "Creates storage accounts with containers and a private endpoint."},
+		{Name: "terraform-azure-vnet", Description: "Virtual networks", ReadmeContent: "Creates virtual networks and subnets."},
+	} {
+		if _, err := db.InsertModule(&m); err != nil {
+			t.Fatalf("insert module %s: %v", m.Name, err)
+		}
+	}
+	s := &Server{db: db, embedder: embedding.NewHashEmbedder(512)}
+
+	names := func(weight float64) []string {
+		t.Helper()
+		hits, model, err := s.semanticSearch("private endpoint", 0, weight)
+		if err != nil {
+			t.Fatalf("semanticSearch: %v", err)
+		}
+		if model != "hash-v1-512" {
+			t.Errorf("model = %q, want hash-v1-512", model)
+		}
+		var out []string
+		for _, h := range hits {
+			if want := weight*h.VectorScore + (1-weight)*h.TextScore; math.Abs(h.Score-want) > 1e-9 {
+				t.Errorf("weight %.1f, %s: score = %f, want %f", weight, h.Module.Name, h.Score, want)
+			}
+			if h.TextScore < 0 || h.TextScore > 1 {
+				t.Errorf("%s: text score %f outside [0, 1]", h.Module.Name, h.TextScore)
+			}
+			out = append(out, h.Module.Name)
+		}
+		return out
+	}
+
+	vector := names(1)
+	if len(vector) == 0 || vector[0] != "terraform-azure-kv" {
+		t.Errorf("vector ranking = %v, want terraform-azure-kv first", vector)
+	}
+	text := names(0)
+	if len(text) < 2 || text[len(text)-1] != "terraform-azure-vnet" {
+		t.Errorf("text ranking = %v, want terraform-azure-vnet last", text)
+	}
+	if blended := names(0.5); len(blended) != len(vector) {
+		t.Errorf("blended ranking = %v, want the %d modules of the vector ranking", blended, len(vector))
+	}
+}
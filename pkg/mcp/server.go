@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"path"
 	"regexp"
 	"sort"
 	"strconv"
@@ -18,10 +19,10 @@ import (
 	"unicode"
 
 	"github.com/dkooll/wamcp/internal/database"
+	"github.com/dkooll/wamcp/internal/embedding"
 	"github.com/dkooll/wamcp/internal/formatter"
 	"github.com/dkooll/wamcp/internal/indexer"
 	"github.com/dkooll/wamcp/internal/util"
-	"github.com/hashicorp/hcl/v2/hclparse"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 )
 
@@ -56,6 +57,13 @@ type Server struct {
 	token     string
 	org       string
 	dbMutex   sync.Mutex
+
+	embedder   embedding.Embedder
+	embedMutex sync.Mutex
+
+	// resolved collects the non-exact module resolutions of the tool call in
+	// progress.
+	resolved []moduleMatch
 }
 
 func NewServer(dbPath, token, org string) *Server {
@@ -64,6 +72,9 @@ func NewServer(dbPath, token, org string) *Server {
 		token:  token,
 		org:    org,
 		jobs:   make(map[string]*SyncJob),
+		// The hashing embedder works offline without model files; a local
+		// model can be plugged in with SetEmbedder.
+		embedder: embedding.NewHashEmbedder(512),
 	}
 }
 
@@ -198,7 +209,7 @@ func (s *Server) handleToolsList(msg Message) {
 		},
 		{
 			"name":        "search_modules",
-			"description": "Search modules by name or description in local database",
+			"description": "Search modules by relevance, combining full-text matches on name, description and README with module aliases, tags and the resource types each module creates; every hit explains its score",
 			"inputSchema": map[string]any{
 				"type": "object",
 				"properties": map[string]any{
@@ -214,6 +225,28 @@ func (s *Server) handleToolsList(msg Message) {
 				"required": []string{"query"},
 			},
 		},
+		{
+			"name":        "semantic_search",
+			"description": "Find modules by intent (e.g., 'module to host a containerized web app with autoscaling') by blending local embedding similarity over READMEs, variable descriptions and blocks with full-text scores. Works offline; vectors are built on first use.",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"query": map[string]any{
+						"type":        "string",
+						"description": "What the module should do, in plain words",
+					},
+					"limit": map[string]any{
+						"type":        "number",
+						"description": "Maximum number of modules (default: 10)",
+					},
+					"vector_weight": map[string]any{
+						"type":        "number",
+						"description": "Share of the embedding similarity in the blended score, 0-1 (default: 0.7); the rest is full-text relevance",
+					},
+				},
+				"required": []string{"query"},
+			},
+		},
 		{
 			"name":        "get_module_info",
 			"description": "Get detailed information about a specific module including all files, variables, outputs, resources",
@@ -224,10 +257,106 @@ func (s *Server) handleToolsList(msg Message) {
 						"type":        "string",
 						"description": "Name of the module",
 					},
+					"submodule": map[string]any{
+						"type":        "string",
+						"description": "Optional: submodule of module_name (e.g., 'private-endpoint' or 'modules/private-endpoint')",
+					},
+					"include_examples": map[string]any{
+						"type":        "boolean",
+						"description": "Also show the variables and resources declared by each example (default: false, examples are listed by name only)",
+					},
 				},
 				"required": []string{"module_name"},
 			},
 		},
+		{
+			"name":        "find_modules_by_resource",
+			"description": "Find which modules create a resource type, with resource names, files and counts per module",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"resource_type": map[string]any{
+						"type":        "string",
+						"description": "Resource type, exact or with * wildcards (e.g., azurerm_key_vault, azurerm_key_vault*, *_private_endpoint)",
+					},
+					"include_examples": map[string]any{
+						"type":        "boolean",
+						"description": "Also include resources declared in examples (default: false)",
+					},
+				},
+				"required": []string{"resource_type"},
+			},
+		},
+		{
+			"name":        "find_modules_by_data_source",
+			"description": "Find which modules read a data source type, with data source names, files and counts per module",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"data_type": map[string]any{
+						"type":        "string",
+						"description": "Data source type, exact or with * wildcards (e.g., azurerm_client_config, azurerm_subnet*)",
+					},
+					"include_examples": map[string]any{
+						"type":        "boolean",
+						"description": "Also include data sources declared in examples (default: false)",
+					},
+				},
+				"required": []string{"data_type"},
+			},
+		},
+		{
+			"name":        "list_resource_types",
+			"description": "Inventory of the resource or data source types the module catalog covers, with how many modules declare each",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"kind": map[string]any{
+						"type":        "string",
+						"enum":        []string{"resource", "data"},
+						"description": "Optional: 'resource' (default) or 'data' sources",
+					},
+					"filter": map[string]any{
+						"type":        "string",
+						"description": "Optional type glob (e.g., azurerm_storage*, *network*)",
+					},
+					"include_examples": map[string]any{
+						"type":        "boolean",
+						"description": "Also count declarations in examples (default: false)",
+					},
+					"limit": map[string]any{
+						"type":        "number",
+						"description": "Maximum number of types (default: 100)",
+					},
+				},
+			},
+		},
+		{
+			"name":        "query_index",
+			"description": "Run a read-only SELECT query against the module index for ad-hoc aggregations (see describe_schema for tables and columns). Writes, pragmas and tables outside the allowlist are rejected; queries time out after 5 seconds.",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"sql": map[string]any{
+						"type":        "string",
+						"description": "A single SELECT (or WITH ... SELECT) statement, e.g. SELECT resource_type, COUNT(*) FROM module_resources WHERE example_id IS NULL GROUP BY 1 ORDER BY 2 DESC",
+					},
+					"max_rows": map[string]any{
+						"type":        "number",
+						"description": "Maximum number of rows to return (default: 100, max: 1000)",
+					},
+				},
+				"required": []string{"sql"},
+			},
+		},
+		{
+			"name":        "describe_schema",
+			"description": "Describe the tables, columns, indexes and row counts query_index can read",
+			"inputSchema": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{},
+			},
+		},
 		{
 			"name":        "search_code",
 			"description": "Search across all Terraform code files for specific patterns or text",
@@ -238,10 +367,23 @@ func (s *Server) handleToolsList(msg Message) {
 						"type":        "string",
 						"description": "Text or pattern to search for in code",
 					},
+					"mode": map[string]any{
+						"type":        "string",
+						"enum":        []string{"fts", "regex", "literal", "symbol"},
+						"description": "Optional: 'fts' full-text search (default); 'regex' Go regular expression (e.g., for_each\\s*=\\s*merge\\(flatten); 'literal' exact case-sensitive text; 'symbol' whole identifier (e.g., subnet_id, azurerm_key_vault.this). Non-fts modes report every match with line and column.",
+					},
 					"limit": map[string]any{
 						"type":        "number",
 						"description": "Maximum number of results (default: 20)",
 					},
+					"offset": map[string]any{
+						"type":        "number",
+						"description": "Number of matching files to skip, for pagination (default: 0)",
+					},
+					"context_lines": map[string]any{
+						"type":        "number",
+						"description": "Lines of context around each match (default: 2, max: 20)",
+					},
 					"kind": map[string]any{
 						"type":        "string",
 						"description": "Optional structural filter: resource|dynamic|lifecycle",
@@ -255,6 +397,32 @@ func (s *Server) handleToolsList(msg Message) {
 						"items":       map[string]any{"type": "string"},
 						"description": "Optional attribute presence filters (e.g., for_each, lifecycle.ignore_changes)",
 					},
+					"structure": map[string]any{
+						"type":        "string",
+						"description": "Optional block query that matching files must satisfy (e.g., 'resource \"azurerm_*\" !has:tags', 'resource \"azurerm_*\" > dynamic \"identity\"')",
+					},
+					"module_name": map[string]any{
+						"type":        "string",
+						"description": "Optional: restrict to one module and its submodules (name or alias, e.g., kv)",
+					},
+					"submodule": map[string]any{
+						"type":        "string",
+						"description": "Optional: restrict to a submodule of module_name (e.g., 'private-endpoint')",
+					},
+					"path_glob": map[string]any{
+						"type":        "string",
+						"description": "Optional file path glob (e.g., 'examples/**', 'variables.tf', 'modules/*/main.tf'); a glob without '/' matches the file name in any directory",
+					},
+					"file_type": map[string]any{
+						"type":        "string",
+						"enum":        []string{"terraform", "markdown", "yaml", "json"},
+						"description": "Optional: restrict to one file type",
+					},
+					"exclude_paths": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Optional file path globs to leave out (e.g., ['examples/**'])",
+					},
 				},
 				"required": []string{"query"},
 			},
@@ -269,9 +437,13 @@ func (s *Server) handleToolsList(msg Message) {
 						"type":        "string",
 						"description": "Name of the module (e.g., terraform-azure-aks)",
 					},
+					"submodule": map[string]any{
+						"type":        "string",
+						"description": "Optional: submodule of module_name (e.g., 'private-endpoint' or 'modules/private-endpoint')",
+					},
 					"file_path": map[string]any{
 						"type":        "string",
-						"description": "Path to the file within the module (e.g., variables.tf, main.tf, README.md)",
+						"description": "Path to the file within the module, or within the submodule when one is given (e.g., variables.tf, main.tf, README.md)",
 					},
 				},
 				"required": []string{"module_name", "file_path"},
@@ -287,6 +459,10 @@ func (s *Server) handleToolsList(msg Message) {
 						"type":        "string",
 						"description": "Name of the module (e.g., terraform-azure-aks)",
 					},
+					"submodule": map[string]any{
+						"type":        "string",
+						"description": "Optional: submodule of module_name (e.g., 'private-endpoint' or 'modules/private-endpoint')",
+					},
 					"variable_name": map[string]any{
 						"type":        "string",
 						"description": "Name of the variable (e.g., cluster, config, instance)",
@@ -295,15 +471,37 @@ func (s *Server) handleToolsList(msg Message) {
 				"required": []string{"module_name", "variable_name"},
 			},
 		},
+		{
+			"name":        "search_validations",
+			"description": "Search variable validation rules and lifecycle/output preconditions and postconditions across all modules (e.g., 'sku_name')",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"query": map[string]any{
+						"type":        "string",
+						"description": "Text to match against the owning variable/resource name, condition expression or error message",
+					},
+					"kind": map[string]any{
+						"type":        "string",
+						"description": "Optional filter: validation|precondition|postcondition|assert",
+					},
+					"limit": map[string]any{
+						"type":        "number",
+						"description": "Maximum number of results (default: 20)",
+					},
+				},
+				"required": []string{"query"},
+			},
+		},
 		{
 			"name":        "compare_pattern_across_modules",
-			"description": "Compare a specific code pattern (e.g., dynamic blocks, resource definitions) across all modules to find differences. Returns a summary table by default, or full code blocks if requested.",
+			"description": "Compare a specific code pattern (e.g., dynamic blocks, resource definitions) across all modules to find differences. Patterns can be block queries with value predicates (sku_name = \"Premium\"), negation (!has:tags), OR groups, parent/child relations (resource \"azurerm_*\" > dynamic \"identity\") and '| count'. Returns a summary table by default, or full code blocks if requested.",
 			"inputSchema": map[string]any{
 				"type": "object",
 				"properties": map[string]any{
 					"pattern": map[string]any{
 						"type":        "string",
-						"description": "The pattern to search for (e.g., 'dynamic \"identity\"', 'resource \"azurerm_', 'lifecycle {')",
+						"description": "The pattern to search for (e.g., 'dynamic \"identity\"', 'resource \"azurerm_\"', 'data \"azurerm_client_config\"', 'lifecycle', 'ip_configuration')",
 					},
 					"file_type": map[string]any{
 						"type":        "string",
@@ -335,6 +533,10 @@ func (s *Server) handleToolsList(msg Message) {
 						"type":        "string",
 						"description": "Name or alias of the module to inspect",
 					},
+					"submodule": map[string]any{
+						"type":        "string",
+						"description": "Optional: submodule of module_name (e.g., 'private-endpoint' or 'modules/private-endpoint')",
+					},
 					"query": map[string]any{
 						"type":        "string",
 						"description": "Term to match against attribute paths or reference names (e.g., 'subnet')",
@@ -345,9 +547,207 @@ func (s *Server) handleToolsList(msg Message) {
 					},
 					"prompt": map[string]any{
 						"type":        "string",
-						"description": "Natural-language request (e.g., 'Show subnet relationships in redis, top 5').",
+						"description": "Natural-language request (e.g., 'Show subnet relationships in redis and kv, only data sources, not in examples, top 5'). The interpretation is echoed in the response.",
+					},
+					"match": map[string]any{
+						"type":        "string",
+						"enum":        []string{"fuzzy", "exact"},
+						"description": "Optional: 'fuzzy' matches the term anywhere (default); 'exact' only matches whole symbols, attributes, or fields below a symbol (e.g., var.config matches var.config.subnet_id)",
+					},
+					"reference_type": map[string]any{
+						"type":        "string",
+						"enum":        []string{"variable", "local", "resource", "data_source", "module_output", "loop", "count", "path", "self", "terraform", "reference"},
+						"description": "Optional: only references of this kind",
+					},
+					"block_type": map[string]any{
+						"type":        "string",
+						"description": "Optional: only references inside this top-level block type (e.g., resource, data, module, output, locals)",
+					},
+					"resource_type": map[string]any{
+						"type":        "string",
+						"description": "Optional: only references inside resources or data sources of this type; supports '*' (e.g., azurerm_subnet, azurerm_*_endpoint)",
+					},
+					"attribute_path": map[string]any{
+						"type":        "string",
+						"description": "Optional: attribute path, supports '*' (e.g., subnet_id, ip_configuration.*, dynamic.*.for_each)",
+					},
+					"file_path": map[string]any{
+						"type":        "string",
+						"description": "Optional: only references in matching files, supports '*' (e.g., main.tf, examples/*); a pattern naming an examples directory includes example code",
+					},
+					"include_examples": map[string]any{
+						"type":        "boolean",
+						"description": "Optional: also return references in example code (default: false, module code only)",
+					},
+					"offset": map[string]any{
+						"type":        "number",
+						"description": "Optional: number of results to skip for pagination (default: 0)",
+					},
+				},
+			},
+		},
+		{
+			"name":        "compare_relationships",
+			"description": "Compare how a term is wired in two or more modules: aligns matching attribute paths by resource type and highlights where the referenced sources differ (e.g., var.subnet_id in one module, a data source in another)",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"modules": map[string]any{
+						"type":        "array",
+						"items":       map[string]any{"type": "string"},
+						"description": "Names or aliases of the modules to compare (at least two)",
+					},
+					"submodule": map[string]any{
+						"type":        "string",
+						"description": "Optional: compare this submodule of each listed module (e.g., 'private-endpoint' or 'modules/private-endpoint')",
+					},
+					"query": map[string]any{
+						"type":        "string",
+						"description": "Term to match against attribute paths or reference names (e.g., 'subnet_id')",
+					},
+					"match": map[string]any{
+						"type":        "string",
+						"enum":        []string{"fuzzy", "exact"},
+						"description": "Optional: 'fuzzy' matches the term anywhere (default); 'exact' only matches whole symbols, attributes, or fields below a symbol",
+					},
+					"resource_type": map[string]any{
+						"type":        "string",
+						"description": "Optional: only references inside resources or data sources of this type; supports '*'",
+					},
+				},
+				"required": []string{"modules", "query"},
+			},
+		},
+		{
+			"name":        "trace_data_flow",
+			"description": "Trace how a value flows through a module: from an input variable through locals and for_each/dynamic iterators to resource attributes, or from a resource to outputs. Every hop includes file:line.",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"module_name": map[string]any{
+						"type":        "string",
+						"description": "Name or alias of the module",
+					},
+					"submodule": map[string]any{
+						"type":        "string",
+						"description": "Optional: submodule of module_name (e.g., 'private-endpoint' or 'modules/private-endpoint')",
+					},
+					"from": map[string]any{
+						"type":        "string",
+						"description": "Starting symbol (e.g., var.config.subnet_id, local.subnets, azurerm_subnet.this)",
+					},
+					"to": map[string]any{
+						"type":        "string",
+						"description": "Optional: stop at this node or attribute (e.g., azurerm_private_endpoint.subnet_id, output.subnet_ids)",
+					},
+					"max_depth": map[string]any{
+						"type":        "number",
+						"description": "Maximum hops per path (default: 8)",
+					},
+					"limit": map[string]any{
+						"type":        "number",
+						"description": "Maximum paths to return (default: 20)",
+					},
+				},
+				"required": []string{"module_name", "from"},
+			},
+		},
+		{
+			"name":        "export_module_graph",
+			"description": "Export the dependency graph between a module's variables, locals, data sources, resources, module calls and outputs as Graphviz DOT or Mermaid",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"module_name": map[string]any{
+						"type":        "string",
+						"description": "Name or alias of the module",
+					},
+					"submodule": map[string]any{
+						"type":        "string",
+						"description": "Optional: submodule of module_name (e.g., 'private-endpoint' or 'modules/private-endpoint')",
+					},
+					"format": map[string]any{
+						"type":        "string",
+						"enum":        []string{"dot", "mermaid"},
+						"description": "Output format (default: mermaid)",
+					},
+					"collapse_by_type": map[string]any{
+						"type":        "boolean",
+						"description": "Fold resources and data sources into one node per type (default: false)",
+					},
+					"filter": map[string]any{
+						"type":        "string",
+						"description": "Optional: only keep nodes containing this term, plus their direct neighbours",
 					},
 				},
+				"required": []string{"module_name"},
+			},
+		},
+		{
+			"name":        "list_address_migrations",
+			"description": "List moved, import and removed blocks (resource address migrations) per module to predict state changes when upgrading",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"module_name": map[string]any{
+						"type":        "string",
+						"description": "Optional: name or alias of the module. Leave empty to list migrations for all modules.",
+					},
+					"submodule": map[string]any{
+						"type":        "string",
+						"description": "Optional: submodule of module_name (e.g., 'private-endpoint' or 'modules/private-endpoint')",
+					},
+				},
+			},
+		},
+		{
+			"name":        "find_attribute_values",
+			"description": "Aggregate the distinct values an attribute is set to across modules (e.g., every min_tls_version on storage accounts, or modules that do not set public_network_access_enabled = false). Literal values and normalized expression text are both reported.",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"attribute": map[string]any{
+						"type":        "string",
+						"description": "Attribute path relative to the top-level block (e.g., min_tls_version, network_rules.default_action, dynamic.identity.content.type). '*' wildcards are allowed.",
+					},
+					"block_type": map[string]any{
+						"type":        "string",
+						"description": "Optional: top-level block type (resource, data, module, variable, output, locals, provider, terraform)",
+					},
+					"resource_type": map[string]any{
+						"type":        "string",
+						"description": "Optional: first block label or prefix of it (e.g., azurerm_storage_account, azurerm_key_vault)",
+					},
+					"module_name": map[string]any{
+						"type":        "string",
+						"description": "Optional: restrict to a single module (name or alias)",
+					},
+					"submodule": map[string]any{
+						"type":        "string",
+						"description": "Optional: submodule of module_name (e.g., 'private-endpoint' or 'modules/private-endpoint')",
+					},
+					"value": map[string]any{
+						"type":        "string",
+						"description": "Optional: only count occurrences with exactly this literal value",
+					},
+					"value_prefix": map[string]any{
+						"type":        "string",
+						"description": "Optional: only count literal values starting with this prefix",
+					},
+					"exclude_value": map[string]any{
+						"type":        "string",
+						"description": "Optional: leave out occurrences with this value (e.g., 'false' to find modules that do not disable a setting)",
+					},
+					"include_examples": map[string]any{
+						"type":        "boolean",
+						"description": "Also count values set in examples/ (default: false)",
+					},
+					"limit": map[string]any{
+						"type":        "number",
+						"description": "Maximum distinct values to return (default: 50)",
+					},
+				},
+				"required": []string{"attribute"},
 			},
 		},
 		{
@@ -360,6 +760,10 @@ func (s *Server) handleToolsList(msg Message) {
 						"type":        "string",
 						"description": "Name of the module (e.g., terraform-azure-aks)",
 					},
+					"submodule": map[string]any{
+						"type":        "string",
+						"description": "Optional: submodule of module_name (e.g., 'private-endpoint' or 'modules/private-endpoint')",
+					},
 				},
 				"required": []string{"module_name"},
 			},
@@ -374,6 +778,10 @@ func (s *Server) handleToolsList(msg Message) {
 						"type":        "string",
 						"description": "Name of the module (e.g., terraform-azure-aks)",
 					},
+					"submodule": map[string]any{
+						"type":        "string",
+						"description": "Optional: submodule of module_name (e.g., 'private-endpoint' or 'modules/private-endpoint')",
+					},
 					"example_name": map[string]any{
 						"type":        "string",
 						"description": "Name of the example (e.g., 'default', 'complete')",
@@ -382,6 +790,71 @@ func (s *Server) handleToolsList(msg Message) {
 				"required": []string{"module_name", "example_name"},
 			},
 		},
+		{
+			"name":        "explain_example",
+			"description": "Explain which module variables and nested attributes an example sets in its module call, without reading the example in full",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"module_name": map[string]any{
+						"type":        "string",
+						"description": "Name of the module (e.g., terraform-azure-kv)",
+					},
+					"submodule": map[string]any{
+						"type":        "string",
+						"description": "Optional: submodule of module_name (e.g., 'private-endpoint' or 'modules/private-endpoint')",
+					},
+					"example_name": map[string]any{
+						"type":        "string",
+						"description": "Optional: name of the example. Leave empty to explain every example of the module.",
+					},
+				},
+				"required": []string{"module_name"},
+			},
+		},
+		{
+			"name":        "find_examples_for",
+			"description": "Find examples whose module call sets inputs matching a feature description (e.g., 'private endpoints with customer-managed keys')",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"query": map[string]any{
+						"type":        "string",
+						"description": "Features the example should configure",
+					},
+					"module_name": map[string]any{
+						"type":        "string",
+						"description": "Optional: restrict to one module",
+					},
+					"submodule": map[string]any{
+						"type":        "string",
+						"description": "Optional: restrict to a submodule of module_name (e.g., 'private-endpoint' or 'modules/private-endpoint')",
+					},
+					"limit": map[string]any{
+						"type":        "number",
+						"description": "Maximum examples to return (default: 10)",
+					},
+				},
+				"required": []string{"query"},
+			},
+		},
+		{
+			"name":        "example_coverage",
+			"description": "Report which module variables and nested optional attributes no example sets, and which modules have no example usage at all",
+			"inputSchema": map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"module_name": map[string]any{
+						"type":        "string",
+						"description": "Optional: report untested inputs for one module. Leave empty for a catalog-wide summary.",
+					},
+					"submodule": map[string]any{
+						"type":        "string",
+						"description": "Optional: submodule of module_name (e.g., 'private-endpoint' or 'modules/private-endpoint')",
+					},
+				},
+			},
+		},
 		{
 			"name":        "sync_status",
 			"description": "Get status of ongoing or previous sync jobs",
@@ -422,6 +895,7 @@ func (s *Server) handleToolsCall(msg Message) {
 
 	log.Printf("Tool call: %s", params.Name)
 
+	s.resolved = nil
 	var result any
 	switch params.Name {
 	case "sync_modules":
@@ -432,28 +906,61 @@ func (s *Server) handleToolsCall(msg Message) {
 		result = s.handleListModules()
 	case "search_modules":
 		result = s.handleSearchModules(params.Arguments)
+	case "semantic_search":
+		result = s.handleSemanticSearch(params.Arguments)
 	case "get_module_info":
 		result = s.handleGetModuleInfo(params.Arguments)
 	case "search_code":
 		result = s.handleSearchCode(params.Arguments)
+	case "find_modules_by_resource":
+		result = s.handleFindModulesByType(params.Arguments, "resource")
+	case "find_modules_by_data_source":
+		result = s.handleFindModulesByType(params.Arguments, "data")
+	case "list_resource_types":
+		result = s.handleListResourceTypes(params.Arguments)
+	case "query_index":
+		result = s.handleQueryIndex(params.Arguments)
+	case "describe_schema":
+		result = s.handleDescribeSchema()
 	case "get_file_content":
 		result = s.handleGetFileContent(params.Arguments)
 	case "extract_variable_definition":
 		result = s.handleExtractVariableDefinition(params.Arguments)
+	case "search_validations":
+		result = s.handleSearchValidations(params.Arguments)
 	case "compare_pattern_across_modules":
 		result = s.handleComparePatternAcrossModules(params.Arguments)
 	case "analyze_code_relationships":
 		result = s.handleAnalyzeCodeRelationships(params.Arguments)
+	case "compare_relationships":
+		result = s.handleCompareRelationships(params.Arguments)
+	case "trace_data_flow":
+		result = s.handleTraceDataFlow(params.Arguments)
+	case "export_module_graph":
+		result = s.handleExportModuleGraph(params.Arguments)
+	case "list_address_migrations":
+		result = s.handleListAddressMigrations(params.Arguments)
+	case "find_attribute_values":
+		result = s.handleFindAttributeValues(params.Arguments)
 	case "list_module_examples":
 		result = s.handleListModuleExamples(params.Arguments)
 	case "get_example_content":
 		result = s.handleGetExampleContent(params.Arguments)
+	case "explain_example":
+		result = s.handleExplainExample(params.Arguments)
+	case "find_examples_for":
+		result = s.handleFindExamplesFor(params.Arguments)
+	case "example_coverage":
+		result = s.handleExampleCoverage(params.Arguments)
 	case "sync_status":
 		result = s.handleSyncStatus(params.Arguments)
 	default:
 		s.sendError(-32601, "Tool not found", msg.ID)
 		return
 	}
+	if resp, ok := result.(map[string]any); ok && len(s.resolved) > 0 {
+		prependResponseText(resp, resolutionNote(s.resolved))
+	}
 
 	response := Message{
 		JSONRPC: "2.0",
@@ -564,61 +1071,223 @@ func (s *Server) handleSearchModules(args any) map[string]any {
 		searchArgs.Limit = 10
 	}
 
-	variants := util.ExpandQueryVariants(searchArgs.Query)
-	seen := make(map[int64]struct{})
-	var merged []database.Module
-	for _, v := range variants {
-		mods, err := s.db.SearchModules(v, searchArgs.Limit)
-		if err != nil {
-			continue
-		}
-		for _, m := range mods {
-			if _, ok := seen[m.ID]; ok {
-				continue
-			}
-			seen[m.ID] = struct{}{}
-			merged = append(merged, m)
-			if searchArgs.Limit > 0 && len(merged) >= searchArgs.Limit {
-				break
-			}
-		}
-		if searchArgs.Limit > 0 && len(merged) >= searchArgs.Limit {
-			break
-		}
+	ranked, err := s.rankModules(searchArgs.Query, searchArgs.Limit)
+	if err != nil {
+		return ErrorResponse(fmt.Sprintf("Search failed: %v", err))
 	}
 
-	text := formatter.SearchResults(searchArgs.Query, merged)
+	text := formatter.SearchResults(searchArgs.Query, ranked)
 	return SuccessResponse(text)
 }
 
+func (s *Server) handleSemanticSearch(args any) map[string]any {
+	if err := s.ensureDB(); err != nil {
+		return ErrorResponse(fmt.Sprintf("Failed to initialize database: %v", err))
+	}
+
+	searchArgs, err := UnmarshalArgs[struct {
+		Query        string   `json:"query"`
+		Limit        int      `json:"limit"`
+		VectorWeight *float64 `json:"vector_weight"`
+	}](args)
+	if err != nil || strings.TrimSpace(searchArgs.Query) == "" {
+		return ErrorResponse("Error: query is required")
+	}
+
+	if searchArgs.Limit <= 0 {
+		searchArgs.Limit = 10
+	}
+	vectorWeight := 0.7
+	if searchArgs.VectorWeight != nil {
+		vectorWeight = min(max(*searchArgs.VectorWeight, 0), 1)
+	}
+
+	hits, model, err := s.semanticSearch(searchArgs.Query, searchArgs.Limit, vectorWeight)
+	if err != nil {
+		return ErrorResponse(fmt.Sprintf("Semantic search failed: %v", err))
+	}
+
+	return SuccessResponse(formatter.SemanticSearchResults(searchArgs.Query, model, hits))
+}
+
 func (s *Server) handleGetModuleInfo(args any) map[string]any {
 	if err := s.ensureDB(); err != nil {
 		return ErrorResponse(fmt.Sprintf("Failed to initialize database: %v", err))
 	}
 
 	moduleArgs, err := UnmarshalArgs[struct {
-		ModuleName string `json:"module_name"`
+		ModuleName      string `json:"module_name"`
+		Submodule       string `json:"submodule"`
+		IncludeExamples bool   `json:"include_examples"`
 	}](args)
 	if err != nil {
 		return ErrorResponse("Error: Invalid module name")
 	}
 
-	module, err := s.resolveModule(moduleArgs.ModuleName)
+	module, err := s.resolveModuleScope(moduleArgs.ModuleName, moduleArgs.Submodule)
 	if err != nil {
-		return ErrorResponse(fmt.Sprintf("Module '%s' not found", moduleArgs.ModuleName))
+		return s.moduleNotFound(moduleArgs.ModuleName, moduleArgs.Submodule, err)
 	}
 
 	variables, _ := s.db.GetModuleVariables(module.ID)
 	outputs, _ := s.db.GetModuleOutputs(module.ID)
 	resources, _ := s.db.GetModuleResources(module.ID)
+	conditions, _ := s.db.GetModuleConditions(module.ID)
 	files, _ := s.db.GetModuleFiles(module.ID)
 
-	summary, _ := s.db.SummarizeModuleStructure(module.ID)
-	text := formatter.ModuleInfo(module, variables, outputs, resources, files)
-	if summary != nil {
-		text += formatter.StructuralSummaryValues(summary.ResourceCount, summary.LifecycleCount, summary.ResourcesWithIgnoreChanges, summary.TopResourceTypes, summary.DynamicLabels)
+	summary, _ := s.db.SummarizeModuleStructure(module.ID)
+	text := formatter.ModuleInfo(module, variables, outputs, resources, conditions, files)
+	if summary != nil {
+		text += formatter.StructuralSummaryValues(summary.ResourceCount, summary.LifecycleCount, summary.ResourcesWithIgnoreChanges, summary.TopResourceTypes, summary.DynamicLabels)
+	}
+
+	parentName := ""
+	if module.ParentID != 0 {
+		if parent, err := s.db.GetModuleByID(module.ParentID); err == nil {
+			parentName = parent.Name
+		}
+	}
+	submodules, _ := s.db.GetSubmodules(module.ID)
+	text += formatter.SubmodulesSection(submodules, parentName)
+
+	examples, _ := s.db.GetModuleExamples(module.ID)
+	if len(examples) > 0 {
+		views := make([]formatter.ExampleScopeView, 0, len(examples))
+		for _, ex := range examples {
+			view := formatter.ExampleScopeView{Example: ex}
+			if moduleArgs.IncludeExamples {
+				view.Variables, _ = s.db.GetExampleVariables(ex.ID)
+				view.Resources, _ = s.db.GetExampleResources(ex.ID)
+			}
+			views = append(views, view)
+		}
+		text += formatter.ExamplesSection(views, moduleArgs.IncludeExamples)
+	}
+	return SuccessResponse(text)
+}
+
+func (s *Server) handleFindModulesByType(args any, kind string) map[string]any {
+	if err := s.ensureDB(); err != nil {
+		return ErrorResponse(fmt.Sprintf("Failed to initialize database: %v", err))
+	}
+
+	typeArgs, err := UnmarshalArgs[struct {
+		ResourceType    string `json:"resource_type"`
+		DataType        string `json:"data_type"`
+		IncludeExamples bool   `json:"include_examples"`
+	}](args)
+	if err != nil {
+		return ErrorResponse("Error: Invalid arguments")
+	}
+
+	pattern := strings.TrimSpace(typeArgs.ResourceType)
+	if kind == "data" {
+		pattern = strings.TrimSpace(typeArgs.DataType)
+	}
+	if pattern == "" {
+		if kind == "data" {
+			return ErrorResponse("Error: data_type is required")
+		}
+		return ErrorResponse("Error: resource_type is required")
+	}
+	pattern = strings.ToLower(pattern)
+
+	decls, err := s.db.FindDeclarationsByType(kind, pattern, typeArgs.IncludeExamples)
+	if err != nil {
+		return ErrorResponse(fmt.Sprintf("Search failed: %v", err))
+	}
+
+	return SuccessResponse(formatter.ModulesByType(kind, pattern, decls))
+}
+
+func (s *Server) handleListResourceTypes(args any) map[string]any {
+	if err := s.ensureDB(); err != nil {
+		return ErrorResponse(fmt.Sprintf("Failed to initialize database: %v", err))
+	}
+
+	listArgs, err := UnmarshalArgs[struct {
+		Kind            string `json:"kind"`
+		Filter          string `json:"filter"`
+		IncludeExamples bool   `json:"include_examples"`
+		Limit           int    `json:"limit"`
+	}](args)
+	if err != nil {
+		return ErrorResponse("Error: Invalid arguments")
+	}
+
+	kind := strings.ToLower(strings.TrimSpace(listArgs.Kind))
+	if kind == "" {
+		kind = "resource"
+	}
+	if kind != "resource" && kind != "data" {
+		return ErrorResponse(fmt.Sprintf("Error: unsupported kind '%s'", listArgs.Kind))
+	}
+	pattern := strings.ToLower(strings.TrimSpace(listArgs.Filter))
+	if pattern == "" {
+		pattern = "*"
+	}
+	if listArgs.Limit <= 0 {
+		listArgs.Limit = 100
+	}
+
+	inventory, err := s.db.TypeInventory(kind, pattern, listArgs.IncludeExamples)
+	if err != nil {
+		return ErrorResponse(fmt.Sprintf("Failed to list types: %v", err))
+	}
+	total := len(inventory)
+	if len(inventory) > listArgs.Limit {
+		inventory = inventory[:listArgs.Limit]
+	}
+
+	return SuccessResponse(formatter.TypeInventory(kind, pattern, inventory, total))
+}
+
+const (
+	queryIndexTimeout = 5 * time.Second
+	queryIndexRows    = 100
+	queryIndexMaxRows = 1000
+)
+
+func (s *Server) handleQueryIndex(args any) map[string]any {
+	if err := s.ensureDB(); err != nil {
+		return ErrorResponse(fmt.Sprintf("Failed to initialize database: %v", err))
+	}
+
+	queryArgs, err := UnmarshalArgs[struct {
+		SQL     string `json:"sql"`
+		MaxRows int    `json:"max_rows"`
+	}](args)
+	if err != nil || strings.TrimSpace(queryArgs.SQL) == "" {
+		return ErrorResponse("Error: sql is required")
+	}
+
+	maxRows := queryArgs.MaxRows
+	if maxRows <= 0 {
+		maxRows = queryIndexRows
+	}
+	maxRows = min(maxRows, queryIndexMaxRows)
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryIndexTimeout)
+	defer cancel()
+	result, err := s.db.QueryReadOnly(ctx, queryArgs.SQL, maxRows)
+	if err != nil {
+		return ErrorResponse(fmt.Sprintf("Query failed: %v", err))
+	}
+
+	return SuccessResponse(formatter.QueryResults(queryArgs.SQL, result))
+}
+
+func (s *Server) handleDescribeSchema() map[string]any {
+	if err := s.ensureDB(); err != nil {
+		return ErrorResponse(fmt.Sprintf("Failed to initialize database: %v", err))
+	}
+
+	tables, err := s.db.DescribeQueryableTables()
+	if err != nil {
+		return ErrorResponse(fmt.Sprintf("Failed to describe schema: %v", err))
 	}
-	return SuccessResponse(text)
+
+	return SuccessResponse(formatter.SchemaDescription(tables))
 }
 
 func (s *Server) handleSearchCode(args any) map[string]any {
@@ -627,59 +1296,85 @@ func (s *Server) handleSearchCode(args any) map[string]any {
 	}
 
 	searchArgs, err := UnmarshalArgs[struct {
-		Query      string   `json:"query"`
-		Limit      int      `json:"limit"`
-		Kind       string   `json:"kind"`
-		TypePrefix string   `json:"type_prefix"`
-		Has        []string `json:"has"`
+		Query        string   `json:"query"`
+		Mode         string   `json:"mode"`
+		Limit        int      `json:"limit"`
+		Offset       int      `json:"offset"`
+		ContextLines *int     `json:"context_lines"`
+		Kind         string   `json:"kind"`
+		TypePrefix   string   `json:"type_prefix"`
+		Has          []string `json:"has"`
+		Structure    string   `json:"structure"`
+		ModuleName   string   `json:"module_name"`
+		Submodule    string   `json:"submodule"`
+		PathGlob     string   `json:"path_glob"`
+		FileType     string   `json:"file_type"`
+		ExcludePaths []string `json:"exclude_paths"`
 	}](args)
 	if err != nil {
 		return ErrorResponse("Error: Invalid search query")
 	}
 
-	if searchArgs.Limit == 0 {
-		searchArgs.Limit = 20
+	scope := database.FileFilter{
+		PathGlob:     strings.TrimSpace(searchArgs.PathGlob),
+		FileType:     normalizeFileType(searchArgs.FileType),
+		ExcludePaths: searchArgs.ExcludePaths,
+	}
+	if searchArgs.ModuleName != "" {
+		module, err := s.resolveModuleScope(searchArgs.ModuleName, searchArgs.Submodule)
+		if err != nil {
+			return s.moduleNotFound(searchArgs.ModuleName, searchArgs.Submodule, err)
+		}
+		scope.ModuleIDs = []int64{module.ID}
+		if searchArgs.Submodule == "" && module.ParentID == 0 {
+			submodules, _ := s.db.GetSubmodules(module.ID)
+			for _, sub := range submodules {
+				scope.ModuleIDs = append(scope.ModuleIDs, sub.ID)
+			}
+		}
 	}
 
-	variants := util.ExpandQueryVariants(searchArgs.Query)
-	if len(variants) == 0 {
-		variants = []string{searchArgs.Query}
+	if searchArgs.Limit <= 0 {
+		searchArgs.Limit = 20
+	}
+	searchArgs.Offset = max(searchArgs.Offset, 0)
+	contextLines := 2
+	if searchArgs.ContextLines != nil {
+		contextLines = min(max(*searchArgs.ContextLines, 0), 20)
 	}
 
-	seen := make(map[int64]struct{})
-	var merged []database.ModuleFile
-	var files []database.ModuleFile
-	if len(variants) == 1 {
-		files, _ = s.db.SearchFiles(variants[0], searchArgs.Limit)
-	} else {
-		parts := make([]string, 0, len(variants))
-		for _, v := range variants {
-			escaped := strings.ReplaceAll(v, "\"", "\"\"")
-			parts = append(parts, fmt.Sprintf("\"%s\"", escaped))
+	mode := strings.ToLower(strings.TrimSpace(searchArgs.Mode))
+	if mode == "" {
+		mode = "fts"
+	}
+	var pattern *codePattern
+	if mode != "fts" {
+		if searchArgs.Query == "" {
+			return ErrorResponse("Error: query is required")
+		}
+		pattern, err = compileCodePattern(mode, searchArgs.Query)
+		if err != nil {
+			return ErrorResponse(fmt.Sprintf("Error: %v", err))
 		}
-		match := strings.Join(parts, " OR ")
-		files, _ = s.db.SearchFilesFTS(match, searchArgs.Limit)
 	}
 
-	for _, f := range files {
-		if _, ok := seen[f.ID]; ok {
-			continue
-		}
-		if searchArgs.Kind != "" || searchArgs.TypePrefix != "" || len(searchArgs.Has) > 0 {
-			mod, merr := s.db.GetModuleByID(f.ModuleID)
-			if merr != nil {
-				continue
-			}
-			okStruct, herr := s.db.HCLBlockExists(mod.ID, f.FilePath, searchArgs.Kind, searchArgs.TypePrefix, searchArgs.Has)
-			if herr != nil || !okStruct {
-				continue
+	scope.BlockType = searchArgs.Kind
+	scope.TypePrefix = searchArgs.TypePrefix
+	scope.HasAttrs = searchArgs.Has
+	if strings.TrimSpace(searchArgs.Structure) != "" {
+		q, err := parseBlockQuery(searchArgs.Structure)
+		if err != nil {
+			return ErrorResponse(fmt.Sprintf("Error: invalid structure: %v", err))
+		}
+		scope.Files = []database.FileRef{}
+		seen := make(map[database.FileRef]struct{})
+		for _, hit := range s.findBlockQueryHits(q, "") {
+			ref := database.FileRef{ModuleID: hit.Block.ModuleID, FilePath: hit.Block.FilePath}
+			if _, ok := seen[ref]; !ok {
+				seen[ref] = struct{}{}
+				scope.Files = append(scope.Files, ref)
 			}
 		}
-		seen[f.ID] = struct{}{}
-		merged = append(merged, f)
-		if searchArgs.Limit > 0 && len(merged) >= searchArgs.Limit {
-			break
-		}
 	}
 
 	getModuleName := func(moduleID int64) string {
@@ -690,7 +1385,80 @@ func (s *Server) handleSearchCode(args any) map[string]any {
 		return "unknown"
 	}
 
-	text := formatter.CodeSearchResults(searchArgs.Query, merged, getModuleName)
+	fileMatches := func(f database.ModuleFile, matches []formatter.CodeMatch) formatter.CodeFileMatches {
+		if len(matches) > 0 {
+			if blocks, err := s.db.GetFileBlocks(f.ModuleID, f.FilePath); err == nil {
+				annotateBlocks(matches, blocks)
+			}
+		}
+		return formatter.CodeFileMatches{
+			ModuleName: getModuleName(f.ModuleID),
+			FilePath:   f.FilePath,
+			Content:    f.Content,
+			Matches:    matches,
+		}
+	}
+
+	var results []formatter.CodeFileMatches
+	total := 0
+	if pattern != nil {
+		// Every candidate is checked so the total covers files the content
+		// pattern rejects, not just those the FTS prefilter admits.
+		err := s.db.ScanFiles(pattern.prefilter, scope, func(f database.ModuleFile) bool {
+			matches := pattern.findCodeMatches(f.Content)
+			if len(matches) == 0 {
+				return true
+			}
+			if total >= searchArgs.Offset && len(results) < searchArgs.Limit {
+				results = append(results, fileMatches(f, matches))
+			}
+			total++
+			return true
+		})
+		if err != nil {
+			return ErrorResponse(fmt.Sprintf("Search failed: %v", err))
+		}
+	} else {
+		if mode != "fts" {
+			return ErrorResponse(fmt.Sprintf("Error: unsupported mode '%s'", searchArgs.Mode))
+		}
+
+		variants := util.ExpandDomainVariants(searchArgs.Query)
+		if len(variants) == 0 {
+			variants = []string{searchArgs.Query}
+		}
+
+		var files []database.ModuleFile
+		if len(variants) == 1 {
+			files, total, err = s.db.SearchFiles(variants[0], scope, searchArgs.Offset, searchArgs.Limit)
+		} else {
+			parts := make([]string, 0, len(variants))
+			for _, v := range variants {
+				escaped := strings.ReplaceAll(v, "\"", "\"\"")
+				parts = append(parts, fmt.Sprintf("\"%s\"", escaped))
+			}
+			match := strings.Join(parts, " OR ")
+			files, total, err = s.db.SearchFilesFTS(match, scope, searchArgs.Offset, searchArgs.Limit)
+		}
+		if err != nil {
+			return ErrorResponse(fmt.Sprintf("Search failed: %v", err))
+		}
+
+		highlight := ftsHighlightPattern(variants)
+		for _, f := range files {
+			var matches []formatter.CodeMatch
+			if highlight != nil {
+				matches = highlight.findCodeMatches(f.Content)
+			}
+			results = append(results, fileMatches(f, matches))
+		}
+	}
+
+	text := formatter.CodeSearchResults(searchArgs.Query, mode, results, searchArgs.Offset, total, contextLines)
+	if len(results) > 0 && searchArgs.Offset+len(results) < total {
+		text += fmt.Sprintf("\n_Note: Showing files %d–%d of %d matching files. Use `offset: %d` for the next page._\n",
+			searchArgs.Offset+1, searchArgs.Offset+len(results), total, searchArgs.Offset+len(results))
+	}
 	return SuccessResponse(text)
 }
 
@@ -701,17 +1469,18 @@ func (s *Server) handleGetFileContent(args any) map[string]any {
 
 	fileArgs, err := UnmarshalArgs[struct {
 		ModuleName string `json:"module_name"`
+		Submodule  string `json:"submodule"`
 		FilePath   string `json:"file_path"`
 	}](args)
 	if err != nil {
 		return ErrorResponse("Error: Invalid parameters")
 	}
 
-	module, err := s.resolveModule(fileArgs.ModuleName)
+	module, err := s.resolveModuleScope(fileArgs.ModuleName, fileArgs.Submodule)
 	if err != nil {
-		return ErrorResponse(fmt.Sprintf("Module '%s' not found", fileArgs.ModuleName))
+		return s.moduleNotFound(fileArgs.ModuleName, fileArgs.Submodule, err)
 	}
-	file, err := s.db.GetFile(module.Name, fileArgs.FilePath)
+	file, err := s.db.GetFile(module.Name, moduleFilePath(module, fileArgs.FilePath))
 	if err != nil {
 		return ErrorResponse(fmt.Sprintf("File '%s' not found in module '%s'", fileArgs.FilePath, module.Name))
 	}
@@ -727,17 +1496,18 @@ func (s *Server) handleExtractVariableDefinition(args any) map[string]any {
 
 	varArgs, err := UnmarshalArgs[struct {
 		ModuleName   string `json:"module_name"`
+		Submodule    string `json:"submodule"`
 		VariableName string `json:"variable_name"`
 	}](args)
 	if err != nil {
 		return ErrorResponse("Error: Invalid parameters")
 	}
 
-	module, err := s.resolveModule(varArgs.ModuleName)
+	module, err := s.resolveModuleScope(varArgs.ModuleName, varArgs.Submodule)
 	if err != nil {
-		return ErrorResponse(fmt.Sprintf("Module '%s' not found", varArgs.ModuleName))
+		return s.moduleNotFound(varArgs.ModuleName, varArgs.Submodule, err)
 	}
-	file, err := s.db.GetFile(module.Name, "variables.tf")
+	file, err := s.db.GetFile(module.Name, moduleFilePath(module, "variables.tf"))
 	if err != nil {
 		return ErrorResponse(fmt.Sprintf("variables.tf not found in module '%s'", module.Name))
 	}
@@ -747,7 +1517,64 @@ func (s *Server) handleExtractVariableDefinition(args any) map[string]any {
 		return ErrorResponse(fmt.Sprintf("Variable '%s' not found in %s", varArgs.VariableName, varArgs.ModuleName))
 	}
 
-	text := formatter.VariableDefinition(module.Name, varArgs.VariableName, variableBlock)
+	var validations []database.ModuleCondition
+	conditions, _ := s.db.GetModuleConditions(module.ID)
+	for _, c := range conditions {
+		if c.OwnerType == "variable" && c.OwnerName == varArgs.VariableName {
+			validations = append(validations, c)
+		}
+	}
+
+	text := formatter.VariableDefinition(module.Name, varArgs.VariableName, variableBlock, validations)
+	return SuccessResponse(text)
+}
+
+func (s *Server) handleSearchValidations(args any) map[string]any {
+	if err := s.ensureDB(); err != nil {
+		return ErrorResponse(fmt.Sprintf("Failed to initialize database: %v", err))
+	}
+
+	searchArgs, err := UnmarshalArgs[struct {
+		Query string `json:"query"`
+		Kind  string `json:"kind"`
+		Limit int    `json:"limit"`
+	}](args)
+	if err != nil {
+		return ErrorResponse("Error: Invalid search query")
+	}
+
+	if searchArgs.Limit == 0 {
+		searchArgs.Limit = 20
+	}
+
+	seen := make(map[int64]struct{})
+	var merged []database.ModuleCondition
+	for _, v := range util.ExpandQueryVariants(searchArgs.Query) {
+		conditions, err := s.db.SearchConditions(v, searchArgs.Kind, searchArgs.Limit)
+		if err != nil {
+			continue
+		}
+		for _, c := range conditions {
+			if _, ok := seen[c.ID]; ok {
+				continue
+			}
+			seen[c.ID] = struct{}{}
+			merged = append(merged, c)
+		}
+	}
+	if len(merged) > searchArgs.Limit {
+		merged = merged[:searchArgs.Limit]
+	}
+
+	getModuleName := func(moduleID int64) string {
+		module, err := s.db.GetModuleByID(moduleID)
+		if err == nil {
+			return module.Name
+		}
+		return "unknown"
+	}
+
+	text := formatter.ConditionSearchResults(searchArgs.Query, merged, getModuleName)
 	return SuccessResponse(text)
 }
 
@@ -806,7 +1633,16 @@ func (s *Server) handleComparePatternAcrossModules(args any) map[string]any {
 		return ErrorResponse(fmt.Sprintf("Error loading modules: %v", err))
 	}
 
-	results := s.findPatternMatches(modules, patternArgs.Pattern, patternArgs.FileType)
+	query, err := parsePatternQuery(patternArgs.Pattern, s.blockTypeIndexed)
+	if err != nil {
+		return ErrorResponse(fmt.Sprintf("Error: %v", err))
+	}
+
+	results := s.findPatternMatches(modules, patternArgs.Pattern, query, patternArgs.FileType)
+	if query != nil && query.Count {
+		return SuccessResponse(formatter.PatternCounts(patternArgs.Pattern, countMatchesByModule(results)))
+	}
+
 	paginatedResults := paginateResults(results, patternArgs.Offset, patternArgs.Limit)
 
 	text := formatter.PatternComparison(
@@ -835,47 +1671,143 @@ func (s *Server) handleAnalyzeCodeRelationships(args any) map[string]any {
 	query = strings.TrimSpace(query)
 	prompt = strings.TrimSpace(prompt)
 
-	var module *database.Module
+	var modules []*database.Module
+	var intent relationshipIntent
 
 	if prompt != "" {
-		parsedModule, parsedQuery, parsedLimit, parseErr := s.interpretRelationshipPrompt(prompt)
-		if parseErr != nil {
-			return ErrorResponse(fmt.Sprintf("Could not interpret prompt: %v", parseErr))
+		intent, err = s.interpretRelationshipPrompt(prompt)
+		if err != nil {
+			return ErrorResponse(fmt.Sprintf("Could not interpret prompt: %v", err))
 		}
-		if moduleName == "" && parsedModule != nil {
-			module = parsedModule
+		if moduleName == "" {
+			modules = intent.Modules
 		}
 		if query == "" {
-			query = parsedQuery
+			query = intent.Query
 		}
-		if limit == 0 && parsedLimit > 0 {
-			limit = parsedLimit
+		if limit == 0 && intent.Limit > 0 {
+			limit = intent.Limit
 		}
 	}
 
-	if module == nil && moduleName != "" {
-		module, err = s.resolveModule(moduleName)
+	// Structured filters only apply to object arguments; a bare prompt string
+	// leaves them empty.
+	filterArgs, _ := UnmarshalArgs[struct {
+		Submodule       string `json:"submodule"`
+		Match           string `json:"match"`
+		ReferenceType   string `json:"reference_type"`
+		BlockType       string `json:"block_type"`
+		ResourceType    string `json:"resource_type"`
+		AttributePath   string `json:"attribute_path"`
+		FilePath        string `json:"file_path"`
+		IncludeExamples bool   `json:"include_examples"`
+		Offset          int    `json:"offset"`
+	}](args)
+
+	if moduleName != "" {
+		module, err := s.resolveModuleScope(moduleName, filterArgs.Submodule)
 		if err != nil {
-			return ErrorResponse(fmt.Sprintf("Module '%s' not found", moduleName))
+			return s.moduleNotFound(moduleName, filterArgs.Submodule, err)
 		}
+		modules = []*database.Module{module}
+	}
+
+	filter := database.RelationshipFilter{
+		Term:          query,
+		ReferenceType: strings.TrimSpace(filterArgs.ReferenceType),
+		BlockType:     strings.TrimSpace(filterArgs.BlockType),
+		ResourceType:  strings.TrimSpace(filterArgs.ResourceType),
+		AttributePath: strings.TrimSpace(filterArgs.AttributePath),
+		FilePath:      strings.TrimSpace(filterArgs.FilePath),
+		ExcludePaths:  intent.ExcludePaths,
+		Offset:        max(filterArgs.Offset, 0),
+		Limit:         limit,
+	}
+	if filter.ReferenceType == "" {
+		filter.ReferenceType = intent.ReferenceType
+	}
+	if filter.FilePath == "" {
+		filter.FilePath = intent.FilePath
+	}
+	filter.IncludeExamples = filterArgs.IncludeExamples || targetsExamples(filter.FilePath)
+	switch strings.ToLower(strings.TrimSpace(filterArgs.Match)) {
+	case "", "fuzzy":
+	case "exact":
+		filter.Exact = true
+	default:
+		return ErrorResponse(fmt.Sprintf("Unsupported match mode '%s': use fuzzy or exact", filterArgs.Match))
 	}
 
-	if query == "" {
-		return ErrorResponse("Error: query missing. Provide `query` or specify what you are looking for in the prompt.")
+	if query == "" && filter.ReferenceType == "" && filter.BlockType == "" && filter.ResourceType == "" && filter.AttributePath == "" && filter.FilePath == "" {
+		return ErrorResponse("Error: query missing. Provide `query`, a structured filter, or specify what you are looking for in the prompt.")
 	}
 
-	return s.runRelationshipQuery(module, query, limit)
+	result := s.runRelationshipQuery(modules, filter)
+	if prompt != "" {
+		prependResponseText(result, intent.Summary())
+	}
+	return result
 }
 
-func (s *Server) runRelationshipQuery(module *database.Module, query string, limit int) map[string]any {
-	if module != nil {
-		rels, err := s.db.QueryRelationships(module.ID, query, limit)
+// relationshipFilterLabel describes a relationship search for headings, e.g.
+// "subnet (exact, resource_type=azurerm_subnet)".
+func relationshipFilterLabel(f database.RelationshipFilter) string {
+	var parts []string
+	if f.Exact {
+		parts = append(parts, "exact")
+	}
+	for _, kv := range [][2]string{
+		{"reference_type", f.ReferenceType},
+		{"block_type", f.BlockType},
+		{"resource_type", f.ResourceType},
+		{"attribute_path", f.AttributePath},
+		{"file_path", f.FilePath},
+	} {
+		if kv[1] != "" {
+			parts = append(parts, kv[0]+"="+kv[1])
+		}
+	}
+	for _, p := range f.ExcludePaths {
+		parts = append(parts, "not "+p)
+	}
+
+	label := f.Term
+	if len(parts) > 0 {
+		if label != "" {
+			label += " "
+		}
+		label += "(" + strings.Join(parts, ", ") + ")"
+	}
+	return label
+}
+
+func relationshipPageNote(f database.RelationshipFilter, shown, total int) string {
+	if f.Offset+shown >= total {
+		return ""
+	}
+	return fmt.Sprintf("\n_Note: Showing matches %d–%d of %d, best matches first. Use `offset: %d` for the next page._\n", f.Offset+1, f.Offset+shown, total, f.Offset+shown)
+}
+
+func (s *Server) runRelationshipQuery(modules []*database.Module, filter database.RelationshipFilter) map[string]any {
+	label := relationshipFilterLabel(filter)
+
+	if len(modules) > 1 {
+		return s.runRelationshipQueryFor(modules, filter, label)
+	}
+
+	if len(modules) == 1 {
+		module := modules[0]
+		filter.ModuleID = module.ID
+		rels, total, err := s.db.SearchRelationships(filter)
 		if err != nil {
 			return ErrorResponse(fmt.Sprintf("Failed to load relationships: %v", err))
 		}
 
 		if len(rels) == 0 {
-			return SuccessResponse(fmt.Sprintf("No relationships matching '%s' found in module '%s'.", query, module.Name))
+			if total > 0 {
+				return SuccessResponse(fmt.Sprintf("No relationships matching '%s' beyond offset %d in module '%s' (%d total).", label, filter.Offset, module.Name, total))
+			}
+			return SuccessResponse(fmt.Sprintf("No relationships matching '%s' found in module '%s'.", label, module.Name))
 		}
 
 		files, err := s.db.GetModuleFiles(module.ID)
@@ -888,30 +1820,37 @@ func (s *Server) runRelationshipQuery(module *database.Module, query string, lim
 			fileMap[file.FilePath] = file
 		}
 
-		text := formatter.RelationshipAnalysis(module.Name, query, rels, fileMap)
-		if limit > 0 && len(rels) == limit {
-			text += fmt.Sprintf("\n_Note: Showing the first %d matches. Increase `limit` to see more._\n", limit)
-		}
+		text := formatter.RelationshipAnalysis(module.Name, label, rels, fileMap)
+		text += relationshipPageNote(filter, len(rels), total)
 
 		return SuccessResponse(text)
 	}
 
-	rels, err := s.db.QueryRelationshipsAny(query, limit)
+	rels, total, err := s.db.SearchRelationships(filter)
 	if err != nil {
 		return ErrorResponse(fmt.Sprintf("Failed to load relationships: %v", err))
 	}
 
 	if len(rels) == 0 {
-		return SuccessResponse(fmt.Sprintf("No relationships matching '%s' found across modules.", query))
+		if total > 0 {
+			return SuccessResponse(fmt.Sprintf("No relationships matching '%s' beyond offset %d across modules (%d total).", label, filter.Offset, total))
+		}
+		return SuccessResponse(fmt.Sprintf("No relationships matching '%s' found across modules.", label))
 	}
 
+	// Modules are listed in the order of their best-ranked match.
+	var order []int64
 	buckets := make(map[int64][]database.HCLRelationship)
 	for _, rel := range rels {
+		if _, ok := buckets[rel.ModuleID]; !ok {
+			order = append(order, rel.ModuleID)
+		}
 		buckets[rel.ModuleID] = append(buckets[rel.ModuleID], rel)
 	}
 
 	views := make([]formatter.ModuleRelationshipView, 0, len(buckets))
-	for moduleID, items := range buckets {
+	for _, moduleID := range order {
+		items := buckets[moduleID]
 		mod, err := s.db.GetModuleByID(moduleID)
 		if err != nil {
 			log.Printf("Warning: failed to load module %d for relationships: %v", moduleID, err)
@@ -937,14 +1876,51 @@ func (s *Server) runRelationshipQuery(module *database.Module, query string, lim
 	}
 
 	if len(views) == 0 {
-		return SuccessResponse(fmt.Sprintf("No relationships matching '%s' found across modules.", query))
+		return SuccessResponse(fmt.Sprintf("No relationships matching '%s' found across modules.", label))
 	}
 
-	text := formatter.RelationshipAnalysisAcross(query, views)
-	if limit > 0 && len(rels) == limit {
-		text += fmt.Sprintf("\n_Note: Showing the first %d matches overall. Increase `limit` to see more._\n", limit)
+	text := formatter.RelationshipAnalysisAcross(label, views)
+	text += relationshipPageNote(filter, len(rels), total)
+
+	return SuccessResponse(text)
+}
+
+// runRelationshipQueryFor searches each of the named modules separately so
+// every module gets its own page of matches.
+func (s *Server) runRelationshipQueryFor(modules []*database.Module, filter database.RelationshipFilter, label string) map[string]any {
+	var views []formatter.ModuleRelationshipView
+	var notes []string
+	for _, module := range modules {
+		f := filter
+		f.ModuleID = module.ID
+		rels, total, err := s.db.SearchRelationships(f)
+		if err != nil {
+			return ErrorResponse(fmt.Sprintf("Failed to load relationships for %s: %v", module.Name, err))
+		}
+
+		files, err := s.db.GetModuleFiles(module.ID)
+		if err != nil {
+			return ErrorResponse(fmt.Sprintf("Failed to load module files: %v", err))
+		}
+		fileMap := make(map[string]database.ModuleFile, len(files))
+		for _, file := range files {
+			fileMap[file.FilePath] = file
+		}
+
+		views = append(views, formatter.ModuleRelationshipView{
+			ModuleName:    module.Name,
+			Relationships: rels,
+			Files:         fileMap,
+		})
+		if note := relationshipPageNote(f, len(rels), total); note != "" {
+			notes = append(notes, module.Name+": "+strings.TrimSpace(note))
+		}
 	}
 
+	text := formatter.RelationshipAnalysisAcross(label, views)
+	if len(notes) > 0 {
+		text += "\n" + strings.Join(notes, "\n") + "\n"
+	}
 	return SuccessResponse(text)
 }
 
@@ -1024,36 +2000,56 @@ func parseRelationshipArgs(raw any) (moduleName, query string, limit int, prompt
 	}
 }
 
-func (s *Server) interpretRelationshipPrompt(prompt string) (*database.Module, string, int, error) {
+func (s *Server) interpretRelationshipPrompt(prompt string) (relationshipIntent, error) {
+	var intent relationshipIntent
 	original := strings.TrimSpace(prompt)
 	if original == "" {
-		return nil, "", 0, fmt.Errorf("prompt is empty")
+		return intent, fmt.Errorf("prompt is empty")
 	}
 
 	limit, cleaned := extractPromptLimit(original)
-	tokens := tokenizePrompt(cleaned)
-	if len(tokens) == 0 {
-		return nil, "", limit, fmt.Errorf("could not find useful words")
+	intent.Limit = limit
+	intent.FilePath, intent.ExcludePaths, cleaned = extractFileScopes(cleaned)
+	intent.ReferenceType, cleaned = extractReferenceKind(cleaned)
+	acrossAll := allModulesRegex.MatchString(cleaned)
+	cleaned = allModulesRegex.ReplaceAllString(cleaned, " ")
+
+	// Commas separate module lists ("in kv, sa and vnet") just like "and".
+	tokens := tokenizePrompt(strings.ReplaceAll(cleaned, ",", " and "))
+	if len(tokens) == 0 && intent.ReferenceType == "" {
+		return intent, fmt.Errorf("could not find useful words")
 	}
 
-	module, moduleIdx, err := s.findModuleFromTokens(tokens)
-	if err != nil && !errors.Is(err, errModuleNotInPrompt) {
-		return nil, "", limit, err
+	var module *database.Module
+	var moduleIdx []int
+	if !acrossAll {
+		var err error
+		module, moduleIdx, err = s.findModuleFromTokens(tokens)
+		if err != nil && !errors.Is(err, errModuleNotInPrompt) {
+			return intent, err
+		}
+	}
+	if module != nil {
+		intent.Modules, moduleIdx = s.extendModuleList(tokens, module, moduleIdx)
+		sort.Ints(moduleIdx)
 	}
 
-	query := deriveQueryFromTokens(tokens, moduleIdx)
-	if query == "" {
-		return module, "", limit, fmt.Errorf("could not identify what to search for")
+	// Terraform identifiers never contain spaces, so "private endpoint" is
+	// searched as private_endpoint. A reference kind or file scope is enough
+	// to search on, so filler words are not promoted to a query then.
+	scoped := intent.ReferenceType != "" || intent.FilePath != ""
+	intent.Query = strings.Join(strings.Fields(util.CanonicalTerm(deriveQueryFromTokens(tokens, moduleIdx, scoped))), "_")
+	if intent.Query == "" && intent.ReferenceType == "" && intent.FilePath == "" {
+		return intent, fmt.Errorf("could not identify what to search for")
 	}
 
-	return module, query, limit, nil
+	return intent, nil
 }
 
 func extractPromptLimit(prompt string) (int, string) {
-	limitRegex := regexp.MustCompile(`(?i)\b(?:top|first|limit)\s+(\d{1,3})\b`)
 	limit := 0
-	cleaned := limitRegex.ReplaceAllStringFunc(prompt, func(match string) string {
-		parts := limitRegex.FindStringSubmatch(match)
+	cleaned := promptLimitRegex.ReplaceAllStringFunc(prompt, func(match string) string {
+		parts := promptLimitRegex.FindStringSubmatch(match)
 		if len(parts) > 1 {
 			if parsed, err := strconv.Atoi(parts[1]); err == nil && parsed > 0 {
 				limit = parsed
@@ -1071,7 +2067,7 @@ type promptToken struct {
 
 func tokenizePrompt(input string) []promptToken {
 	splitFn := func(r rune) bool {
-		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '/' || r == '_' || r == '-' {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '/' || r == '_' || r == '-' || r == '.' {
 			return false
 		}
 		return true
@@ -1080,6 +2076,8 @@ func tokenizePrompt(input string) []promptToken {
 	raw := strings.FieldsFunc(input, splitFn)
 	tokens := make([]promptToken, 0, len(raw))
 	for _, part := range raw {
+		// Dots belong to symbols like var.subnet_id, not to sentence ends.
+		part = strings.Trim(part, ".")
 		if part == "" {
 			continue
 		}
@@ -1198,61 +2196,162 @@ var relationshipStopwords = map[string]struct{}{
 	"limit":         {},
 	"results":       {},
 	"matches":       {},
+	"compare":       {},
+	"between":       {},
+	"versus":        {},
+	"vs":            {},
+	"usage":         {},
+	"used":          {},
+	"uses":          {},
+	"using":         {},
+	"reference":     {},
+	"references":    {},
+	"referenced":    {},
+	"referencing":   {},
+	"interactions":  {},
+	"wiring":        {},
+	"wired":         {},
+	"we":            {},
+	"is":            {},
+	"are":           {},
+	"it":            {},
+	"hits":          {},
+	"only":          {},
+	"just":          {},
+	"highlight":     {},
+	"what":          {},
+	"relation":      {},
+	"has":           {},
+	"have":          {},
+	"flow":          {},
+	"give":          {},
+	"some":          {},
+	"background":    {},
+	"information":   {},
+	"that":          {},
+	"this":          {},
+	"these":         {},
+	"those":         {},
+	"there":         {},
+	"not":           {},
+	"but":           {},
+	"or":            {},
+	"from":          {},
+	"by":            {},
+	"at":            {},
+	"via":           {},
+	"can":           {},
+	"could":         {},
+	"would":         {},
+	"should":        {},
+	"you":           {},
+	"i":             {},
+	"my":            {},
+	"our":           {},
+	"like":          {},
+	"read":          {},
+	"reads":         {},
+	"return":        {},
+	"returns":       {},
+	"print":         {},
+	"fetch":         {},
+	"retrieve":      {},
+	"shows":         {},
+	"appear":        {},
+	"appears":       {},
 }
 
-func deriveQueryFromTokens(tokens []promptToken, moduleIdx []int) string {
+// deriveQueryFromTokens picks the search term from the prompt words that are
+// not part of a module name. When only stopwords are left it falls back to
+// the raw words, unless scoped says the prompt already names what to search
+// for through a reference kind or file scope.
+func deriveQueryFromTokens(tokens []promptToken, moduleIdx []int, scoped bool) string {
 	indexSet := make(map[int]struct{}, len(moduleIdx))
 	for _, idx := range moduleIdx {
 		indexSet[idx] = struct{}{}
 	}
 
-	var focusTokens []promptToken
+	// Prefer the words before the module mention, then those after it, then
+	// everything that is not part of a module name.
+	var candidates [][]promptToken
 	if len(moduleIdx) > 0 {
-		first := moduleIdx[0]
-		if first > 0 {
-			focusTokens = append(focusTokens, tokens[:first]...)
-		} else if last := moduleIdx[len(moduleIdx)-1]; last+1 < len(tokens) {
-			focusTokens = append(focusTokens, tokens[last+1:]...)
+		first, last := moduleIdx[0], moduleIdx[len(moduleIdx)-1]
+		candidates = append(candidates, tokens[:first], tokens[last+1:])
+	}
+	var rest []promptToken
+	for i, tok := range tokens {
+		if _, isModule := indexSet[i]; !isModule {
+			rest = append(rest, tok)
 		}
 	}
+	candidates = append(candidates, rest)
 
-	if len(focusTokens) == 0 {
-		for i, tok := range tokens {
-			if _, isModule := indexSet[i]; isModule {
+	for _, focusTokens := range candidates {
+		var filtered []string
+		for _, tok := range focusTokens {
+			if _, stop := relationshipStopwords[tok.Lower]; stop {
 				continue
 			}
-			focusTokens = append(focusTokens, tok)
+			if _, err := strconv.Atoi(tok.Lower); err == nil {
+				continue
+			}
+			filtered = append(filtered, tok.Original)
+		}
+		if len(filtered) > 0 {
+			return strings.TrimSpace(strings.Join(filtered, " "))
 		}
 	}
+	if scoped {
+		return ""
+	}
 
-	var filtered []string
-	for _, tok := range focusTokens {
-		if _, stop := relationshipStopwords[tok.Lower]; stop {
-			continue
-		}
-		if _, err := strconv.Atoi(tok.Lower); err == nil {
-			continue
+	for _, focusTokens := range candidates {
+		if len(focusTokens) > 0 {
+			var words []string
+			for _, tok := range focusTokens {
+				words = append(words, tok.Original)
+			}
+			return strings.TrimSpace(strings.Join(words, " "))
 		}
-		filtered = append(filtered, tok.Original)
 	}
+	return ""
+}
 
-	if len(filtered) == 0 {
-		for _, tok := range focusTokens {
-			filtered = append(filtered, tok.Original)
+// parsePatternQuery parses pattern as a block query. It returns a nil query
+// without error for plain text patterns, and an error only when the pattern
+// uses query syntax incorrectly. A lone word such as for_each or subnet_id is
+// a query only when indexed reports blocks of that type; otherwise it is
+// searched as text.
+func parsePatternQuery(pattern string, indexed func(blockType string) bool) (*blockQuery, error) {
+	q, err := parseBlockQuery(pattern)
+	if err != nil {
+		if looksLikeBlockQuery(pattern) {
+			return nil, err
 		}
+		return nil, nil
 	}
-
-	return strings.TrimSpace(strings.Join(filtered, " "))
+	if q.bareBlockType() && !indexed(q.target().BlockType) {
+		return nil, nil
+	}
+	return &q, nil
 }
 
-func (s *Server) findPatternMatches(modules []database.Module, pattern, fileType string) []formatter.PatternMatch {
-	var results []formatter.PatternMatch
+// blockTypeIndexed reports whether the block index holds any block of
+// blockType.
+func (s *Server) blockTypeIndexed(blockType string) bool {
+	found, err := s.db.HasHCLBlockType(blockType)
+	return err == nil && found
+}
 
-	indexed := s.findPatternMatchesIndexed(pattern, fileType)
-	if len(indexed) > 0 {
-		return indexed
+func (s *Server) findPatternMatches(modules []database.Module, pattern string, q *blockQuery, fileType string) []formatter.PatternMatch {
+	// A parsed query is answered by the block index alone, even when nothing
+	// matches; the raw text of a query would only produce unrelated hits.
+	if q != nil {
+		return s.findPatternMatchesIndexed(*q, fileType)
 	}
 
+	var results []formatter.PatternMatch
+
 	for _, module := range modules {
 		files, err := s.db.GetModuleFiles(module.ID)
 		if err != nil {
@@ -1268,12 +2367,7 @@ func (s *Server) findPatternMatches(modules []database.Module, pattern, fileType
 				continue
 			}
 
-			matches := extractASTPatternMatches(file.Content, pattern)
-			if len(matches) == 0 {
-				for _, m := range extractPatternMatches(file.Content, pattern) {
-					matches = append(matches, astMatch{Code: m, BlockType: "", Summary: ""})
-				}
-			}
+			matches := extractPatternMatches(file.Content, pattern)
 			for i, match := range matches {
 				displayName := module.Name
 				if len(matches) > 1 {
@@ -1282,9 +2376,7 @@ func (s *Server) findPatternMatches(modules []database.Module, pattern, fileType
 				results = append(results, formatter.PatternMatch{
 					ModuleName: displayName,
 					FileName:   file.FileName,
-					Match:      match.Code,
-					BlockType:  match.BlockType,
-					Summary:    match.Summary,
+					Match:      match,
 				})
 			}
 		}
@@ -1293,231 +2385,178 @@ func (s *Server) findPatternMatches(modules []database.Module, pattern, fileType
 	return results
 }
 
-func (s *Server) findPatternMatchesIndexed(pattern, fileType string) []formatter.PatternMatch {
-	trimmed := strings.TrimSpace(pattern)
-	if trimmed == "" {
-		return nil
-	}
+// indexedQueryHit is a block from the hcl_blocks index that satisfied a query.
+type indexedQueryHit struct {
+	Block  database.HCLBlock
+	Module *database.Module
+	File   *database.ModuleFile
+}
 
-	hasFilters := parseHasFilters(trimmed)
-	var blocks []database.HCLBlock
-	var err error
-	blockType := ""
-	typeLabel := ""
-	prefix := false
-
-	if want, ok := getQuotedArg(trimmed, "resource"); ok {
-		blockType = "resource"
-		typeLabel = want
-		prefix = true
-	} else if want, ok := getQuotedArg(trimmed, "dynamic"); ok {
-		blockType = "dynamic"
-		typeLabel = want
-		prefix = false
-	} else if strings.HasPrefix(trimmed, "lifecycle") {
-		blockType = "lifecycle"
-	} else {
+// findBlockQueryHits evaluates q against the block index. Candidates are
+// narrowed in SQL by the target selector's type and labels; filters and
+// parent/child relations are then checked against the parsed block source.
+func (s *Server) findBlockQueryHits(q blockQuery, fileType string) []indexedQueryHit {
+	target := q.target()
+	blocks, err := s.db.QueryHCLBlocks(target.BlockType, target.Labels, target.Prefix)
+	if err != nil || len(blocks) == 0 {
 		return nil
 	}
 
-	blocks, err = s.db.QueryHCLBlocks(blockType, typeLabel, prefix)
-	if err != nil || len(blocks) == 0 {
-		return nil
+	modules := make(map[int64]*database.Module)
+	files := make(map[string]*database.ModuleFile)
+	rows := make(map[int64]*database.HCLBlock)
+
+	loadFile := func(b database.HCLBlock) (*database.Module, *database.ModuleFile) {
+		module, cached := modules[b.ModuleID]
+		if !cached {
+			module, _ = s.db.GetModuleByID(b.ModuleID)
+			modules[b.ModuleID] = module
+		}
+		if module == nil {
+			return nil, nil
+		}
+		fileKey := fmt.Sprintf("%d:%s", b.ModuleID, b.FilePath)
+		f, cached := files[fileKey]
+		if !cached {
+			f, _ = s.db.GetFile(module.Name, b.FilePath)
+			files[fileKey] = f
+		}
+		return module, f
 	}
 
-	var results []formatter.PatternMatch
-	for _, b := range blocks {
-		if fileType != "" && !strings.HasSuffix(b.FilePath, "/"+fileType) && !strings.HasSuffix(b.FilePath, fileType) {
-			continue
+	var nodeFor func(b database.HCLBlock) *queryNode
+	nodeFor = func(b database.HCLBlock) *queryNode {
+		n := &queryNode{Type: b.BlockType}
+		if b.Labels.Valid && b.Labels.String != "" {
+			n.Labels = strings.Split(b.Labels.String, ".")
 		}
-		if len(hasFilters) > 0 {
-			ok := true
-			attrSet := make(map[string]struct{})
-			if b.AttrPaths.Valid {
-				rest := b.AttrPaths.String
-				for {
-					line, r, cut := strings.Cut(rest, "\n")
-					if line != "" {
-						attrSet[line] = struct{}{}
-					}
-					if !cut {
-						break
-					}
-					rest = r
-				}
+		n.loadBody = func() (*hclsyntax.Body, string) {
+			_, f := loadFile(b)
+			if f == nil {
+				return nil, ""
 			}
-			for _, f := range hasFilters {
-				if _, present := attrSet[f]; !present {
-					ok = false
-					break
-				}
+			snippet := blockSource(f.Content, b.StartByte, b.EndByte)
+			return parseBlockSnippet(snippet), snippet
+		}
+		n.loadParent = func() *queryNode {
+			if !b.ParentID.Valid {
+				return nil
 			}
-			if !ok {
-				continue
+			parent, cached := rows[b.ParentID.Int64]
+			if !cached {
+				parent, _ = s.db.GetHCLBlock(b.ParentID.Int64)
+				rows[b.ParentID.Int64] = parent
 			}
+			if parent == nil {
+				return nil
+			}
+			return nodeFor(*parent)
 		}
+		return n
+	}
 
-		module, merr := s.db.GetModuleByID(b.ModuleID)
-		if merr != nil {
+	var hits []indexedQueryHit
+	for _, b := range blocks {
+		if fileType != "" && !strings.HasSuffix(b.FilePath, "/"+fileType) && !strings.HasSuffix(b.FilePath, fileType) {
 			continue
 		}
-		f, ferr := s.db.GetFile(module.Name, b.FilePath)
-		if ferr != nil {
+		if !q.matches(nodeFor(b)) {
 			continue
 		}
-		start := int(b.StartByte)
-		end := int(b.EndByte)
-		if start < 0 {
-			start = 0
-		}
-		if end > len(f.Content) {
-			end = len(f.Content)
+		module, f := loadFile(b)
+		if f == nil {
+			continue
 		}
-		if end < start {
-			end = start
+		hits = append(hits, indexedQueryHit{Block: b, Module: module, File: f})
+	}
+	return hits
+}
+
+func (s *Server) findPatternMatchesIndexed(q blockQuery, fileType string) []formatter.PatternMatch {
+	hits := s.findBlockQueryHits(q, fileType)
+	parents := make(map[int64]*database.HCLBlock)
+
+	var results []formatter.PatternMatch
+	for _, hit := range hits {
+		summary := ""
+		if chain := s.blockAncestry(hit.Block, parents); chain != "" {
+			summary = "inside " + chain
 		}
-		code := strings.TrimSpace(f.Content[start:end])
 
 		results = append(results, formatter.PatternMatch{
-			ModuleName: module.Name,
-			FileName:   f.FileName,
-			Match:      code,
-			BlockType:  blockType,
-			Summary:    "",
+			ModuleName: hit.Module.Name,
+			FileName:   hit.File.FileName,
+			Match:      strings.TrimSpace(blockSource(hit.File.Content, hit.Block.StartByte, hit.Block.EndByte)),
+			BlockType:  describeIndexedBlock(hit.Block),
+			Summary:    summary,
 		})
 	}
 	return results
 }
 
-type astMatch struct {
-	Code      string
-	BlockType string
-	Summary   string
-}
-
-func extractASTPatternMatches(content, pattern string) []astMatch {
-	trimmed := strings.TrimSpace(pattern)
-	if trimmed == "" {
-		return nil
-	}
-
-	parser := hclparse.NewParser()
-	file, diags := parser.ParseHCL([]byte(content), "temp.tf")
-	if diags.HasErrors() {
-		return nil
-	}
-	body, ok := file.Body.(*hclsyntax.Body)
-	if !ok {
-		return nil
-	}
-
-	sliceBlock := func(b *hclsyntax.Block) string {
-		rng := b.Range()
-		start := rng.Start.Byte
-		end := rng.End.Byte
-		if start < 0 {
-			start = 0
-		}
-		if end > len(content) {
-			end = len(content)
-		}
-		if end < start {
-			end = start
-		}
-		return strings.TrimSpace(content[start:end])
+func blockSource(content string, startByte, endByte int64) string {
+	start := int(startByte)
+	end := int(endByte)
+	if start < 0 {
+		start = 0
 	}
-
-	var out []astMatch
-
-	hasFilters := parseHasFilters(trimmed)
-
-	if want, ok := getQuotedArg(trimmed, "resource"); ok {
-		for _, bl := range body.Blocks {
-			if bl.Type == "resource" && len(bl.Labels) >= 2 {
-				rtype := bl.Labels[0]
-				if strings.HasPrefix(rtype, want) && blockSatisfies(bl.Body, hasFilters) {
-					out = append(out, astMatch{Code: sliceBlock(bl), BlockType: "resource", Summary: summarizeAttributes("resource", bl)})
-				}
-			}
-		}
-		return out
+	if end > len(content) {
+		end = len(content)
 	}
-
-	if want, ok := getQuotedArg(trimmed, "dynamic"); ok {
-
-		var walk func(bdy *hclsyntax.Body)
-		walk = func(bdy *hclsyntax.Body) {
-			for _, bl := range bdy.Blocks {
-				if bl.Type == "dynamic" && len(bl.Labels) > 0 && bl.Labels[0] == want && blockSatisfies(bl.Body, hasFilters) {
-					out = append(out, astMatch{Code: sliceBlock(bl), BlockType: "dynamic", Summary: summarizeAttributes("dynamic", bl)})
-				}
-				if bl.Body != nil {
-					walk(bl.Body)
-				}
-			}
-		}
-		walk(body)
-		return out
+	if start > end {
+		start = end
 	}
+	return content[start:end]
+}
 
-	if strings.HasPrefix(trimmed, "lifecycle") {
-		var walk func(bdy *hclsyntax.Body)
-		walk = func(bdy *hclsyntax.Body) {
-			for _, bl := range bdy.Blocks {
-				if bl.Type == "lifecycle" && blockSatisfies(bl.Body, hasFilters) {
-					out = append(out, astMatch{Code: sliceBlock(bl), BlockType: "lifecycle", Summary: summarizeAttributes("lifecycle", bl)})
-				}
-				if bl.Body != nil {
-					walk(bl.Body)
-				}
-			}
+// blockAncestry renders the chain of enclosing blocks, outermost first
+// (e.g. "resource azurerm_subnet.this > dynamic delegation").
+func (s *Server) blockAncestry(b database.HCLBlock, cache map[int64]*database.HCLBlock) string {
+	var chain []string
+	parentID := b.ParentID
+	for parentID.Valid {
+		parent, ok := cache[parentID.Int64]
+		if !ok {
+			parent, _ = s.db.GetHCLBlock(parentID.Int64)
+			cache[parentID.Int64] = parent
 		}
-		walk(body)
-		return out
+		if parent == nil {
+			break
+		}
+		chain = append([]string{describeIndexedBlock(*parent)}, chain...)
+		parentID = parent.ParentID
 	}
-
-	return nil
+	return strings.Join(chain, " > ")
 }
 
-func getQuotedArg(pattern, keyword string) (string, bool) {
-	prefix := keyword + " "
-	if !strings.HasPrefix(pattern, prefix) {
-		return "", false
+func describeIndexedBlock(b database.HCLBlock) string {
+	if b.Labels.Valid && b.Labels.String != "" {
+		return b.BlockType + " " + b.Labels.String
 	}
-	rest := pattern[len(prefix):]
-	first := strings.IndexByte(rest, '"')
-	if first < 0 {
-		return "", false
+	if b.TypeLabel.Valid && b.TypeLabel.String != "" {
+		return b.BlockType + " " + b.TypeLabel.String
 	}
-	second := strings.IndexByte(rest[first+1:], '"')
-	if second < 0 {
-		return "", false
-	}
-	want := strings.TrimSpace(rest[first+1 : first+1+second])
-	return want, want != ""
+	return b.BlockType
 }
 
-func parseHasFilters(pattern string) []string {
-	toks := strings.Fields(pattern)
-	var filters []string
-	for _, t := range toks {
-		if rest, ok := strings.CutPrefix(t, "has:"); ok {
-			filters = append(filters, rest)
-		}
-	}
-	return filters
+var blockTypeRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// prefixLabelBlockTypes keeps the historical behaviour of matching resource and
+// data types by prefix (e.g. resource "azurerm_storage").
+var prefixLabelBlockTypes = map[string]bool{
+	"resource": true,
+	"data":     true,
 }
 
-func blockSatisfies(bdy *hclsyntax.Body, hasFilters []string) bool {
-	if len(hasFilters) == 0 {
-		return true
+func labelMatches(want, got string, prefix bool) bool {
+	if prefix {
+		want += "*"
 	}
-	for _, path := range hasFilters {
-		if !hasPath(bdy, path) {
-			return false
-		}
+	if !strings.Contains(want, "*") {
+		return want == got
 	}
-	return true
+	ok, err := path.Match(want, got)
+	return err == nil && ok
 }
 
 func hasPath(bdy *hclsyntax.Body, path string) bool {
@@ -1547,19 +2586,6 @@ func hasPathRec(bdy *hclsyntax.Body, parts []string) bool {
 	return false
 }
 
-func summarizeAttributes(kind string, bl *hclsyntax.Block) string {
-	bdy := bl.Body
-	keys := make([]string, 0, len(bdy.Attributes))
-	for k := range bdy.Attributes {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-	if len(keys) == 0 {
-		return ""
-	}
-	return fmt.Sprintf("%s attributes: %s", kind, strings.Join(keys, ", "))
-}
-
 func extractPatternMatches(content, pattern string) []string {
 	var matches []string
 	searchContent := content
@@ -1616,6 +2642,15 @@ func findBlockEnd(content string, startPos int) int {
 	return startPos
 }
 
+func countMatchesByModule(results []formatter.PatternMatch) map[string]int {
+	counts := make(map[string]int)
+	for _, r := range results {
+		name, _, _ := strings.Cut(r.ModuleName, " #")
+		counts[name]++
+	}
+	return counts
+}
+
 func paginateResults(results []formatter.PatternMatch, offset, limit int) []formatter.PatternMatch {
 	total := len(results)
 	startIdx := min(max(0, offset), total)
@@ -1626,6 +2661,306 @@ func paginateResults(results []formatter.PatternMatch, offset, limit int) []form
 	return results[startIdx:endIdx]
 }
 
+func (s *Server) handleFindAttributeValues(args any) map[string]any {
+	if err := s.ensureDB(); err != nil {
+		return ErrorResponse(fmt.Sprintf("Failed to initialize database: %v", err))
+	}
+
+	valueArgs, err := UnmarshalArgs[struct {
+		Attribute       string `json:"attribute"`
+		BlockType       string `json:"block_type"`
+		ResourceType    string `json:"resource_type"`
+		ModuleName      string `json:"module_name"`
+		Submodule       string `json:"submodule"`
+		Value           string `json:"value"`
+		ValuePrefix     string `json:"value_prefix"`
+		ExcludeValue    string `json:"exclude_value"`
+		IncludeExamples bool   `json:"include_examples"`
+		Limit           int    `json:"limit"`
+	}](args)
+	if err != nil || strings.TrimSpace(valueArgs.Attribute) == "" {
+		return ErrorResponse("Error: attribute is required")
+	}
+
+	filter := database.AttributeValueFilter{
+		AttributePath:   strings.TrimSpace(valueArgs.Attribute),
+		RootType:        valueArgs.BlockType,
+		TypePrefix:      strings.TrimSuffix(valueArgs.ResourceType, "*"),
+		Value:           valueArgs.Value,
+		ValuePrefix:     valueArgs.ValuePrefix,
+		ExcludeValue:    valueArgs.ExcludeValue,
+		IncludeExamples: valueArgs.IncludeExamples,
+		Limit:           valueArgs.Limit,
+	}
+
+	var scope []string
+	if valueArgs.ModuleName != "" {
+		module, err := s.resolveModuleScope(valueArgs.ModuleName, valueArgs.Submodule)
+		if err != nil {
+			return s.moduleNotFound(valueArgs.ModuleName, valueArgs.Submodule, err)
+		}
+		filter.ModuleID = module.ID
+		scope = append(scope, "module "+module.Name)
+	}
+	if filter.RootType != "" {
+		scope = append(scope, "block type "+filter.RootType)
+	}
+	if filter.TypePrefix != "" {
+		scope = append(scope, "type "+filter.TypePrefix+"*")
+	}
+	if filter.Value != "" {
+		scope = append(scope, "value = "+filter.Value)
+	}
+	if filter.ValuePrefix != "" {
+		scope = append(scope, "value starts with "+filter.ValuePrefix)
+	}
+	if filter.ExcludeValue != "" {
+		scope = append(scope, "value != "+filter.ExcludeValue)
+	}
+	if filter.IncludeExamples {
+		scope = append(scope, "including examples")
+	}
+
+	values, err := s.db.AggregateAttributeValues(filter)
+	if err != nil {
+		return ErrorResponse(fmt.Sprintf("Error aggregating attribute values: %v", err))
+	}
+
+	return SuccessResponse(formatter.AttributeValues(filter.AttributePath, strings.Join(scope, ", "), values))
+}
+
+func (s *Server) handleCompareRelationships(args any) map[string]any {
+	if err := s.ensureDB(); err != nil {
+		return ErrorResponse(fmt.Sprintf("Failed to initialize database: %v", err))
+	}
+
+	compareArgs, err := UnmarshalArgs[struct {
+		Modules      []string `json:"modules"`
+		Submodule    string   `json:"submodule"`
+		Query        string   `json:"query"`
+		Match        string   `json:"match"`
+		ResourceType string   `json:"resource_type"`
+	}](args)
+	if err != nil || strings.TrimSpace(compareArgs.Query) == "" {
+		return ErrorResponse("Error: modules and query are required")
+	}
+	if len(compareArgs.Modules) < 2 {
+		return ErrorResponse("Error: provide at least two modules to compare")
+	}
+
+	filter := database.RelationshipFilter{
+		Term:         strings.TrimSpace(compareArgs.Query),
+		ResourceType: strings.TrimSpace(compareArgs.ResourceType),
+		Limit:        500,
+	}
+	switch strings.ToLower(strings.TrimSpace(compareArgs.Match)) {
+	case "", "fuzzy":
+	case "exact":
+		filter.Exact = true
+	default:
+		return ErrorResponse(fmt.Sprintf("Unsupported match mode '%s': use fuzzy or exact", compareArgs.Match))
+	}
+
+	var names []string
+	rels := make(map[string][]database.HCLRelationship)
+	files := make(map[string]map[string]*database.ModuleFile)
+	for _, name := range compareArgs.Modules {
+		module, err := s.resolveModuleScope(name, compareArgs.Submodule)
+		if err != nil {
+			return s.moduleNotFound(name, compareArgs.Submodule, err)
+		}
+		if _, dup := rels[module.Name]; dup {
+			continue
+		}
+
+		filter.ModuleID = module.ID
+		matches, _, err := s.db.SearchRelationships(filter)
+		if err != nil {
+			return ErrorResponse(fmt.Sprintf("Failed to load relationships for %s: %v", module.Name, err))
+		}
+		names = append(names, module.Name)
+		rels[module.Name] = matches
+		files[module.Name] = s.moduleFileMap(module.ID)
+	}
+
+	alignments := alignRelationships(names, rels, files)
+	return SuccessResponse(formatter.RelationshipComparison(relationshipFilterLabel(filter), names, alignments))
+}
+
+func (s *Server) handleTraceDataFlow(args any) map[string]any {
+	if err := s.ensureDB(); err != nil {
+		return ErrorResponse(fmt.Sprintf("Failed to initialize database: %v", err))
+	}
+
+	flowArgs, err := UnmarshalArgs[struct {
+		ModuleName string `json:"module_name"`
+		Submodule  string `json:"submodule"`
+		From       string `json:"from"`
+		To         string `json:"to"`
+		MaxDepth   int    `json:"max_depth"`
+		Limit      int    `json:"limit"`
+	}](args)
+	if err != nil || strings.TrimSpace(flowArgs.From) == "" {
+		return ErrorResponse("Error: module_name and from are required")
+	}
+	if flowArgs.MaxDepth <= 0 {
+		flowArgs.MaxDepth = 8
+	}
+	if flowArgs.Limit <= 0 {
+		flowArgs.Limit = 20
+	}
+
+	module, err := s.resolveModuleScope(flowArgs.ModuleName, flowArgs.Submodule)
+	if err != nil {
+		return s.moduleNotFound(flowArgs.ModuleName, flowArgs.Submodule, err)
+	}
+
+	node, field := parseFlowSymbol(flowArgs.From)
+	if node == "" {
+		return ErrorResponse(fmt.Sprintf("Cannot trace '%s': expected a symbol such as var.name, local.name, data.type.name or type.name", flowArgs.From))
+	}
+
+	rels, err := s.db.GetModuleRelationships(module.ID)
+	if err != nil {
+		return ErrorResponse(fmt.Sprintf("Error loading relationships: %v", err))
+	}
+
+	graph := buildFlowGraph(rels)
+	paths, truncated := graph.tracePaths(node, field, strings.TrimSpace(flowArgs.To), flowArgs.MaxDepth, flowArgs.Limit)
+
+	files := s.moduleFileMap(module.ID)
+	views := make([]formatter.DataFlowPath, 0, len(paths))
+	for _, p := range paths {
+		var view formatter.DataFlowPath
+		for _, e := range p {
+			hop := formatter.DataFlowHop{
+				Target:    flowHopTarget(e),
+				Via:       e.Rel.ReferenceName,
+				File:      e.Rel.FilePath,
+				Iteration: isIterationAttribute(e.Attribute),
+			}
+			if f, ok := files[e.Rel.FilePath]; ok {
+				hop.Line = lineForByte(f.Content, e.Rel.StartByte)
+			}
+			view.Hops = append(view.Hops, hop)
+		}
+		views = append(views, view)
+	}
+
+	return SuccessResponse(formatter.DataFlowTrace(module.Name, flowArgs.From, flowArgs.To, views, truncated))
+}
+
+func (s *Server) handleExportModuleGraph(args any) map[string]any {
+	if err := s.ensureDB(); err != nil {
+		return ErrorResponse(fmt.Sprintf("Failed to initialize database: %v", err))
+	}
+
+	graphArgs, err := UnmarshalArgs[struct {
+		ModuleName     string `json:"module_name"`
+		Submodule      string `json:"submodule"`
+		Format         string `json:"format"`
+		CollapseByType bool   `json:"collapse_by_type"`
+		Filter         string `json:"filter"`
+	}](args)
+	if err != nil {
+		return ErrorResponse("Error: module_name is required")
+	}
+
+	format := strings.ToLower(strings.TrimSpace(graphArgs.Format))
+	switch format {
+	case "":
+		format = "mermaid"
+	case "dot", "graphviz":
+		format = "dot"
+	case "mermaid":
+	default:
+		return ErrorResponse(fmt.Sprintf("Unsupported format '%s': use dot or mermaid", graphArgs.Format))
+	}
+
+	module, err := s.resolveModuleScope(graphArgs.ModuleName, graphArgs.Submodule)
+	if err != nil {
+		return s.moduleNotFound(graphArgs.ModuleName, graphArgs.Submodule, err)
+	}
+
+	rels, err := s.db.GetModuleRelationships(module.ID)
+	if err != nil {
+		return ErrorResponse(fmt.Sprintf("Error loading relationships: %v", err))
+	}
+	blocks, err := s.db.GetModuleBlocks(module.ID)
+	if err != nil {
+		return ErrorResponse(fmt.Sprintf("Error loading blocks: %v", err))
+	}
+
+	nodes, edges := moduleGraph(buildFlowGraph(rels), declaredNodes(blocks), graphArgs.CollapseByType, graphArgs.Filter)
+	return SuccessResponse(formatter.ModuleGraph(module.Name, format, nodes, edges))
+}
+
+// flowHopTarget names the attribute a hop writes to: the local itself for
+// locals, the output for outputs, and node.attribute otherwise.
+func flowHopTarget(e flowEdge) string {
+	switch nodeKind(e.To) {
+	case "local":
+		return "local." + e.Attribute
+	case "output":
+		return e.To
+	}
+	return e.To + "." + e.Attribute
+}
+
+func (s *Server) handleListAddressMigrations(args any) map[string]any {
+	if err := s.ensureDB(); err != nil {
+		return ErrorResponse(fmt.Sprintf("Failed to initialize database: %v", err))
+	}
+
+	moduleArgs, err := UnmarshalArgs[struct {
+		ModuleName string `json:"module_name"`
+		Submodule  string `json:"submodule"`
+	}](args)
+	if err != nil {
+		return ErrorResponse("Error: Invalid parameters")
+	}
+
+	if moduleArgs.ModuleName != "" {
+		module, err := s.resolveModuleScope(moduleArgs.ModuleName, moduleArgs.Submodule)
+		if err != nil {
+			return s.moduleNotFound(moduleArgs.ModuleName, moduleArgs.Submodule, err)
+		}
+
+		migrations, err := s.db.GetModuleMigrations(module.ID)
+		if err != nil {
+			return ErrorResponse(fmt.Sprintf("Error loading migrations: %v", err))
+		}
+
+		text := formatter.AddressMigrations([]formatter.ModuleMigrationView{{ModuleName: module.Name, Migrations: migrations}})
+		return SuccessResponse(text)
+	}
+
+	migrations, err := s.db.ListMigrations()
+	if err != nil {
+		return ErrorResponse(fmt.Sprintf("Error loading migrations: %v", err))
+	}
+
+	var views []formatter.ModuleMigrationView
+	for _, m := range migrations {
+		if len(views) == 0 || views[len(views)-1].Migrations[0].ModuleID != m.ModuleID {
+			mod, err := s.db.GetModuleByID(m.ModuleID)
+			if err != nil {
+				log.Printf("Warning: failed to load module %d for migrations: %v", m.ModuleID, err)
+				continue
+			}
+			views = append(views, formatter.ModuleMigrationView{ModuleName: mod.Name})
+		}
+		views[len(views)-1].Migrations = append(views[len(views)-1].Migrations, m)
+	}
+
+	sort.SliceStable(views, func(i, j int) bool {
+		return views[i].ModuleName < views[j].ModuleName
+	})
+
+	text := formatter.AddressMigrations(views)
+	return SuccessResponse(text)
+}
+
 func (s *Server) handleListModuleExamples(args any) map[string]any {
 	if err := s.ensureDB(); err != nil {
 		return ErrorResponse(fmt.Sprintf("Failed to initialize database: %v", err))
@@ -1633,14 +2968,15 @@ func (s *Server) handleListModuleExamples(args any) map[string]any {
 
 	moduleArgs, err := UnmarshalArgs[struct {
 		ModuleName string `json:"module_name"`
+		Submodule  string `json:"submodule"`
 	}](args)
 	if err != nil {
 		return ErrorResponse("Error: Invalid parameters")
 	}
 
-	module, err := s.resolveModule(moduleArgs.ModuleName)
+	module, err := s.resolveModuleScope(moduleArgs.ModuleName, moduleArgs.Submodule)
 	if err != nil {
-		return ErrorResponse(fmt.Sprintf("Module '%s' not found", moduleArgs.ModuleName))
+		return s.moduleNotFound(moduleArgs.ModuleName, moduleArgs.Submodule, err)
 	}
 
 	files, err := s.db.GetModuleFiles(module.ID)
@@ -1656,17 +2992,19 @@ func (s *Server) handleListModuleExamples(args any) map[string]any {
 func buildExampleMap(files []database.ModuleFile) map[string][]string {
 	exampleMap := make(map[string][]string)
 	for _, file := range files {
-		if strings.HasPrefix(file.FilePath, "examples/") {
-			parts := strings.Split(file.FilePath, "/")
-			if len(parts) >= 3 {
-				exampleName := parts[1]
-				exampleMap[exampleName] = append(exampleMap[exampleName], file.FileName)
-			}
+		if _, exampleName := indexer.ExampleFromPath(file.FilePath); exampleName != "" {
+			exampleMap[exampleName] = append(exampleMap[exampleName], file.FileName)
 		}
 	}
 	return exampleMap
 }
 
+// targetsExamples reports whether a file path glob names example code, such
+// as examples/* or modules/*/examples/**.
+func targetsExamples(glob string) bool {
+	return strings.HasPrefix(glob, "examples/") || strings.Contains(glob, "/examples/")
+}
+
 func (s *Server) handleGetExampleContent(args any) map[string]any {
 	if err := s.ensureDB(); err != nil {
 		return ErrorResponse(fmt.Sprintf("Failed to initialize database: %v", err))
@@ -1674,15 +3012,20 @@ func (s *Server) handleGetExampleContent(args any) map[string]any {
 
 	exampleArgs, err := UnmarshalArgs[struct {
 		ModuleName  string `json:"module_name"`
+		Submodule   string `json:"submodule"`
 		ExampleName string `json:"example_name"`
 	}](args)
 	if err != nil {
 		return ErrorResponse("Error: Invalid parameters")
 	}
+	exampleArgs.ExampleName = strings.TrimSpace(exampleArgs.ExampleName)
+	if exampleArgs.ExampleName == "" {
+		return ErrorResponse("Error: example_name is required")
+	}
 
-	module, err := s.resolveModule(exampleArgs.ModuleName)
+	module, err := s.resolveModuleScope(exampleArgs.ModuleName, exampleArgs.Submodule)
 	if err != nil {
-		return ErrorResponse(fmt.Sprintf("Module '%s' not found", exampleArgs.ModuleName))
+		return s.moduleNotFound(exampleArgs.ModuleName, exampleArgs.Submodule, err)
 	}
 
 	files, err := s.db.GetModuleFiles(module.ID)
@@ -1692,7 +3035,7 @@ func (s *Server) handleGetExampleContent(args any) map[string]any {
 
 	exampleFiles := filterExampleFiles(files, exampleArgs.ExampleName)
 	if len(exampleFiles) == 0 {
-		return ErrorResponse(fmt.Sprintf("Example '%s' not found in module '%s'", exampleArgs.ExampleName, exampleArgs.ModuleName))
+		return ErrorResponse(fmt.Sprintf("Example '%s' not found in module '%s'", exampleArgs.ExampleName, module.Name))
 	}
 
 	sortedFiles := sortExampleFiles(exampleFiles)
@@ -1700,11 +3043,220 @@ func (s *Server) handleGetExampleContent(args any) map[string]any {
 	return SuccessResponse(text)
 }
 
+func (s *Server) handleExplainExample(args any) map[string]any {
+	if err := s.ensureDB(); err != nil {
+		return ErrorResponse(fmt.Sprintf("Failed to initialize database: %v", err))
+	}
+
+	exampleArgs, err := UnmarshalArgs[struct {
+		ModuleName  string `json:"module_name"`
+		Submodule   string `json:"submodule"`
+		ExampleName string `json:"example_name"`
+	}](args)
+	if err != nil {
+		return ErrorResponse("Error: Invalid parameters")
+	}
+
+	module, err := s.resolveModuleScope(exampleArgs.ModuleName, exampleArgs.Submodule)
+	if err != nil {
+		return s.moduleNotFound(exampleArgs.ModuleName, exampleArgs.Submodule, err)
+	}
+
+	examples, err := s.db.GetModuleExamples(module.ID)
+	if err != nil {
+		return ErrorResponse(fmt.Sprintf("Error loading examples: %v", err))
+	}
+
+	files := s.moduleFileMap(module.ID)
+	var views []formatter.ExampleExplanationView
+	for _, ex := range examples {
+		if exampleArgs.ExampleName != "" && ex.Name != exampleArgs.ExampleName {
+			continue
+		}
+		views = append(views, formatter.ExampleExplanationView{
+			Example: ex.Name,
+			Calls:   exampleCallViews(s.exampleModuleCalls(module, ex, files)),
+		})
+	}
+
+	if exampleArgs.ExampleName != "" && len(views) == 0 {
+		return ErrorResponse(fmt.Sprintf("Example '%s' not found in module '%s'", exampleArgs.ExampleName, module.Name))
+	}
+
+	return SuccessResponse(formatter.ExampleExplanation(module.Name, views))
+}
+
+func (s *Server) handleFindExamplesFor(args any) map[string]any {
+	if err := s.ensureDB(); err != nil {
+		return ErrorResponse(fmt.Sprintf("Failed to initialize database: %v", err))
+	}
+
+	findArgs, err := UnmarshalArgs[struct {
+		Query      string `json:"query"`
+		ModuleName string `json:"module_name"`
+		Submodule  string `json:"submodule"`
+		Limit      int    `json:"limit"`
+	}](args)
+	if err != nil || strings.TrimSpace(findArgs.Query) == "" {
+		return ErrorResponse("Error: query is required")
+	}
+	if findArgs.Limit <= 0 {
+		findArgs.Limit = 10
+	}
+
+	terms := featureTerms(findArgs.Query, true)
+	if len(terms) == 0 {
+		return ErrorResponse("Error: query has no searchable terms")
+	}
+
+	var examples []database.ModuleExample
+	if findArgs.ModuleName != "" {
+		module, err := s.resolveModuleScope(findArgs.ModuleName, findArgs.Submodule)
+		if err != nil {
+			return s.moduleNotFound(findArgs.ModuleName, findArgs.Submodule, err)
+		}
+		examples, err = s.db.GetModuleExamples(module.ID)
+		if err != nil {
+			return ErrorResponse(fmt.Sprintf("Error loading examples: %v", err))
+		}
+	} else {
+		examples, err = s.db.ListExamples()
+		if err != nil {
+			return ErrorResponse(fmt.Sprintf("Error loading examples: %v", err))
+		}
+	}
+
+	var (
+		matches []formatter.ExampleFeatureMatch
+		module  *database.Module
+		files   map[string]*database.ModuleFile
+	)
+	for _, ex := range examples {
+		if module == nil || module.ID != ex.ModuleID {
+			module, err = s.db.GetModuleByID(ex.ModuleID)
+			if err != nil {
+				log.Printf("Warning: failed to load module %d for examples: %v", ex.ModuleID, err)
+				module = nil
+				continue
+			}
+			files = s.moduleFileMap(module.ID)
+		}
+		matched, paths := matchExampleFeatures(terms, ex.Name, s.exampleModuleCalls(module, ex, files))
+		if len(matched) == 0 {
+			continue
+		}
+		matches = append(matches, formatter.ExampleFeatureMatch{
+			ModuleName: module.Name,
+			Example:    ex.Name,
+			Matched:    matched,
+			Paths:      paths,
+		})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if len(matches[i].Matched) != len(matches[j].Matched) {
+			return len(matches[i].Matched) > len(matches[j].Matched)
+		}
+		return len(matches[i].Paths) > len(matches[j].Paths)
+	})
+	if len(matches) > findArgs.Limit {
+		matches = matches[:findArgs.Limit]
+	}
+
+	return SuccessResponse(formatter.ExampleFeatureMatches(findArgs.Query, terms, matches))
+}
+
+func (s *Server) handleExampleCoverage(args any) map[string]any {
+	if err := s.ensureDB(); err != nil {
+		return ErrorResponse(fmt.Sprintf("Failed to initialize database: %v", err))
+	}
+
+	coverageArgs, err := UnmarshalArgs[struct {
+		ModuleName string `json:"module_name"`
+		Submodule  string `json:"submodule"`
+	}](args)
+	if err != nil {
+		return ErrorResponse("Error: Invalid parameters")
+	}
+
+	var modules []database.Module
+	if coverageArgs.ModuleName != "" {
+		module, err := s.resolveModuleScope(coverageArgs.ModuleName, coverageArgs.Submodule)
+		if err != nil {
+			return s.moduleNotFound(coverageArgs.ModuleName, coverageArgs.Submodule, err)
+		}
+		modules = []database.Module{*module}
+	} else {
+		modules, err = s.db.ListModules()
+		if err != nil {
+			return ErrorResponse(fmt.Sprintf("Error listing modules: %v", err))
+		}
+	}
+
+	coverage, err := s.exampleCoverage(modules)
+	if err != nil {
+		return ErrorResponse(fmt.Sprintf("Error computing coverage: %v", err))
+	}
+
+	views := make([]formatter.ModuleCoverageView, 0, len(coverage))
+	for _, c := range coverage {
+		view := formatter.ModuleCoverageView{
+			ModuleName:  c.Module.Name,
+			HasExamples: c.Module.HasExamples,
+			Examples:    c.Examples,
+			Variables:   len(c.Variables),
+			NestedPaths: len(c.Paths),
+			Opaque:      c.Opaque,
+		}
+		for _, v := range c.Variables {
+			if !c.SetVariables[v.Name] {
+				view.UntestedVariables = append(view.UntestedVariables, v.Name)
+			}
+		}
+		for _, p := range c.Paths {
+			if !c.SetPaths[p] {
+				view.UntestedPaths = append(view.UntestedPaths, p)
+			}
+		}
+		views = append(views, view)
+	}
+
+	if coverageArgs.ModuleName != "" {
+		return SuccessResponse(formatter.ExampleCoverageDetail(views[0]))
+	}
+	return SuccessResponse(formatter.ExampleCoverageCatalog(views))
+}
+
+func (s *Server) moduleFileMap(moduleID int64) map[string]*database.ModuleFile {
+	files, err := s.db.GetModuleFiles(moduleID)
+	if err != nil {
+		return nil
+	}
+	out := make(map[string]*database.ModuleFile, len(files))
+	for i := range files {
+		out[files[i].FilePath] = &files[i]
+	}
+	return out
+}
+
+func exampleCallViews(calls []exampleCall) []formatter.ExampleCallView {
+	views := make([]formatter.ExampleCallView, 0, len(calls))
+	for _, c := range calls {
+		view := formatter.ExampleCallView{Name: c.Name, Target: c.Target, File: c.File, Line: c.Line}
+		for _, in := range c.Inputs {
+			view.Inputs = append(view.Inputs, formatter.ExampleInputView{Variable: in.Variable, Declared: in.Declared, Paths: in.Paths})
+		}
+		views = append(views, view)
+	}
+	return views
+}
+
 func filterExampleFiles(files []database.ModuleFile, exampleName string) []database.ModuleFile {
-	examplePrefix := fmt.Sprintf("examples/%s/", exampleName)
 	var exampleFiles []database.ModuleFile
 	for _, file := range files {
-		if strings.HasPrefix(file.FilePath, examplePrefix) {
+		// Files outside any example have no example directory and an empty
+		// name, which must not match.
+		if dir, name := indexer.ExampleFromPath(file.FilePath); dir != "" && name == exampleName {
 			exampleFiles = append(exampleFiles, file)
 		}
 	}
@@ -1868,20 +3420,33 @@ func (s *Server) sendError(code int, message string, id any) {
 	s.sendResponse(response)
 }
 
-func (s *Server) resolveModule(nameOrAlias string) (*database.Module, error) {
-	if m, err := s.db.GetModule(nameOrAlias); err == nil {
-		return m, nil
+var errSubmoduleNotFound = errors.New("submodule not found")
+
+// moduleFilePath returns the stored path of filePath in module. Submodule
+// files are stored with their repository path, so a path relative to the
+// submodule is joined onto its subpath.
+func moduleFilePath(module *database.Module, filePath string) string {
+	if module.Subpath == "" || strings.HasPrefix(filePath, module.Subpath+"/") {
+		return filePath
 	}
-	if m, err := s.db.ResolveModuleByAlias(nameOrAlias); err == nil {
-		return m, nil
+	return path.Join(module.Subpath, filePath)
+}
+
+// resolveModuleScope resolves a module name or alias and, when submodule is
+// set, the submodule of that module's repository.
+func (s *Server) resolveModuleScope(nameOrAlias, submodule string) (*database.Module, error) {
+	module, err := s.resolveModule(nameOrAlias)
+	if err != nil || submodule == "" {
+		return module, err
 	}
-	if m, err := s.db.ResolveModuleByAliasPrefix(nameOrAlias); err == nil {
-		return m, nil
+
+	parentID := module.ID
+	if module.ParentID != 0 {
+		parentID = module.ParentID
 	}
-	mods, err := s.db.SearchModules(nameOrAlias, 1)
-	if err == nil && len(mods) > 0 {
-		m := mods[0]
-		return &m, nil
+	child, err := s.db.GetSubmodule(parentID, submodule)
+	if err != nil {
+		return nil, errSubmoduleNotFound
 	}
-	return nil, fmt.Errorf("module not found for '%s'", nameOrAlias)
+	return child, nil
 }